@@ -3,6 +3,9 @@
 package app
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/MindlessMuse666/code-merger/internal/config"
@@ -11,6 +14,9 @@ import (
 	"github.com/MindlessMuse666/code-merger/internal/storage"
 )
 
+// boltFilename имя файла БД хранилища bolt в каталоге STORAGE_DIR
+const boltFilename = "code-merger.db"
+
 // Run инициализирует и запускает приложение
 func Run() error {
 	// Загрузка конфига
@@ -20,16 +26,29 @@ func Run() error {
 	}
 
 	// Создание хранилища и сервиса
-	storage := storage.NewMemoryStorage()
+	storage, err := newStorage(cfg)
+	if err != nil {
+		return err
+	}
 	fileService := service.NewFileService(cfg, storage)
 
-	// Запуск отчистки хранилища
+	// Регистрация серверных шаблонов объединения
+	if cfg.TemplatesDir != "" {
+		if err := fileService.LoadTemplates(cfg.TemplatesDir); err != nil {
+			return err
+		}
+	}
+
+	// Запуск отчистки хранилища. Цикл нужен и для Redis: ключи истекают сами, но незавершенные
+	// загрузки и рабочие пространства удаляются целиком, а учет объема сверяется с хранилищем.
 	go func() {
 		ticker := time.NewTicker(cfg.CleanupInterval)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			// Удаление файлов, которые старше заданного в конфиге времени
+			// Удаление рабочих пространств без активности дольше заданного в конфиге времени
+			fileService.Cleanup(cfg.FileTTL)
+			// Обслуживание хранилища: незавершенные записи, содержимое без ссылок, учет объема
 			storage.Cleanup(cfg.FileTTL)
 		}
 	}()
@@ -38,3 +57,72 @@ func Run() error {
 	srv := server.NewServer(cfg, storage, fileService)
 	return srv.Run()
 }
+
+// newStorage создает хранилище, выбранное в конфиге, и оборачивает его шифрованием,
+// сжатием и дедупликацией содержимого и ограничением объема, если они включены.
+// Шифрование применяется ближе всего к базовому хранилищу, чтобы сжималось
+// исходное содержимое, а сжатие - под дедупликацией, чтобы сжималось
+// однократно сохраняемое содержимое, а не записи файлов.
+func newStorage(cfg *config.Config) (storage.Storage, error) {
+	result, err := newBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.StorageEncryption != "" {
+		keys, err := storage.ParseEncryptionKeys(cfg.StorageEncryption)
+		if err != nil {
+			return nil, err
+		}
+		if result, err = storage.NewEncryptedStorage(result, keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.StorageCompression != storage.CompressionNone {
+		if result, err = storage.NewCompressedStorage(result, cfg.StorageCompression); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.StorageDedup {
+		if result, err = storage.NewDedupStorage(result); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.StorageMaxBytes > 0 || cfg.SessionQuota > 0 {
+		if result, err = storage.NewBoundedStorage(result, cfg.StorageMaxBytes, cfg.SessionQuota); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// newBackend создает базовое хранилище по типу STORAGE_BACKEND
+func newBackend(cfg *config.Config) (storage.Storage, error) {
+	switch cfg.StorageBackend {
+	case "memory":
+		return storage.NewMemoryStorage(), nil
+	case "disk":
+		return storage.NewDiskStorage(cfg.StorageDir)
+	case "bolt":
+		if err := os.MkdirAll(cfg.StorageDir, 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create storage directory: %v", err)
+		}
+		return storage.NewBoltStorage(filepath.Join(cfg.StorageDir, boltFilename))
+	case "s3":
+		return storage.NewS3Storage(storage.S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			UseSSL:    cfg.S3UseSSL,
+			Prefix:    cfg.S3Prefix,
+		})
+	case "redis":
+		return storage.NewRedisStorage(cfg.RedisURL, cfg.RedisPrefix, cfg.FileTTL)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.StorageBackend)
+	}
+}
@@ -3,6 +3,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -11,12 +12,34 @@ import (
 
 // Config содержит все настраиваемые параметры приложения
 type Config struct {
-	Port            string        `json:"port"`             // Порт сервера
-	MaxFileSize     int64         `json:"max_file_size"`    // Максимальный размер файла в байтах
-	MaxTotalSize    int64         `json:"max_total_size"`   // Максимальный общий размер в байтах
-	FileTTL         time.Duration `json:"file_ttl"`         // Время жизни файлов в хранилище
-	CleanupInterval time.Duration `json:"cleanup_interval"` // Интервал очистки хранилища
-	AllowedOrigins  []string      `json:"allowed_origins"`  // Разрешенные origins для CORS
+	Port               string        `json:"port"`                 // Порт сервера
+	MaxFileSize        int64         `json:"max_file_size"`        // Максимальный размер файла в байтах
+	MaxTotalSize       int64         `json:"max_total_size"`       // Максимальный общий размер в байтах
+	FileTTL            time.Duration `json:"file_ttl"`             // Время жизни файлов в хранилище
+	CleanupInterval    time.Duration `json:"cleanup_interval"`     // Интервал очистки хранилища
+	AllowedOrigins     []string      `json:"allowed_origins"`      // Разрешенные origins для CORS
+	MaxArchiveEntries  int           `json:"max_archive_entries"`  // Максимальное количество элементов в архиве
+	MaxArchiveUnpacked int64         `json:"max_archive_unpacked"` // Максимальный объем распакованных данных архива в байтах
+	TemplatesDir       string        `json:"templates_dir"`        // Каталог с шаблонами объединения (*.tmpl)
+	TemplateTimeout    time.Duration `json:"template_timeout"`     // Максимальное время отрисовки шаблона
+	StorageBackend     string        `json:"storage_backend"`      // Тип хранилища: memory, disk, bolt, s3 или redis
+	StorageDir         string        `json:"storage_dir"`          // Каталог хранилища (disk, bolt)
+	S3Endpoint         string        `json:"s3_endpoint"`          // Адрес S3-совместимого хранилища
+	S3Bucket           string        `json:"s3_bucket"`            // Бакет S3
+	S3Region           string        `json:"s3_region"`            // Регион бакета S3
+	S3AccessKey        string        `json:"-"`                    // Ключ доступа S3
+	S3SecretKey        string        `json:"-"`                    // Секретный ключ S3
+	S3UseSSL           bool          `json:"s3_use_ssl"`           // Подключение к S3 по HTTPS
+	S3Prefix           string        `json:"s3_prefix"`            // Префикс ключей объектов S3
+	RedisURL           string        `json:"-"`                    // URL подключения к Redis (может содержать пароль)
+	RedisPrefix        string        `json:"redis_prefix"`         // Префикс ключей Redis
+	StorageDedup       bool          `json:"storage_dedup"`        // Хранить одинаковое содержимое однократно
+	StorageCompression string        `json:"storage_compression"`  // Сжатие содержимого: none, gzip или zstd
+	StorageEncryption  string        `json:"-"`                    // Ключи шифрования содержимого (id:base64, через запятую)
+	StorageMaxBytes    int64         `json:"storage_max_bytes"`    // Общий лимит объема файлов (0 - без ограничения)
+	SessionQuota       int64         `json:"session_quota"`        // Квота объема файлов одной сессии (0 - без ограничения)
+	AdminToken         string        `json:"-"`                    // Токен административных endpoints (пустой - endpoints отключены)
+	IngestRoots        []string      `json:"ingest_roots"`         // Каталоги сервера, доступные для загрузки файлов с диска
 }
 
 // Load загружает конфиг из переменных окружения
@@ -26,6 +49,28 @@ func Load() (*Config, error) {
 	maxTotalSizeStr := getEnv("MAX_TOTAL_SIZE", "52428800")                                                              // 50MB
 	fileTTLStr := getEnv("FILE_TTL", "600")                                                                              // 10 минут в секундах
 	cleanupIntervalStr := getEnv("CLEANUP_INTERVAL", "300")                                                              // 5 минут в секундах
+	maxArchiveEntriesStr := getEnv("MAX_ARCHIVE_ENTRIES", "1000")                                                        // Элементов в архиве
+	maxArchiveUnpackedStr := getEnv("MAX_ARCHIVE_UNPACKED", "104857600")                                                 // 100MB
+	templatesDir := getEnv("TEMPLATES_DIR", "")                                                                          // Без серверных шаблонов
+	templateTimeoutStr := getEnv("TEMPLATE_TIMEOUT", "5")                                                                // 5 секунд
+	storageBackend := getEnv("STORAGE_BACKEND", "memory")                                                                // Хранение в памяти
+	storageDir := getEnv("STORAGE_DIR", "./data/uploads")                                                                // Каталог для STORAGE_BACKEND=disk и bolt
+	s3Endpoint := getEnv("S3_ENDPOINT", "localhost:9000")                                                                // Локальный MinIO
+	s3Bucket := getEnv("S3_BUCKET", "code-merger")                                                                       // Бакет для загруженных файлов
+	s3Region := getEnv("S3_REGION", "")                                                                                  // Регион по умолчанию
+	s3AccessKey := getEnv("S3_ACCESS_KEY", "")                                                                           // Ключ доступа
+	s3SecretKey := getEnv("S3_SECRET_KEY", "")                                                                           // Секретный ключ
+	s3UseSSLStr := getEnv("S3_USE_SSL", "false")                                                                         // HTTP для локального MinIO
+	s3Prefix := getEnv("S3_PREFIX", "uploads/")                                                                          // Префикс ключей объектов
+	redisURL := getEnv("REDIS_URL", "redis://localhost:6379/0")                                                          // Локальный Redis
+	redisPrefix := getEnv("REDIS_PREFIX", "code-merger:file:")                                                           // Префикс ключей файлов
+	storageDedupStr := getEnv("STORAGE_DEDUP", "")                                                                       // Дедупликация содержимого (по умолчанию - кроме s3 и redis)
+	storageCompression := getEnv("STORAGE_COMPRESSION", "none")                                                          // Без сжатия
+	storageEncryption := getEnv("STORAGE_ENCRYPTION_KEYS", "")                                                           // Без шифрования
+	storageMaxBytesStr := getEnv("STORAGE_MAX_BYTES", "0")                                                               // Без общего лимита
+	sessionQuotaStr := getEnv("SESSION_QUOTA", "0")                                                                      // Без квоты сессии
+	adminToken := getEnv("ADMIN_TOKEN", "")                                                                              // Административные endpoints отключены
+	ingestRootsStr := getEnv("INGEST_ROOTS", "")                                                                         // Загрузка с диска отключена
 	allowedOriginsStr := getEnv("ALLOWED_ORIGINS", "http://localhost:3001,http://172.19.0.3:3001,http://127.0.0.1:3001") // Разрешенные origins
 
 	// Парсинг числовых значений
@@ -45,20 +90,90 @@ func Load() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	maxArchiveEntries, err := strconv.Atoi(maxArchiveEntriesStr)
+	if err != nil {
+		return nil, err
+	}
+	maxArchiveUnpacked, err := strconv.ParseInt(maxArchiveUnpackedStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	templateTimeout, err := strconv.ParseInt(templateTimeoutStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	s3UseSSL, err := strconv.ParseBool(s3UseSSLStr)
+	if err != nil {
+		return nil, err
+	}
+	// Счетчики ссылок дедупликации хранятся в памяти процесса и не разделяются между
+	// репликами: очистка на одной реплике удалила бы содержимое файлов другой
+	storageDedup := !sharedBackend(storageBackend)
+	if storageDedupStr != "" {
+		if storageDedup, err = strconv.ParseBool(storageDedupStr); err != nil {
+			return nil, err
+		}
+	}
+	if storageDedup && sharedBackend(storageBackend) {
+		return nil, fmt.Errorf("STORAGE_DEDUP is not supported with shared storage backend %s", storageBackend)
+	}
+	storageMaxBytes, err := strconv.ParseInt(storageMaxBytesStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	sessionQuota, err := strconv.ParseInt(sessionQuotaStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
 
 	// Парсинг разрешенных origins
 	allowedOrigins := strings.Split(allowedOriginsStr, ",")
 
+	// Парсинг каталогов для загрузки с диска
+	var ingestRoots []string
+	for _, root := range strings.Split(ingestRootsStr, ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			ingestRoots = append(ingestRoots, root)
+		}
+	}
+
 	return &Config{
-		Port:            port,
-		MaxFileSize:     maxFileSize,
-		MaxTotalSize:    maxTotalSize,
-		FileTTL:         time.Duration(fileTTL) * time.Second,
-		CleanupInterval: time.Duration(cleanupInterval) * time.Second,
-		AllowedOrigins:  allowedOrigins,
+		Port:               port,
+		MaxFileSize:        maxFileSize,
+		MaxTotalSize:       maxTotalSize,
+		FileTTL:            time.Duration(fileTTL) * time.Second,
+		CleanupInterval:    time.Duration(cleanupInterval) * time.Second,
+		AllowedOrigins:     allowedOrigins,
+		MaxArchiveEntries:  maxArchiveEntries,
+		MaxArchiveUnpacked: maxArchiveUnpacked,
+		TemplatesDir:       templatesDir,
+		TemplateTimeout:    time.Duration(templateTimeout) * time.Second,
+		StorageBackend:     storageBackend,
+		StorageDir:         storageDir,
+		S3Endpoint:         s3Endpoint,
+		S3Bucket:           s3Bucket,
+		S3Region:           s3Region,
+		S3AccessKey:        s3AccessKey,
+		S3SecretKey:        s3SecretKey,
+		S3UseSSL:           s3UseSSL,
+		S3Prefix:           s3Prefix,
+		RedisURL:           redisURL,
+		RedisPrefix:        redisPrefix,
+		StorageDedup:       storageDedup,
+		StorageCompression: storageCompression,
+		StorageEncryption:  storageEncryption,
+		StorageMaxBytes:    storageMaxBytes,
+		SessionQuota:       sessionQuota,
+		AdminToken:         adminToken,
+		IngestRoots:        ingestRoots,
 	}, nil
 }
 
+// sharedBackend проверяет, разделяется ли хранилище несколькими репликами сервиса
+func sharedBackend(backend string) bool {
+	return backend == "s3" || backend == "redis"
+}
+
 // getEnv возвращает значение переменной окружения или значение по умолчанию
 func getEnv(key string, defaultValue string) string {
 	value := os.Getenv(key)
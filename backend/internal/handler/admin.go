@@ -0,0 +1,128 @@
+// Package handler предоставляет HTTP-обработчики для API-endpoints.
+// Содержит административные endpoints, доступные по токену ADMIN_TOKEN.
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/MindlessMuse666/code-merger/internal/service"
+)
+
+// AdminHandler обрабатывает административные запросы
+type AdminHandler struct {
+	fileService *service.FileService
+}
+
+// NewAdminHandler создает новый экземпляр AdminHandler
+func NewAdminHandler(fileService *service.FileService) *AdminHandler {
+	return &AdminHandler{
+		fileService: fileService,
+	}
+}
+
+// ListFiles возвращает список файлов всех рабочих пространств
+// @Summary Список всех файлов хранилища
+// @Description Возвращает файлы всех рабочих пространств с фильтрацией и постраничной выборкой. Требует заголовок Authorization: Bearer <ADMIN_TOKEN>
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer <ADMIN_TOKEN>"
+// @Param workspace_id query string false "Только файлы рабочего пространства с указанным идентификатором"
+// @Param uploaded_after query string false "Загруженные не раньше указанного времени (RFC 3339)"
+// @Param uploaded_before query string false "Загруженные раньше указанного времени (RFC 3339)"
+// @Param min_size query integer false "Минимальный размер в байтах"
+// @Param max_size query integer false "Максимальный размер в байтах"
+// @Param offset query integer false "Количество пропускаемых файлов"
+// @Param limit query integer false "Максимальное количество файлов на странице"
+// @Success 200 {object} ListFilesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/admin/files [get]
+func (h *AdminHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "invalid filter", err.Error())
+		return
+	}
+	filter.SessionID = r.URL.Query().Get("workspace_id")
+
+	sendFileList(w, h.fileService, filter)
+}
+
+// IngestDirectory загружает файлы из каталога сервера в рабочее пространство
+// @Summary Загрузка файлов из каталога сервера
+// @Description Обходит каталог сервера из INGEST_ROOTS (или его подкаталог), отбирает файлы по шаблонам include/exclude (поддерживается ** для любого числа каталогов) и сохраняет их в рабочее пространство так же, как при POST /api/upload. Символические ссылки за пределы каталога пропускаются, файлы, исключенные правилами .gitignore и .codemergerignore, возвращаются со статусом ignored. Доступен, только если заданы ADMIN_TOKEN и INGEST_ROOTS.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer <ADMIN_TOKEN>"
+// @Param X-Workspace-Token header string true "Токен рабочего пространства, в которое сохраняются файлы"
+// @Param request body service.IngestRequest true "Каталог и шаблоны отбора файлов"
+// @Success 200 {object} UploadResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 413 {object} UploadRejectedResponse
+// @Failure 415 {object} UploadRejectedResponse
+// @Failure 429 {object} UploadRejectedResponse
+// @Failure 500 {object} ErrorResponse
+// @Failure 507 {object} UploadRejectedResponse
+// @Router /api/admin/ingest [post]
+func (h *AdminHandler) IngestDirectory(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	var req service.IngestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid JSON", err.Error())
+		return
+	}
+
+	files, skipped, err := h.fileService.IngestDirectory(workspace, req)
+	switch {
+	case errors.Is(err, service.ErrIngestDisabled), errors.Is(err, service.ErrRootNotAllowed):
+		sendError(w, http.StatusForbidden, "directory is not allowed", err.Error())
+		return
+	case errors.Is(err, service.ErrInvalidPattern):
+		sendError(w, http.StatusBadRequest, "invalid pattern", err.Error())
+		return
+	case err != nil:
+		sendError(w, http.StatusInternalServerError, "failed to ingest directory", err.Error())
+		return
+	}
+
+	batch := &uploadBatch{}
+	for _, file := range files {
+		batch.accept(file, "")
+	}
+	for _, entry := range skipped {
+		batch.skip(entry, "")
+	}
+	if len(batch.results) == 0 {
+		sendError(w, http.StatusBadRequest, "no files matched", "directory contains no files matching the patterns")
+		return
+	}
+	sendUploadResults(w, batch)
+}
+
+// RequireAdminToken возвращает middleware, пропускающее только запросы
+// с заголовком Authorization: Bearer <token>
+func RequireAdminToken(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			// Сравнение за постоянное время не раскрывает токен по времени ответа
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				sendError(w, http.StatusUnauthorized, "unauthorized", "valid admin token is required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
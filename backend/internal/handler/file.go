@@ -1,11 +1,16 @@
 // Package handler предоставляет HTTP-обработчики для API-endpoints.
-// Содержит логику получения содержимого файла.
+// Содержит логику получения содержимого файла, продления его жизни и списка загруженных файлов.
 package handler
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/MindlessMuse666/code-merger/internal/service"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -14,6 +19,19 @@ type FileHandler struct {
 	fileService *service.FileService
 }
 
+// ListFilesResponse представляет страницу списка загруженных файлов
+type ListFilesResponse struct {
+	Files   []service.UploadedFile `json:"files"`    // Файлы в порядке загрузки
+	Count   int                    `json:"count"`    // Количество файлов на странице
+	HasMore bool                   `json:"has_more"` // Есть ли файлы после этой страницы
+}
+
+// TouchResponse представляет результат продления времени жизни файла
+type TouchResponse struct {
+	ID        string    `json:"id"`         // Идентификатор файла
+	ExpiresAt time.Time `json:"expires_at"` // Время, после которого файл будет удален
+}
+
 // NewFileHandler создает новый экземпляр FileHandler
 func NewFileHandler(fileService *service.FileService) *FileHandler {
 	return &FileHandler{
@@ -26,20 +44,171 @@ func NewFileHandler(fileService *service.FileService) *FileHandler {
 // @Description Возвращает содержимое файла по его идентификатору для предпросмотра
 // @Tags Files
 // @Produce plain
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
 // @Param fileId path string true "ID файла"
 // @Success 200 {string} string "Содержимое файла"
+// @Header 200 {integer} X-Token-Count "Количество токенов содержимого"
+// @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
 // @Router /api/file/{fileId} [get]
 func (h *FileHandler) GetFileContent(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
 	fileID := chi.URLParam(r, "fileId")
 
-	fileData, err := h.fileService.GetFileByID(fileID)
+	fileData, err := h.fileService.GetFileByID(workspace, fileID)
 	if err != nil {
 		sendError(w, http.StatusNotFound, "file not found", err.Error())
 		return
 	}
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set(HeaderTokenCount, strconv.Itoa(fileData.TokenCount))
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fileData.Content))
 }
+
+// TouchFile продлевает время жизни файла
+// @Summary Продление времени жизни файла
+// @Description Отсчитывает время жизни файла и его рабочего пространства (FILE_TTL) заново от текущего момента
+// @Tags Files
+// @Produce json
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param fileId path string true "ID файла"
+// @Success 200 {object} TouchResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/file/{fileId}/touch [post]
+func (h *FileHandler) TouchFile(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+	fileID := chi.URLParam(r, "fileId")
+
+	expiresAt, err := h.fileService.TouchFile(workspace, fileID)
+	if err != nil {
+		sendError(w, http.StatusNotFound, "file not found", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(TouchResponse{
+		ID:        fileID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// ListFiles возвращает список файлов рабочего пространства
+// @Summary Список загруженных файлов
+// @Description Возвращает файлы рабочего пространства с фильтрацией по времени загрузки и размеру
+// @Tags Files
+// @Produce json
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param uploaded_after query string false "Загруженные не раньше указанного времени (RFC 3339)"
+// @Param uploaded_before query string false "Загруженные раньше указанного времени (RFC 3339)"
+// @Param min_size query integer false "Минимальный размер в байтах"
+// @Param max_size query integer false "Максимальный размер в байтах"
+// @Param offset query integer false "Количество пропускаемых файлов"
+// @Param limit query integer false "Максимальное количество файлов на странице"
+// @Success 200 {object} ListFilesResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/files [get]
+func (h *FileHandler) ListFiles(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	filter, err := parseListFilter(r)
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "invalid filter", err.Error())
+		return
+	}
+	filter.SessionID = workspace
+
+	sendFileList(w, h.fileService, filter)
+}
+
+// sendFileList отправляет страницу списка файлов, удовлетворяющих фильтру
+func sendFileList(w http.ResponseWriter, fileService *service.FileService, filter storage.ListFilter) {
+	// Запрашивается на один файл больше, чтобы определить наличие следующей страницы
+	limit := filter.Limit
+	if limit > 0 {
+		filter.Limit++
+	}
+
+	files, err := fileService.ListFiles(filter)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "failed to list files", err.Error())
+		return
+	}
+
+	hasMore := limit > 0 && len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	if files == nil {
+		files = []service.UploadedFile{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ListFilesResponse{
+		Files:   files,
+		Count:   len(files),
+		HasMore: hasMore,
+	})
+}
+
+// parseListFilter разбирает параметры фильтра списка файлов из строки запроса
+func parseListFilter(r *http.Request) (storage.ListFilter, error) {
+	var filter storage.ListFilter
+	query := r.URL.Query()
+
+	for name, target := range map[string]*time.Time{
+		"uploaded_after":  &filter.UploadedAfter,
+		"uploaded_before": &filter.UploadedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return storage.ListFilter{}, fmt.Errorf("invalid %s: %v", name, err)
+			}
+			*target = t
+		}
+	}
+
+	for name, target := range map[string]*int64{
+		"min_size": &filter.MinSize,
+		"max_size": &filter.MaxSize,
+	} {
+		if value := query.Get(name); value != "" {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return storage.ListFilter{}, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			*target = size
+		}
+	}
+
+	for name, target := range map[string]*int{
+		"offset": &filter.Offset,
+		"limit":  &filter.Limit,
+	} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return storage.ListFilter{}, fmt.Errorf("invalid %s: %s", name, value)
+			}
+			*target = n
+		}
+	}
+
+	return filter, nil
+}
@@ -3,13 +3,31 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
 
 	"github.com/MindlessMuse666/code-merger/internal/service"
 )
 
+// Способы упаковки частей объединенного файла
+const (
+	splitZip       = "zip"       // ZIP-архив с частями
+	splitMultipart = "multipart" // Ответ multipart/mixed
+)
+
+// maxFileTokenCountsLen ограничивает длину заголовка X-File-Token-Counts:
+// прокси и клиенты отклоняют ответы со слишком длинными заголовками
+const maxFileTokenCountsLen = 4096
+
 // MergeHandler обрабатывает объединение файлов
 type MergeHandler struct {
 	fileService *service.FileService
@@ -17,9 +35,17 @@ type MergeHandler struct {
 
 // MergeRequest представляет запрос на объединение файлов
 type MergeRequest struct {
-	FileIDs        []string          `json:"file_ids"`
-	OutputFilename string            `json:"output_filename"`
-	FileRenames    map[string]string `json:"file_renames"`
+	FileIDs         []string          `json:"file_ids"`
+	OutputFilename  string            `json:"output_filename"`
+	FileRenames     map[string]string `json:"file_renames"`      // Переименования: ключ - ID файла, относительный путь или имя файла
+	SortBy          string            `json:"sort_by"`           // Порядок файлов: "" (как в file_ids) или "path"
+	Format          string            `json:"format"`            // Формат вывода: "comments" (по умолчанию), "markdown", "xml", "json", "jsonl" или "template"
+	Template        string            `json:"template"`          // Шаблон text/template для формата "template"
+	TemplateName    string            `json:"template_name"`     // Имя серверного шаблона для формата "template"
+	TableOfContents bool              `json:"table_of_contents"` // Добавить дерево каталогов и оглавление
+	MaxTokens       int               `json:"max_tokens"`        // Максимальное количество токенов в одной части
+	MaxBytes        int64             `json:"max_bytes"`         // Максимальный размер одной части в байтах
+	SplitFormat     string            `json:"split_format"`      // Упаковка частей: "zip" (по умолчанию) или "multipart"
 }
 
 // NewMergeHandler создает новый экземпляр MergeHandler
@@ -34,15 +60,27 @@ func NewMergeHandler(fileService *service.FileService) *MergeHandler {
 // @Description Объединяет ранее загруженные файлы в один текстовый файл с соблюдением правил форматирования
 // @Tags Processing
 // @Summary Объединение загруженных файлов
-// @Description Эндпоинт принимает массив идентификаторов файлов, полученных от /api/upload, и объединяет их содержимое в один файл согласно правилам форматирования. Поддерживает переименование файлов в выходном результате.
+// @Description Эндпоинт принимает массив идентификаторов файлов, полученных от /api/upload, и объединяет их содержимое в один файл согласно правилам форматирования. Поддерживает переименование файлов в выходном результате по ID файла, относительному пути или имени, а также форматы вывода comments, markdown, xml, json, jsonl и пользовательские шаблоны text/template, а также оглавление с деревом каталогов и разбиение результата на части по лимиту токенов или байтов.
 // @Accept json
-// @Produce octet-stream
+// @Produce octet-stream,json,application/zip
+// @Param X-Workspace-Token header string true "Токен рабочего пространства, в которое загружены файлы"
 // @Param request body MergeRequest true "Параметры объединения"
 // @Success 200 {file} binary "Объединенный файл"
+// @Header 200 {integer} X-Token-Count "Количество токенов объединенного файла"
+// @Header 200 {integer} X-Files-Token-Count "Суммарное количество токенов объединяемых файлов"
+// @Header 200 {string} X-File-Token-Counts "Количество токенов каждого файла (список усекается до 4 КБ)"
+// @Header 200 {integer} X-Part-Count "Количество частей (при разбиении по max_tokens/max_bytes ответ - ZIP-архив или multipart/mixed)"
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
 // @Failure 404 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
 // @Router /api/merge [post]
 func (h *MergeHandler) HandleMerge(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
 	var request MergeRequest
 
 	// Парсинг JSON тела запроса
@@ -62,20 +100,160 @@ func (h *MergeHandler) HandleMerge(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получение файлов через сервис
-	filesContent, err := h.fileService.GetFiles(request.FileIDs, request.FileRenames)
+	filesContent, err := h.fileService.GetFiles(workspace, request.FileIDs, request.FileRenames)
 	if err != nil {
+		if errors.Is(err, service.ErrUnknownRename) {
+			sendError(w, http.StatusBadRequest, "invalid file renames", err.Error())
+			return
+		}
 		sendError(w, http.StatusNotFound, "files not found", err.Error())
 		return
 	}
 
-	// Объединяем файлы через сервис
-	result := h.fileService.MergeFiles(filesContent)
+	// Упорядочиваем файлы
+	if err := h.fileService.SortFiles(filesContent, request.SortBy); err != nil {
+		sendError(w, http.StatusBadRequest, "invalid sort order", err.Error())
+		return
+	}
+
+	// Формат template подразумевается, если передан шаблон
+	format := service.MergeFormat(request.Format)
+	if format == "" && (request.Template != "" || request.TemplateName != "") {
+		format = service.FormatTemplate
+	}
+
+	// Валидация: параметры разбиения на части
+	if request.MaxTokens < 0 || request.MaxBytes < 0 {
+		sendError(w, http.StatusBadRequest, "invalid split limits", "max_tokens and max_bytes must be positive")
+		return
+	}
+	if request.SplitFormat != "" && request.SplitFormat != splitZip && request.SplitFormat != splitMultipart {
+		sendError(w, http.StatusBadRequest, "invalid split format", fmt.Sprintf("unsupported split format: %s", request.SplitFormat))
+		return
+	}
+
+	// Объединяем файлы через сервис с разбиением на части по лимитам
+	parts, err := h.fileService.MergeParts(filesContent, service.MergeOptions{
+		Format:          format,
+		Template:        request.Template,
+		TemplateName:    request.TemplateName,
+		TableOfContents: request.TableOfContents,
+		OutputFilename:  request.OutputFilename,
+	}, service.MergeLimits{
+		MaxTokens: request.MaxTokens,
+		MaxBytes:  request.MaxBytes,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrTemplateTimeout) || errors.Is(err, service.ErrTemplateOutputLimit) {
+			sendError(w, http.StatusUnprocessableEntity, "template rendering failed", err.Error())
+			return
+		}
+		if errors.Is(err, service.ErrBudgetTooSmall) {
+			sendError(w, http.StatusBadRequest, "failed to split output", err.Error())
+			return
+		}
+		sendError(w, http.StatusBadRequest, "invalid merge options", err.Error())
+		return
+	}
+
+	// Количество токенов результата и каждого файла
+	totalTokens := 0
+	for _, part := range parts {
+		totalTokens += h.fileService.CountTokens(part)
+	}
+	filesTokens := 0
+	for _, file := range filesContent {
+		filesTokens += file.TokenCount
+	}
+	w.Header().Set(HeaderTokenCount, strconv.Itoa(totalTokens))
+	w.Header().Set(HeaderFilesTokenCount, strconv.Itoa(filesTokens))
+	w.Header().Set(HeaderFileTokenCounts, fileTokenCounts(filesContent))
+	w.Header().Set(HeaderPartCount, strconv.Itoa(len(parts)))
+
+	// Результат уложился в одну часть: отдаем файл как есть
+	if len(parts) == 1 {
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", request.OutputFilename))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(parts[0]))
+		return
+	}
+
+	if request.SplitFormat == splitMultipart {
+		h.writeMultipart(w, request.OutputFilename, format, parts)
+		return
+	}
+	h.writeZip(w, request.OutputFilename, parts)
+}
+
+// fileTokenCounts формирует значение заголовка X-File-Token-Counts. Файлы, не уместившиеся
+// в maxFileTokenCountsLen, не выводятся, а список завершается элементом "...";
+// количество токенов всех файлов возвращает GET /api/files.
+func fileTokenCounts(files []service.FileContent) string {
+	const truncated = ", ..."
 
-	// Устанавливаем заголовки для скачивания файла
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", request.OutputFilename))
+	var b strings.Builder
+	for i, file := range files {
+		entry := fmt.Sprintf("%s=%d", file.ID, file.TokenCount)
+		if i > 0 {
+			entry = ", " + entry
+		}
+		// Место под признак усечения оставляется, пока за записью следуют другие файлы
+		reserve := 0
+		if i < len(files)-1 {
+			reserve = len(truncated)
+		}
+		if b.Len()+len(entry)+reserve > maxFileTokenCountsLen {
+			if i == 0 {
+				return "..."
+			}
+			b.WriteString(truncated)
+			break
+		}
+		b.WriteString(entry)
+	}
+	return b.String()
+}
+
+// writeZip отправляет части объединенного файла ZIP-архивом
+func (h *MergeHandler) writeZip(w http.ResponseWriter, filename string, parts []string) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for i, part := range parts {
+		fw, err := zw.Create(service.PartFilename(filename, i, len(parts)))
+		if err != nil {
+			sendError(w, http.StatusInternalServerError, "failed to create archive", err.Error())
+			return
+		}
+		fw.Write([]byte(part))
+	}
+	if err := zw.Close(); err != nil {
+		sendError(w, http.StatusInternalServerError, "failed to create archive", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", strings.TrimSuffix(filename, path.Ext(filename))))
 	w.WriteHeader(http.StatusOK)
+	w.Write(archive.Bytes())
+}
+
+// writeMultipart отправляет части объединенного файла ответом multipart/mixed
+func (h *MergeHandler) writeMultipart(w http.ResponseWriter, filename string, format service.MergeFormat, parts []string) {
+	mw := multipart.NewWriter(w)
 
-	// Отправляем результат
-	w.Write([]byte(result))
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	w.WriteHeader(http.StatusOK)
+
+	for i, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", format.ContentType())
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", service.PartFilename(filename, i, len(parts))))
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return
+		}
+		pw.Write([]byte(part))
+	}
+	mw.Close()
 }
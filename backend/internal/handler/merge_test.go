@@ -0,0 +1,160 @@
+// Package handler содержит тесты заголовков ответа объединения файлов
+// и количества токенов загруженных и объединенных файлов.
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/service"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// testTokenFiles возвращает n файлов с ID file_<номер> и количеством токенов 100
+func testTokenFiles(n int) []service.FileContent {
+	files := make([]service.FileContent, n)
+	for i := range files {
+		files[i] = service.FileContent{ID: fmt.Sprintf("file_%d", i), TokenCount: 100}
+	}
+	return files
+}
+
+func TestFileTokenCounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     []service.FileContent
+		want      string
+		truncated bool
+	}{
+		{name: "all files fit", files: testTokenFiles(2), want: "file_0=100, file_1=100"},
+		{name: "many files", files: testTokenFiles(10000), truncated: true},
+		{name: "long id", files: []service.FileContent{{ID: strings.Repeat("x", maxFileTokenCountsLen), TokenCount: 1}}, want: "..."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fileTokenCounts(tt.files)
+			if len(got) > maxFileTokenCountsLen {
+				t.Fatalf("len(fileTokenCounts()) = %d, want at most %d", len(got), maxFileTokenCountsLen)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Fatalf("fileTokenCounts() = %q, want %q", got, tt.want)
+			}
+			if !tt.truncated {
+				return
+			}
+
+			// Усеченный список содержит первые файлы целиком и завершается "..."
+			entries := strings.Split(got, ", ")
+			if entries[len(entries)-1] != "..." {
+				t.Fatalf("fileTokenCounts() = ...%q, want a trailing \"...\"", got[len(got)-20:])
+			}
+			for i, entry := range entries[:len(entries)-1] {
+				if want := fmt.Sprintf("file_%d=100", i); entry != want {
+					t.Fatalf("entry %d = %q, want %q", i, entry, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenCounts(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	fileService := service.NewFileService(cfg, storage.NewMemoryStorage())
+	workspace, err := fileService.CreateWorkspace()
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	workspaceID, _ := fileService.WorkspaceID(workspace.Token)
+
+	files := []testUpload{
+		{name: "cmd/main.go", content: "package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"},
+		{name: "docs/README.md", content: "# Привет, мир\n\n" + strings.Repeat("Строка документации.\n", 20)},
+	}
+
+	// Ответ загрузки содержит количество токенов каждого файла и их сумму
+	body, contentType := buildUploadBody(t, files)
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(HeaderWorkspaceToken, workspace.Token)
+	rec := httptest.NewRecorder()
+	NewUploadHandler(cfg, fileService).HandleUpload(rec, req)
+
+	var upload UploadResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &upload); err != nil || len(upload.Files) != len(files) {
+		t.Fatalf("invalid upload response %d: %s", rec.Code, rec.Body.String())
+	}
+	filesTokens := 0
+	for i, file := range upload.Files {
+		if want := fileService.CountTokens(files[i].content); file.TokenCount != want || want == 0 {
+			t.Fatalf("%s token count = %d, want %d", file.Path, file.TokenCount, want)
+		}
+		filesTokens += file.TokenCount
+	}
+	if upload.TotalTokens != filesTokens {
+		t.Fatalf("total tokens = %d, want %d", upload.TotalTokens, filesTokens)
+	}
+	wantFileCounts := fmt.Sprintf("%s=%d, %s=%d", upload.FileIDs[0], upload.Files[0].TokenCount, upload.FileIDs[1], upload.Files[1].TokenCount)
+
+	tests := []struct {
+		name      string
+		maxTokens int
+		split     bool // Результат разбивается на несколько частей
+	}{
+		{name: "single part"},
+		{name: "split into parts", maxTokens: 60, split: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, _ := json.Marshal(MergeRequest{FileIDs: upload.FileIDs, OutputFilename: "merged.txt", MaxTokens: tt.maxTokens})
+			req := httptest.NewRequest(http.MethodPost, "/api/merge", bytes.NewReader(request))
+			req.Header.Set(HeaderWorkspaceToken, workspace.Token)
+			rec := httptest.NewRecorder()
+			NewMergeHandler(fileService).HandleMerge(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+			}
+
+			// Количество токенов результата - сумма по частям, включая заголовки файлов
+			files, err := fileService.GetFiles(workspaceID, upload.FileIDs, nil)
+			if err != nil {
+				t.Fatalf("GetFiles() error = %v", err)
+			}
+			parts, err := fileService.MergeParts(files, service.MergeOptions{}, service.MergeLimits{MaxTokens: tt.maxTokens})
+			if err != nil {
+				t.Fatalf("MergeParts() error = %v", err)
+			}
+			if got := rec.Header().Get(HeaderPartCount); got != strconv.Itoa(len(parts)) || (len(parts) > 1) != tt.split {
+				t.Fatalf("%s = %s, want %d", HeaderPartCount, got, len(parts))
+			}
+			wantTokens := 0
+			for _, part := range parts {
+				wantTokens += fileService.CountTokens(part)
+			}
+			if !tt.split && rec.Body.String() != parts[0] {
+				t.Fatalf("response body differs from the merged output")
+			}
+			if got := rec.Header().Get(HeaderTokenCount); got != strconv.Itoa(wantTokens) || wantTokens <= filesTokens {
+				t.Fatalf("%s = %s, want %d (more than %d tokens of the files)", HeaderTokenCount, got, wantTokens, filesTokens)
+			}
+			if got := rec.Header().Get(HeaderFilesTokenCount); got != strconv.Itoa(filesTokens) {
+				t.Fatalf("%s = %s, want %d", HeaderFilesTokenCount, got, filesTokens)
+			}
+			if got := rec.Header().Get(HeaderFileTokenCounts); got != wantFileCounts {
+				t.Fatalf("%s = %q, want %q", HeaderFileTokenCounts, got, wantFileCounts)
+			}
+		})
+	}
+}
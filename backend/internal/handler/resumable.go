@@ -0,0 +1,292 @@
+// Package handler предоставляет HTTP-обработчики для API-endpoints.
+// Содержит обработчики возобновляемой загрузки файлов по частям (в стиле протокола tus).
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/MindlessMuse666/code-merger/internal/service"
+	"github.com/go-chi/chi/v5"
+)
+
+// Заголовки возобновляемой загрузки
+const (
+	HeaderTusResumable   = "Tus-Resumable"   // Версия протокола tus
+	HeaderUploadLength   = "Upload-Length"   // Полный размер файла в байтах
+	HeaderUploadOffset   = "Upload-Offset"   // Количество полученных байтов (смещение части)
+	HeaderUploadMetadata = "Upload-Metadata" // Метаданные загрузки: "filename <base64>"
+	HeaderUploadExpires  = "Upload-Expires"  // Время удаления загрузки без активности
+)
+
+// tusVersion версия протокола tus, которой следуют endpoints загрузки
+const tusVersion = "1.0.0"
+
+// offsetContentType тип содержимого запроса с частью данных загрузки
+const offsetContentType = "application/offset+octet-stream"
+
+// ResumableHandler обрабатывает возобновляемые загрузки
+type ResumableHandler struct {
+	fileService *service.FileService
+}
+
+// NewResumableHandler создает новый экземпляр ResumableHandler
+func NewResumableHandler(fileService *service.FileService) *ResumableHandler {
+	return &ResumableHandler{
+		fileService: fileService,
+	}
+}
+
+// CreateUpload создает возобновляемую загрузку
+// @Summary Создание возобновляемой загрузки
+// @Description Создает загрузку файла, данные которого передаются частями запросами PATCH. Имя файла (может содержать относительный путь) передается в Upload-Metadata в формате tus: "filename <base64>". Имя и размер проверяются сразу: неподдерживаемые файлы отклоняются до передачи данных.
+// @Tags Uploads
+// @Produce json
+// @Param X-Workspace-Token header string true "Токен рабочего пространства (POST /api/workspaces)"
+// @Param Upload-Length header integer true "Полный размер файла в байтах"
+// @Param Upload-Metadata header string true "Метаданные загрузки: filename <base64>"
+// @Success 201 {object} service.ResumableUpload
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 507 {object} ErrorResponse
+// @Router /api/uploads [post]
+func (h *ResumableHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderTusResumable, tusVersion)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get(HeaderUploadLength), 10, 64)
+	if err != nil || length < 0 {
+		sendError(w, http.StatusBadRequest, "invalid upload length",
+			fmt.Sprintf("header %s must be a non-negative integer", HeaderUploadLength))
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get(HeaderUploadMetadata))
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "invalid upload metadata", err.Error())
+		return
+	}
+	if metadata["filename"] == "" {
+		sendError(w, http.StatusBadRequest, "missing filename",
+			fmt.Sprintf("header %s must contain filename", HeaderUploadMetadata))
+		return
+	}
+
+	upload, err := h.fileService.CreateUpload(workspace, metadata["filename"], length)
+	if err != nil {
+		sendError(w, rejectionStatus(rejectionReason(err)), "upload rejected", err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/api/uploads/"+upload.ID)
+	setUploadHeaders(w, upload)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// GetUploadOffset возвращает состояние возобновляемой загрузки
+// @Summary Состояние возобновляемой загрузки
+// @Description Возвращает в заголовке Upload-Offset количество полученных байтов, с которого нужно продолжить загрузку
+// @Tags Uploads
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param uploadId path string true "Идентификатор загрузки"
+// @Success 200
+// @Failure 401
+// @Failure 404
+// @Router /api/uploads/{uploadId} [head]
+func (h *ResumableHandler) GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderTusResumable, tusVersion)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	upload, err := h.fileService.GetUpload(workspace, chi.URLParam(r, "uploadId"))
+	if err != nil {
+		sendUploadError(w, err)
+		return
+	}
+
+	setUploadHeaders(w, upload)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// AppendUpload принимает часть данных возобновляемой загрузки
+// @Summary Передача части данных
+// @Description Дописывает тело запроса к загрузке. Upload-Offset должен совпадать с количеством уже полученных байтов (HEAD /api/uploads/{uploadId}). Если соединение оборвалось, полученные данные сохраняются, и загрузку можно продолжить с нового смещения.
+// @Tags Uploads
+// @Accept application/offset+octet-stream
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param uploadId path string true "Идентификатор загрузки"
+// @Param Upload-Offset header integer true "Смещение части от начала файла"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 413 {object} ErrorResponse
+// @Failure 415 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Failure 507 {object} ErrorResponse
+// @Router /api/uploads/{uploadId} [patch]
+func (h *ResumableHandler) AppendUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderTusResumable, tusVersion)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != offsetContentType {
+		sendError(w, http.StatusUnsupportedMediaType, "unsupported content type",
+			fmt.Sprintf("content type must be %s", offsetContentType))
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get(HeaderUploadOffset), 10, 64)
+	if err != nil || offset < 0 {
+		sendError(w, http.StatusBadRequest, "invalid upload offset",
+			fmt.Sprintf("header %s must be a non-negative integer", HeaderUploadOffset))
+		return
+	}
+
+	upload, err := h.fileService.AppendUpload(workspace, chi.URLParam(r, "uploadId"), offset, r.Body)
+	if err != nil {
+		if upload.ID != "" {
+			w.Header().Set(HeaderUploadOffset, strconv.FormatInt(upload.Offset, 10))
+		}
+		sendUploadError(w, err)
+		return
+	}
+
+	setUploadHeaders(w, upload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FinalizeUpload завершает возобновляемую загрузку
+// @Summary Завершение возобновляемой загрузки
+// @Description Собирает полученные части и обрабатывает файл так же, как POST /api/upload: архивы распаковываются, файлы проверяются и конвертируются в UTF-8. Загрузка удаляется после обработки, в том числе при отказе.
+// @Tags Uploads
+// @Produce json
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param uploadId path string true "Идентификатор загрузки"
+// @Success 200 {object} UploadResponse
+// @Failure 400 {object} UploadRejectedResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 413 {object} UploadRejectedResponse
+// @Failure 415 {object} UploadRejectedResponse
+// @Failure 429 {object} UploadRejectedResponse
+// @Failure 500 {object} UploadRejectedResponse
+// @Failure 507 {object} UploadRejectedResponse
+// @Router /api/uploads/{uploadId}/finalize [post]
+func (h *ResumableHandler) FinalizeUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderTusResumable, tusVersion)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	upload, files, skipped, err := h.fileService.FinalizeUpload(workspace, chi.URLParam(r, "uploadId"))
+	if errors.Is(err, service.ErrUploadNotFound) || errors.Is(err, service.ErrUploadIncomplete) {
+		if errors.Is(err, service.ErrUploadIncomplete) {
+			setUploadHeaders(w, upload)
+		}
+		sendUploadError(w, err)
+		return
+	}
+
+	archive := ""
+	if h.fileService.IsArchive(upload.Name) {
+		archive = upload.Name
+	}
+
+	batch := &uploadBatch{}
+	if err != nil {
+		batch.reject(UploadResult{Name: upload.Name, Reason: rejectionReason(err), Details: err.Error()})
+	}
+	for _, file := range files {
+		batch.accept(file, archive)
+	}
+	for _, entry := range skipped {
+		batch.skip(entry, archive)
+	}
+	sendUploadResults(w, batch)
+}
+
+// DeleteUpload прерывает возобновляемую загрузку
+// @Summary Прерывание возобновляемой загрузки
+// @Description Удаляет загрузку и полученные данные
+// @Tags Uploads
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Param uploadId path string true "Идентификатор загрузки"
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/uploads/{uploadId} [delete]
+func (h *ResumableHandler) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(HeaderTusResumable, tusVersion)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	if err := h.fileService.DeleteUpload(workspace, chi.URLParam(r, "uploadId")); err != nil {
+		sendUploadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setUploadHeaders устанавливает заголовки состояния загрузки
+func setUploadHeaders(w http.ResponseWriter, upload service.ResumableUpload) {
+	w.Header().Set(HeaderUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set(HeaderUploadLength, strconv.FormatInt(upload.Length, 10))
+	w.Header().Set(HeaderUploadExpires, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// sendUploadError отправляет ошибку операции с возобновляемой загрузкой
+func sendUploadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrUploadNotFound):
+		sendError(w, http.StatusNotFound, "upload not found", err.Error())
+	case errors.Is(err, service.ErrUploadOffset):
+		sendError(w, http.StatusConflict, "upload offset mismatch", err.Error())
+	case errors.Is(err, service.ErrUploadIncomplete):
+		sendError(w, http.StatusConflict, "upload is incomplete", err.Error())
+	default:
+		sendError(w, rejectionStatus(rejectionReason(err)), "failed to append upload chunk", err.Error())
+	}
+}
+
+// parseUploadMetadata разбирает заголовок Upload-Metadata: пары "ключ base64",
+// разделенные запятыми. Значение может отсутствовать.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of %s: %v", key, err)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
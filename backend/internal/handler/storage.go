@@ -0,0 +1,37 @@
+// Package handler предоставляет HTTP-обработчики для API-endpoints.
+// Содержит логику получения статистики хранилища.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MindlessMuse666/code-merger/internal/service"
+)
+
+// StorageHandler обрабатывает запросы о состоянии хранилища
+type StorageHandler struct {
+	fileService *service.FileService
+}
+
+// NewStorageHandler создает новый экземпляр StorageHandler
+func NewStorageHandler(fileService *service.FileService) *StorageHandler {
+	return &StorageHandler{
+		fileService: fileService,
+	}
+}
+
+// GetStats возвращает статистику хранилища
+// @Summary Статистика хранилища
+// @Description Возвращает статистику хранилища: количество и объем файлов, время загрузки самого старого файла, лимиты, счетчики вытеснения и степень сжатия. Требует заголовок Authorization: Bearer <ADMIN_TOKEN>
+// @Tags Admin
+// @Produce json
+// @Param Authorization header string true "Bearer <ADMIN_TOKEN>"
+// @Success 200 {object} storage.Stats
+// @Failure 401 {object} ErrorResponse
+// @Router /api/admin/storage/stats [get]
+func (h *StorageHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(h.fileService.StorageStats())
+}
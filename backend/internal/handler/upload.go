@@ -4,10 +4,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 
 	"github.com/MindlessMuse666/code-merger/internal/config"
 	"github.com/MindlessMuse666/code-merger/internal/service"
@@ -19,10 +21,39 @@ type UploadHandler struct {
 	fileService *service.FileService
 }
 
+// Статусы результата обработки загруженного файла
+const (
+	UploadStatusAccepted   = "accepted"    // Файл сохранен
+	UploadStatusRejected   = "rejected"    // Файл отклонен
+	UploadStatusRolledBack = "rolled_back" // Файл был сохранен, но удален при откате строгой загрузки
+	UploadStatusIgnored    = "ignored"     // Файл исключен правилом .gitignore или .codemergerignore
+)
+
+// UploadResult представляет результат обработки одного файла или элемента архива
+type UploadResult struct {
+	Name    string `json:"name"`              // Имя (относительный путь) файла, пустое для ошибок запроса целиком
+	Archive string `json:"archive,omitempty"` // Архив, из которого извлечен файл
+	Status  string `json:"status"`            // accepted, rejected, rolled_back или ignored
+	ID      string `json:"id,omitempty"`      // Идентификатор принятого файла
+	Reason  string `json:"reason,omitempty"`  // Код причины отказа (file_too_large, unsupported_type и т.д.)
+	Details string `json:"details,omitempty"` // Описание причины отказа
+	Rule    string `json:"rule,omitempty"`    // Правило исключения (<файл>:<строка>:<правило>) для статуса ignored
+}
+
 // UploadResponse представляет успешный ответ на загрузку файлов
 type UploadResponse struct {
-	Message string   `json:"message"`  // Сообщение о результате операции
-	FileIDs []string `json:"file_ids"` // Массив идентификаторов загруженных файлов
+	Message     string                 `json:"message"`      // Сообщение о результате операции
+	FileIDs     []string               `json:"file_ids"`     // Массив идентификаторов загруженных файлов
+	Files       []service.UploadedFile `json:"files"`        // Сведения о загруженных файлах, включая количество токенов
+	TotalTokens int                    `json:"total_tokens"` // Суммарное количество токенов загруженных файлов
+	Results     []UploadResult         `json:"results"`      // Результаты обработки каждого файла и элемента архивов
+}
+
+// UploadRejectedResponse представляет ответ, когда ни один файл не принят
+// или строгая загрузка отменена
+type UploadRejectedResponse struct {
+	ErrorResponse
+	Results []UploadResult `json:"results"` // Результаты обработки файлов
 }
 
 // NewUploadHandler создает новый экземпляр UploadHandler
@@ -35,95 +66,290 @@ func NewUploadHandler(cfg *config.Config, fileService *service.FileService) *Upl
 
 // HandleUpload обрабатывает запрос на загрузку файлов
 // @Summary Загрузка файлов для обработки
-// @Description Принимает один или несколько файлов для последующего объединения. Проверяет расширения и размер файлов.
+// @Description Эндпоинт принимает один или несколько текстовых файлов поддерживаемых форматов, а также архивы .zip, .tar и .tar.gz, которые распаковываются на сервере. Файлы временно сохраняются на сервере (в хранилище, выбранном STORAGE_BACKEND) для последующего объединения. Каждый файл обрабатывается отдельно: в results возвращается идентификатор принятого файла или код причины отказа. Элементы архивов, исключенные правилами .gitignore и .codemergerignore архива, возвращаются со статусом ignored и не считаются отказом. В строгом режиме (strict=true) первый отказ отменяет загрузку, а уже сохраненные файлы удаляются.
 // @Tags Files
-// @Summary Загрузка файлов для обработки
-// @Description Эндпоинт принимает один или несколько текстовых файлов поддерживаемых форматов. Файлы временно сохраняются на сервере (в памяти) для последующего объединения. Возвращает уникальные идентификаторы файлов.
 // @Accept multipart/form-data
 // @Produce json
-// @Param files formData file true "Массив файлов для загрузки. Можно выбрать несколько файлов, удерживая Ctrl (Cmd на Mac) при выборе в диалоговом окне." collectionFormat="multi"
+// @Param X-Workspace-Token header string true "Токен рабочего пространства (POST /api/workspaces)"
+// @Param strict query boolean false "Строгий режим: все файлы или ни одного"
+// @Param files formData file true "Массив файлов для загрузки. Можно выбрать несколько файлов, удерживая Ctrl (Cmd на Mac) при выборе в диалоговом окне. Имя файла может содержать относительный путь (например, cmd/server/main.go)." collectionFormat="multi"
 // @Success 200 {object} UploadResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 413 {object} ErrorResponse
-// @Failure 415 {object} ErrorResponse
+// @Failure 400 {object} UploadRejectedResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 413 {object} UploadRejectedResponse
+// @Failure 415 {object} UploadRejectedResponse
+// @Failure 429 {object} UploadRejectedResponse
+// @Failure 500 {object} UploadRejectedResponse
+// @Failure 507 {object} UploadRejectedResponse
 // @Router /api/upload [post]
 func (h *UploadHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
-	// Лимит для всего запроса
-	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxTotalSize)
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
 
-	if err := r.ParseMultipartForm(h.cfg.MaxTotalSize); err != nil {
-		if err.Error() == "http: request body too large" {
-			sendError(w, http.StatusRequestEntityTooLarge, "request too large", "total request size exceeds limit")
-		} else {
-			sendError(w, http.StatusBadRequest, "failed to parse multipart form", err.Error())
+	strict := false
+	if value := r.URL.Query().Get("strict"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			sendError(w, http.StatusBadRequest, "invalid strict parameter", err.Error())
+			return
 		}
-		return
+		strict = parsed
 	}
 
-	files := r.MultipartForm.File["files"]
-	if len(files) == 0 {
-		sendError(w, http.StatusBadRequest, "no files provided", "please provide at least one file")
+	// Лимит для всего запроса
+	r.Body = http.MaxBytesReader(w, r.Body, h.cfg.MaxTotalSize)
+
+	// Части запроса читаются по очереди, без буферизации всей формы
+	reader, err := r.MultipartReader()
+	if err != nil {
+		sendError(w, http.StatusBadRequest, "failed to parse multipart form", err.Error())
 		return
 	}
 
-	var fileIDs []string
-	totalSize := int64(0)
-
-	for _, fileHeader := range files {
-		// Валидация: размер файла
-		if fileHeader.Size > h.cfg.MaxFileSize {
-			sendError(w, http.StatusRequestEntityTooLarge, "file too large",
-				fmt.Sprintf("file %s exceeds maximum size limit of %d bytes",
-					fileHeader.Filename, h.cfg.MaxFileSize))
-			return
+	batch := &uploadBatch{archives: h.fileService.NewArchiveBudget(), content: h.fileService.NewWorkspaceContent()}
+	for {
+		if strict && batch.rejected != nil {
+			break
 		}
 
-		totalSize += fileHeader.Size
-		if totalSize > h.cfg.MaxTotalSize {
-			sendError(w, http.StatusRequestEntityTooLarge, "total size exceeded",
-				fmt.Sprintf("total size of all files exceeds limit of %d bytes", h.cfg.MaxTotalSize))
-			return
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if len(batch.results) == 0 {
+				sendMultipartError(w, err)
+				return
+			}
+			// Оставшиеся файлы не обработаны (например, превышен лимит запроса).
+			// Если лимит оборвал чтение предыдущего файла, отказ уже указан для него.
+			if !batch.exceeded {
+				err = fmt.Errorf("%w: %w", service.ErrReadFailed, err)
+				batch.rejectError("", err)
+			}
+			break
 		}
 
-		// Валидация: расширения файла
-		if !isValidExtension(fileHeader.Filename) {
-			sendError(w, http.StatusUnsupportedMediaType, "unsupported file type",
-				fmt.Sprintf("file %s has unsupported extension", fileHeader.Filename))
-			return
+		if part.FormName() == "files" && part.FileName() != "" {
+			h.processPart(workspace, part, batch)
 		}
+		part.Close()
+	}
 
-		// Обработка файла
-		fileID, err := h.processFile(fileHeader)
-		if err != nil {
-			sendError(w, http.StatusInternalServerError, "failed to process file", err.Error())
-			return
+	if len(batch.results) == 0 {
+		sendError(w, http.StatusBadRequest, "no files provided", "please provide at least one file")
+		return
+	}
+
+	if batch.rejected != nil && strict {
+		// Строгий режим: загрузка отменяется целиком
+		fileIDs := make([]string, 0, len(batch.uploaded))
+		for _, file := range batch.uploaded {
+			fileIDs = append(fileIDs, file.ID)
+		}
+		h.fileService.DeleteFiles(workspace, fileIDs)
+		for i := range batch.results {
+			if batch.results[i].Status == UploadStatusAccepted {
+				batch.results[i].Status = UploadStatusRolledBack
+				batch.results[i].ID = ""
+			}
 		}
 
-		fileIDs = append(fileIDs, fileID)
+		sendUploadRejected(w, "upload rolled back", batch)
+		return
+	}
+	sendUploadResults(w, batch)
+}
+
+// uploadBatch накапливает результаты обработки файлов одного запроса загрузки
+type uploadBatch struct {
+	uploaded []service.UploadedFile
+	results  []UploadResult
+	rejected *UploadResult             // Первый отказ (определяет статус ответа, если ни один файл не принят)
+	ignored  int                       // Количество файлов, исключенных правилами
+	archives *service.ArchiveBudget    // Остаток лимитов распаковки, общий для всех архивов запроса
+	content  *service.WorkspaceContent // Содержимое рабочего пространства для флага Duplicate
+	exceeded bool                      // Чтение запроса оборвалось на лимите MaxTotalSize
+}
+
+// accept добавляет принятый файл
+func (b *uploadBatch) accept(file service.UploadedFile, archive string) {
+	name := file.Path
+	if name == "" {
+		name = file.Filename
+	}
+
+	b.uploaded = append(b.uploaded, file)
+	b.results = append(b.results, UploadResult{
+		Name:    name,
+		Archive: archive,
+		Status:  UploadStatusAccepted,
+		ID:      file.ID,
+	})
+}
+
+// reject добавляет отклоненный файл
+func (b *uploadBatch) reject(result UploadResult) {
+	result.Status = UploadStatusRejected
+	b.results = append(b.results, result)
+	if b.rejected == nil {
+		b.rejected = &result
+	}
+}
+
+// rejectError добавляет файл, отклоненный с ошибкой обработки err
+func (b *uploadBatch) rejectError(name string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.exceeded = true
+	}
+	b.reject(UploadResult{Name: name, Reason: rejectionReason(err), Details: err.Error()})
+}
+
+// skip добавляет пропущенный элемент архива или каталога. Файлы, исключенные
+// правилами, не считаются отказом и не отменяют строгую загрузку.
+func (b *uploadBatch) skip(entry service.SkippedEntry, archive string) {
+	result := UploadResult{Name: entry.Path, Archive: archive, Reason: entry.Code, Details: entry.Reason, Rule: entry.Rule}
+	if entry.Code != service.ReasonIgnored {
+		b.reject(result)
+		return
+	}
+	result.Status = UploadStatusIgnored
+	b.results = append(b.results, result)
+	b.ignored++
+}
+
+// sendUploadResults отправляет результаты обработки файлов: 200 OK, если принят
+// хотя бы один файл, иначе - статус, соответствующий первому отказу
+func sendUploadResults(w http.ResponseWriter, batch *uploadBatch) {
+	if len(batch.uploaded) == 0 {
+		sendUploadRejected(w, "no files accepted", batch)
+		return
+	}
+
+	fileIDs := make([]string, 0, len(batch.uploaded))
+	totalTokens := 0
+	for _, file := range batch.uploaded {
+		fileIDs = append(fileIDs, file.ID)
+		totalTokens += file.TokenCount
+	}
+
+	message := fmt.Sprintf("%d files uploaded successfully", len(fileIDs))
+	if rejected := len(batch.results) - len(fileIDs) - batch.ignored; rejected > 0 {
+		message = fmt.Sprintf("%s, %d rejected", message, rejected)
+	}
+	if batch.ignored > 0 {
+		message = fmt.Sprintf("%s, %d ignored", message, batch.ignored)
 	}
 
 	// Возврат успешного ответа
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(UploadResponse{
-		Message: fmt.Sprintf("%d files uploaded successfully", len(fileIDs)),
-		FileIDs: fileIDs,
+		Message:     message,
+		FileIDs:     fileIDs,
+		Files:       batch.uploaded,
+		TotalTokens: totalTokens,
+		Results:     batch.results,
 	})
 }
 
-// processFile обрабатывает загруженный файл
-func (h *UploadHandler) processFile(fileHeader *multipart.FileHeader) (string, error) {
-	file, err := fileHeader.Open()
-	if err != nil {
-		return "", fmt.Errorf("failed to open uploaded file: %v", err)
+// sendUploadRejected отправляет ответ с результатами обработки файлов
+// и статусом, соответствующим первому отказу
+func sendUploadRejected(w http.ResponseWriter, message string, batch *uploadBatch) {
+	first := batch.rejected
+	if first == nil {
+		// Все файлы исключены правилами
+		first = &UploadResult{Details: "all files are excluded by ignore rules"}
+	}
+	details := first.Details
+	if first.Name != "" {
+		details = fmt.Sprintf("%s: %s", first.Name, first.Details)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(rejectionStatus(first.Reason))
+	json.NewEncoder(w).Encode(UploadRejectedResponse{
+		ErrorResponse: ErrorResponse{
+			Error:   message,
+			Details: details,
+		},
+		Results: batch.results,
+	})
+}
+
+// rejectionStatus возвращает HTTP-статус для кода причины отказа
+func rejectionStatus(reason string) int {
+	switch reason {
+	case service.ReasonFileTooLarge, service.ReasonTotalSizeExceeded:
+		return http.StatusRequestEntityTooLarge
+	case service.ReasonUnsupportedType, service.ReasonBinaryContent:
+		return http.StatusUnsupportedMediaType
+	case service.ReasonQuotaExceeded:
+		return http.StatusTooManyRequests
+	case service.ReasonStorageFull:
+		return http.StatusInsufficientStorage
+	case service.ReasonStorageFailed:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// processPart обрабатывает часть multipart-запроса с файлом или архивом
+func (h *UploadHandler) processPart(workspace string, part *multipart.Part, batch *uploadBatch) {
+	name := uploadedFilePath(part)
+
+	// Архивы распаковываются из временного файла, лимиты проверяются для каждого извлеченного файла
+	if h.fileService.IsArchive(name) {
+		archiveFiles, skipped, err := h.fileService.ProcessArchiveReader(workspace, name, part, batch.archives, batch.content)
+		if err != nil {
+			batch.rejectError(name, err)
+			return
+		}
+		for _, file := range archiveFiles {
+			batch.accept(file, name)
+		}
+		for _, entry := range skipped {
+			batch.skip(entry, name)
+		}
+		return
+	}
+
+	// Валидация расширения до чтения содержимого
+	if !isValidExtension(name) {
+		batch.reject(UploadResult{Name: name, Reason: service.ReasonUnsupportedType,
+			Details: "file has unsupported extension"})
+		return
 	}
-	defer file.Close()
 
-	// Чтение содержимого файла для валидации кодировки
-	content, err := io.ReadAll(file)
+	// Содержимое читается из запроса с ограничением MaxFileSize и сразу сохраняется
+	file, err := h.fileService.ProcessReader(workspace, name, part, batch.content)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file content: %v", err)
+		batch.rejectError(name, err)
+		return
 	}
+	batch.accept(file, "")
+}
 
-	return h.fileService.ProcessFile(fileHeader.Filename, content)
+// rejectionReason возвращает код причины отказа по ошибке обработки файла.
+// Обрыв чтения на лимите MaxTotalSize означает превышение суммарного размера.
+func rejectionReason(err error) string {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return service.ReasonTotalSizeExceeded
+	}
+	return service.ReasonCode(err)
+}
+
+// sendMultipartError отправляет ошибку чтения multipart-запроса
+func sendMultipartError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		sendError(w, http.StatusRequestEntityTooLarge, "request too large", "total request size exceeds limit")
+		return
+	}
+	sendError(w, http.StatusBadRequest, "failed to parse multipart form", err.Error())
 }
@@ -0,0 +1,485 @@
+// Package handler содержит тесты результатов загрузки файлов, строгого режима
+// и относительных путей загруженных файлов, а также бенчмарк потребления памяти обработчиком загрузки. Запросы multipart/form-data
+// бенчмарка формируются заранее и передаются обработчику без сети, поэтому в замерах
+// учитывается только обработка запроса.
+//
+// Пример: go test -run '^$' -bench BenchmarkHandleUpload -benchmem ./internal/handler
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/service"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// heapMetric метрика объема памяти, занятой объектами кучи
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// testUpload описывает файл запроса загрузки в тестах
+type testUpload struct {
+	name    string
+	content string
+}
+
+func TestHandleUploadResults(t *testing.T) {
+	good := testUpload{name: "cmd/main.go", content: "package main\n"}
+	unsupported := testUpload{name: "tool.exe", content: "MZ"}
+	binary := testUpload{name: "data.txt", content: "text\x00with zero byte"}
+	other := testUpload{name: "util.py", content: "print(1)\n"}
+	archive := testUpload{name: "src.zip", content: buildZip(t, map[string]string{"a/lib.go": "package a\n", "a/tool.exe": "MZ"})}
+
+	tests := []struct {
+		name       string
+		query      string
+		files      []testUpload
+		maxTotal   int64 // Лимит размера запроса (0 - из конфигурации)
+		wantStatus int
+		want       []UploadResult // Ожидаемые результаты (ID проверяется только на наличие)
+		wantStored int
+	}{
+		{
+			name:       "partial success",
+			files:      []testUpload{good, unsupported, other},
+			wantStatus: http.StatusOK,
+			want: []UploadResult{
+				{Name: "cmd/main.go", Status: UploadStatusAccepted},
+				{Name: "tool.exe", Status: UploadStatusRejected, Reason: service.ReasonUnsupportedType},
+				{Name: "util.py", Status: UploadStatusAccepted},
+			},
+			wantStored: 2,
+		},
+		{
+			name:       "all rejected",
+			files:      []testUpload{unsupported, binary},
+			wantStatus: http.StatusUnsupportedMediaType,
+			want: []UploadResult{
+				{Name: "tool.exe", Status: UploadStatusRejected, Reason: service.ReasonUnsupportedType},
+				{Name: "data.txt", Status: UploadStatusRejected, Reason: service.ReasonBinaryContent},
+			},
+		},
+		{
+			name:       "strict rolls back accepted files",
+			query:      "?strict=true",
+			files:      []testUpload{good, other, binary, good},
+			wantStatus: http.StatusUnsupportedMediaType,
+			want: []UploadResult{
+				{Name: "cmd/main.go", Status: UploadStatusRolledBack},
+				{Name: "util.py", Status: UploadStatusRolledBack},
+				{Name: "data.txt", Status: UploadStatusRejected, Reason: service.ReasonBinaryContent},
+			},
+		},
+		{
+			name:       "strict rolls back archive entries",
+			query:      "?strict=true",
+			files:      []testUpload{good, archive},
+			wantStatus: http.StatusUnsupportedMediaType,
+			want: []UploadResult{
+				{Name: "cmd/main.go", Status: UploadStatusRolledBack},
+				{Name: "a/lib.go", Archive: "src.zip", Status: UploadStatusRolledBack},
+				{Name: "a/tool.exe", Archive: "src.zip", Status: UploadStatusRejected, Reason: service.ReasonUnsupportedType},
+			},
+		},
+		{
+			// Лимит запроса обрывает чтение файла: отказ указывается один раз
+			name:       "request size limit",
+			files:      []testUpload{good, {name: "big.go", content: strings.Repeat("x", 2000)}, other},
+			maxTotal:   1500,
+			wantStatus: http.StatusOK,
+			want: []UploadResult{
+				{Name: "cmd/main.go", Status: UploadStatusAccepted},
+				{Name: "big.go", Status: UploadStatusRejected, Reason: service.ReasonTotalSizeExceeded},
+			},
+			wantStored: 1,
+		},
+		{
+			name:       "strict without rejections",
+			query:      "?strict=true",
+			files:      []testUpload{good, other},
+			wantStatus: http.StatusOK,
+			want: []UploadResult{
+				{Name: "cmd/main.go", Status: UploadStatusAccepted},
+				{Name: "util.py", Status: UploadStatusAccepted},
+			},
+			wantStored: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("config.Load() error = %v", err)
+			}
+			if tt.maxTotal > 0 {
+				cfg.MaxTotalSize = tt.maxTotal
+			}
+			fileService := service.NewFileService(cfg, storage.NewMemoryStorage())
+			workspace, err := fileService.CreateWorkspace()
+			if err != nil {
+				t.Fatalf("CreateWorkspace() error = %v", err)
+			}
+
+			body, contentType := buildUploadBody(t, tt.files)
+			req := httptest.NewRequest(http.MethodPost, "/api/upload"+tt.query, bytes.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set(HeaderWorkspaceToken, workspace.Token)
+			rec := httptest.NewRecorder()
+
+			NewUploadHandler(cfg, fileService).HandleUpload(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			var resp struct {
+				FileIDs []string       `json:"file_ids"`
+				Results []UploadResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+
+			if len(resp.Results) != len(tt.want) {
+				t.Fatalf("results = %+v, want %d results", resp.Results, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := resp.Results[i]
+				if got.Name != want.Name || got.Archive != want.Archive || got.Status != want.Status || got.Reason != want.Reason {
+					t.Fatalf("result %d = %+v, want %+v", i, got, want)
+				}
+				if hasID := got.ID != ""; hasID != (want.Status == UploadStatusAccepted) {
+					t.Fatalf("result %d id = %q, want id only for accepted files", i, got.ID)
+				}
+			}
+
+			workspaceID, _ := fileService.WorkspaceID(workspace.Token)
+			stored, err := fileService.ListFiles(storage.ListFilter{SessionID: workspaceID})
+			if err != nil {
+				t.Fatalf("ListFiles() error = %v", err)
+			}
+			if len(stored) != tt.wantStored || len(resp.FileIDs) != tt.wantStored {
+				t.Fatalf("stored %d files, response lists %d, want %d", len(stored), len(resp.FileIDs), tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestUploadedFilePath(t *testing.T) {
+	tests := []struct {
+		name        string
+		disposition string // Заголовок Content-Disposition части запроса
+		wantName    string // Путь, извлеченный из заголовка
+		wantPath    string // Сохраненный путь ("" - файл отклоняется)
+	}{
+		{
+			name:        "file name",
+			disposition: `form-data; name="files"; filename="main.go"`,
+			wantName:    "main.go",
+			wantPath:    "main.go",
+		},
+		{
+			name:        "webkitRelativePath",
+			disposition: `form-data; name="files"; filename="project/cmd/main.go"`,
+			wantName:    "project/cmd/main.go",
+			wantPath:    "project/cmd/main.go",
+		},
+		{
+			name:        "escaped backslashes",
+			disposition: `form-data; name="files"; filename="project\\cmd\\main.go"`,
+			wantName:    `project\cmd\main.go`,
+			wantPath:    "project/cmd/main.go",
+		},
+		{
+			name:        "empty segments",
+			disposition: `form-data; name="files"; filename="project//cmd/./main.go"`,
+			wantName:    "project//cmd/./main.go",
+			wantPath:    "project/cmd/main.go",
+		},
+		{
+			name:        "extended filename parameter",
+			disposition: `form-data; name="files"; filename*=UTF-8''project%2F%D0%B4%D0%BE%D0%BA.md`,
+			wantName:    "project/док.md",
+			wantPath:    "project/док.md",
+		},
+		{
+			name:        "parent directory",
+			disposition: `form-data; name="files"; filename="../../etc/main.go"`,
+			wantName:    "../../etc/main.go",
+		},
+		{
+			name:        "parent directory with backslashes",
+			disposition: `form-data; name="files"; filename="project\\..\\..\\main.go"`,
+			wantName:    `project\..\..\main.go`,
+		},
+		{
+			name:        "absolute path",
+			disposition: `form-data; name="files"; filename="/etc/main.go"`,
+			wantName:    "/etc/main.go",
+		},
+		{
+			name:        "drive letter",
+			disposition: `form-data; name="files"; filename="C:\\project\\main.go"`,
+			wantName:    `C:\project\main.go`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Disposition": {tt.disposition}})
+			if err != nil {
+				t.Fatalf("CreatePart() error = %v", err)
+			}
+			part.Write([]byte("package main\n"))
+			writer.Close()
+
+			reader := multipart.NewReader(bytes.NewReader(body.Bytes()), writer.Boundary())
+			got, err := reader.NextPart()
+			if err != nil {
+				t.Fatalf("NextPart() error = %v", err)
+			}
+			if name := uploadedFilePath(got); name != tt.wantName {
+				t.Fatalf("uploadedFilePath() = %q, want %q", name, tt.wantName)
+			}
+
+			cfg, err := config.Load()
+			if err != nil {
+				t.Fatalf("config.Load() error = %v", err)
+			}
+			fileService := service.NewFileService(cfg, storage.NewMemoryStorage())
+			workspace, err := fileService.CreateWorkspace()
+			if err != nil {
+				t.Fatalf("CreateWorkspace() error = %v", err)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(body.Bytes()))
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set(HeaderWorkspaceToken, workspace.Token)
+			rec := httptest.NewRecorder()
+
+			NewUploadHandler(cfg, fileService).HandleUpload(rec, req)
+
+			var resp struct {
+				Results []UploadResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Results) != 1 {
+				t.Fatalf("invalid response %d: %s", rec.Code, rec.Body.String())
+			}
+			result := resp.Results[0]
+			if tt.wantPath == "" {
+				if result.Status != UploadStatusRejected || result.Reason != service.ReasonInvalidPath || result.Name != tt.wantName {
+					t.Fatalf("result = %+v, want %q rejected with %s", result, tt.wantName, service.ReasonInvalidPath)
+				}
+				return
+			}
+			if result.Status != UploadStatusAccepted || result.Name != tt.wantPath {
+				t.Fatalf("result = %+v, want %q accepted", result, tt.wantPath)
+			}
+		})
+	}
+}
+
+// buildZip формирует ZIP-архив с указанными файлами
+func buildZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, name := range names {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatalf("zip Create() error = %v", err)
+		}
+		entry.Write([]byte(files[name]))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("zip Close() error = %v", err)
+	}
+	return buf.String()
+}
+
+// buildUploadBody формирует тело multipart-запроса с указанными файлами
+func buildUploadBody(t *testing.T, files []testUpload) ([]byte, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := writer.CreateFormFile("files", file.name)
+		if err != nil {
+			t.Fatalf("CreateFormFile() error = %v", err)
+		}
+		part.Write([]byte(file.content))
+	}
+	writer.Close()
+	return body.Bytes(), writer.FormDataContentType()
+}
+
+func BenchmarkHandleUpload(b *testing.B) {
+	benchmarks := []struct {
+		files   int
+		size    int64
+		archive bool // Файлы передаются одним zip-архивом
+	}{
+		{files: 1, size: 1 << 20},
+		{files: 1, size: 10 << 20},
+		{files: 10, size: 1 << 20, archive: true},
+	}
+
+	for _, bm := range benchmarks {
+		name := fmt.Sprintf("%dx%dMB", bm.files, bm.size>>20)
+		if bm.archive {
+			name = "zip/" + name
+		}
+		b.Run(name, func(b *testing.B) {
+			cfg, err := config.Load()
+			if err != nil {
+				b.Fatalf("config.Load() error = %v", err)
+			}
+			// Лимиты с запасом на служебные данные multipart, чтобы запросы не отклонялись
+			cfg.MaxFileSize = bm.size
+			cfg.MaxTotalSize = int64(bm.files)*bm.size + 1<<20
+			cfg.MaxArchiveUnpacked = cfg.MaxTotalSize
+
+			fileService := service.NewFileService(cfg, storage.NewMemoryStorage())
+			uploadHandler := NewUploadHandler(cfg, fileService)
+			body, contentType := buildRequest(b, bm.files, bm.size, bm.archive)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			b.ResetTimer()
+
+			var peakTotal uint64
+			for range b.N {
+				b.StopTimer()
+				workspace, err := fileService.CreateWorkspace()
+				if err != nil {
+					b.Fatalf("CreateWorkspace() error = %v", err)
+				}
+				req := httptest.NewRequest(http.MethodPost, "/api/upload", bytes.NewReader(body))
+				req.Header.Set("Content-Type", contentType)
+				req.Header.Set(HeaderWorkspaceToken, workspace.Token)
+				rec := httptest.NewRecorder()
+				b.StartTimer()
+
+				peakTotal += measurePeakHeap(func() { uploadHandler.HandleUpload(rec, req) })
+
+				b.StopTimer()
+				if rec.Code != http.StatusOK {
+					b.Fatalf("HandleUpload() status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+				}
+				workspaceID, _ := fileService.WorkspaceID(workspace.Token)
+				if _, err := fileService.DeleteWorkspace(workspaceID); err != nil {
+					b.Fatalf("DeleteWorkspace() error = %v", err)
+				}
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(peakTotal)/float64(b.N), "peak-heap-B/op")
+		})
+	}
+}
+
+// measurePeakHeap выполняет fn и возвращает прирост пикового объема кучи
+// относительно состояния до вызова. Пиковый объем определяется опросом метрик
+// среды выполнения, поэтому является оценкой снизу.
+func measurePeakHeap(fn func()) uint64 {
+	runtime.GC()
+	baseline := heapObjects()
+
+	var peak atomic.Uint64
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(100 * time.Microsecond)
+		defer ticker.Stop()
+		for {
+			if current := heapObjects(); current > peak.Load() {
+				peak.Store(current)
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	fn()
+	close(done)
+	<-stopped
+
+	if peak.Load() <= baseline {
+		return 0
+	}
+	return peak.Load() - baseline
+}
+
+// heapObjects возвращает объем памяти, занятой объектами кучи
+func heapObjects() uint64 {
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
+
+// buildRequest формирует тело multipart-запроса с текстовыми файлами указанного размера
+func buildRequest(b *testing.B, files int, size int64, archive bool) ([]byte, string) {
+	b.Helper()
+
+	line := "func example() { return } // generated content for upload benchmark\n"
+	content := strings.Repeat(line, int(size)/len(line)+1)[:size]
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if archive {
+		// Элементы не сжимаются, поэтому размер запроса равен объему распакованных файлов
+		part, err := writer.CreateFormFile("files", "bench.zip")
+		if err != nil {
+			b.Fatalf("CreateFormFile() error = %v", err)
+		}
+		zw := zip.NewWriter(part)
+		for i := range files {
+			entry, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("bench/file_%d.go", i), Method: zip.Store})
+			if err != nil {
+				b.Fatalf("zip CreateHeader() error = %v", err)
+			}
+			entry.Write([]byte(content))
+		}
+		if err := zw.Close(); err != nil {
+			b.Fatalf("zip Close() error = %v", err)
+		}
+		writer.Close()
+		return body.Bytes(), writer.FormDataContentType()
+	}
+
+	for i := range files {
+		part, err := writer.CreateFormFile("files", fmt.Sprintf("bench/file_%d.go", i))
+		if err != nil {
+			b.Fatalf("CreateFormFile() error = %v", err)
+		}
+		part.Write([]byte(content))
+	}
+	writer.Close()
+	return body.Bytes(), writer.FormDataContentType()
+}
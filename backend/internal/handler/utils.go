@@ -3,13 +3,28 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strings"
 
+	"github.com/MindlessMuse666/code-merger/internal/service"
 	"github.com/MindlessMuse666/code-merger/internal/utils"
 )
 
+// Заголовки ответов с количеством токенов
+const (
+	HeaderTokenCount      = "X-Token-Count"       // Количество токенов содержимого ответа
+	HeaderFilesTokenCount = "X-Files-Token-Count" // Суммарное количество токенов объединяемых файлов
+	HeaderFileTokenCounts = "X-File-Token-Counts" // Количество токенов каждого файла: "file_1=120, file_2=45" (не длиннее 4 КБ)
+	HeaderPartCount       = "X-Part-Count"        // Количество частей объединенного файла
+)
+
+// HeaderWorkspaceToken заголовок запроса с токеном рабочего пространства
+const HeaderWorkspaceToken = "X-Workspace-Token"
+
 // ErrorResponse представляет структуру ошибки API
 type ErrorResponse struct {
 	Error   string `json:"error"`
@@ -36,3 +51,32 @@ func isValidExtension(filename string) bool {
 
 	return utils.SupportedExtensions[ext]
 }
+
+// uploadedFilePath возвращает относительный путь загруженного файла.
+// multipart.Part.FileName возвращает только базовое имя, поэтому путь
+// (например, webkitRelativePath при загрузке папки) извлекается из Content-Disposition.
+func uploadedFilePath(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil || params["filename"] == "" {
+		return part.FileName()
+	}
+	return params["filename"]
+}
+
+// workspaceID возвращает идентификатор рабочего пространства по токену из заголовка
+// X-Workspace-Token. При отсутствии или невалидном токене отправляет ошибку 401 и возвращает false.
+func workspaceID(w http.ResponseWriter, r *http.Request, fileService *service.FileService) (string, bool) {
+	token := r.Header.Get(HeaderWorkspaceToken)
+	if token == "" {
+		sendError(w, http.StatusUnauthorized, "missing workspace token",
+			fmt.Sprintf("header %s is required, create a workspace with POST /api/workspaces", HeaderWorkspaceToken))
+		return "", false
+	}
+
+	id, err := fileService.WorkspaceID(token)
+	if err != nil {
+		sendError(w, http.StatusUnauthorized, "invalid workspace token", err.Error())
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,74 @@
+// Package handler предоставляет HTTP-обработчики для API-endpoints.
+// Содержит логику создания и удаления рабочих пространств.
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/MindlessMuse666/code-merger/internal/service"
+)
+
+// WorkspaceHandler обрабатывает запросы к рабочим пространствам
+type WorkspaceHandler struct {
+	fileService *service.FileService
+}
+
+// DeleteWorkspaceResponse представляет результат удаления рабочего пространства
+type DeleteWorkspaceResponse struct {
+	Deleted int `json:"deleted"` // Количество удаленных файлов
+}
+
+// NewWorkspaceHandler создает новый экземпляр WorkspaceHandler
+func NewWorkspaceHandler(fileService *service.FileService) *WorkspaceHandler {
+	return &WorkspaceHandler{
+		fileService: fileService,
+	}
+}
+
+// CreateWorkspace создает рабочее пространство
+// @Summary Создание рабочего пространства
+// @Description Создает рабочее пространство и возвращает его токен. Токен передается в заголовке X-Workspace-Token при загрузке, объединении и получении файлов; файлы доступны только с токеном своего пространства.
+// @Tags Workspaces
+// @Produce json
+// @Success 201 {object} service.Workspace
+// @Failure 500 {object} ErrorResponse
+// @Router /api/workspaces [post]
+func (h *WorkspaceHandler) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, err := h.fileService.CreateWorkspace()
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "failed to create workspace", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// DeleteWorkspace удаляет рабочее пространство со всеми файлами
+// @Summary Удаление рабочего пространства
+// @Description Удаляет все файлы рабочего пространства, указанного токеном
+// @Tags Workspaces
+// @Produce json
+// @Param X-Workspace-Token header string true "Токен рабочего пространства"
+// @Success 200 {object} DeleteWorkspaceResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /api/workspaces [delete]
+func (h *WorkspaceHandler) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspace, ok := workspaceID(w, r, h.fileService)
+	if !ok {
+		return
+	}
+
+	deleted, err := h.fileService.DeleteWorkspace(workspace)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, "failed to delete workspace", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(DeleteWorkspaceResponse{Deleted: deleted})
+}
@@ -40,18 +40,24 @@ func NewServer(cfg *config.Config, storage storage.Storage, fileService *service
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   cfg.AllowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedOrigins: cfg.AllowedOrigins,
+		AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", handler.HeaderWorkspaceToken,
+			handler.HeaderTusResumable, handler.HeaderUploadLength, handler.HeaderUploadOffset, handler.HeaderUploadMetadata},
+		ExposedHeaders: []string{"Link", "Location", handler.HeaderTokenCount, handler.HeaderFilesTokenCount, handler.HeaderFileTokenCounts, handler.HeaderPartCount,
+			handler.HeaderTusResumable, handler.HeaderUploadLength, handler.HeaderUploadOffset, handler.HeaderUploadExpires},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	// Инициализация обработчиков
 	uploadHandler := handler.NewUploadHandler(cfg, fileService)
+	resumableHandler := handler.NewResumableHandler(fileService)
 	mergeHandler := handler.NewMergeHandler(fileService)
 	fileHandler := handler.NewFileHandler(fileService)
+	storageHandler := handler.NewStorageHandler(fileService)
+	adminHandler := handler.NewAdminHandler(fileService)
+	workspaceHandler := handler.NewWorkspaceHandler(fileService)
 
 	// Маршрут для Swagger UI
 	r.Mount("/swagger", httpSwagger.WrapHandler)
@@ -66,9 +72,31 @@ func NewServer(cfg *config.Config, storage storage.Storage, fileService *service
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"message": "code-merger API is running", "status": "OK"}`))
 	})
+	r.Post("/api/workspaces", workspaceHandler.CreateWorkspace)
+	r.Delete("/api/workspaces", workspaceHandler.DeleteWorkspace)
 	r.Post("/api/upload", uploadHandler.HandleUpload)
+	r.Post("/api/uploads", resumableHandler.CreateUpload)
+	r.Head("/api/uploads/{uploadId}", resumableHandler.GetUploadOffset)
+	r.Patch("/api/uploads/{uploadId}", resumableHandler.AppendUpload)
+	r.Post("/api/uploads/{uploadId}/finalize", resumableHandler.FinalizeUpload)
+	r.Delete("/api/uploads/{uploadId}", resumableHandler.DeleteUpload)
 	r.Post("/api/merge", mergeHandler.HandleMerge)
 	r.Get("/api/file/{fileId}", fileHandler.GetFileContent)
+	r.Post("/api/file/{fileId}/touch", fileHandler.TouchFile)
+	r.Get("/api/files", fileHandler.ListFiles)
+
+	// Административные маршруты регистрируются, только если задан токен
+	if cfg.AdminToken != "" {
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(handler.RequireAdminToken(cfg.AdminToken))
+			r.Get("/files", adminHandler.ListFiles)
+			r.Get("/storage/stats", storageHandler.GetStats)
+			// Загрузка с диска дополнительно требует список разрешенных каталогов
+			if len(cfg.IngestRoots) > 0 {
+				r.Post("/ingest", adminHandler.IngestDirectory)
+			}
+		})
+	}
 
 	return &Server{
 		cfg:         cfg,
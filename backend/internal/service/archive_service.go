@@ -0,0 +1,374 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит методы для распаковки архивов (zip, tar, tar.gz).
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/utils"
+)
+
+// errUnpackedLimit возвращается, когда объем распакованных данных превышает лимит
+var errUnpackedLimit = errors.New("archive exceeds unpacked size limit")
+
+// ArchiveService предоставляет методы для распаковки архивов
+type ArchiveService struct {
+	cfg               *config.Config
+	validationService *ValidationService
+}
+
+// ArchiveEntry представляет файл, извлеченный из архива
+type ArchiveEntry struct {
+	Path    string // Путь файла внутри архива
+	Content []byte // Содержимое файла
+}
+
+// SkippedEntry представляет пропущенный элемент архива
+type SkippedEntry struct {
+	Path   string `json:"path"`           // Путь элемента внутри архива
+	Code   string `json:"code"`           // Код причины пропуска (Reason*)
+	Reason string `json:"reason"`         // Описание причины пропуска
+	Rule   string `json:"rule,omitempty"` // Правило исключения (<файл>:<строка>:<правило>) для ReasonIgnored
+}
+
+// ArchiveBudget содержит остаток лимитов распаковки архивов одного запроса.
+// Лимиты расходуются всеми архивами запроса вместе, а не каждым архивом отдельно,
+// поэтому несколько архивов в одном запросе не умножают допустимый объем.
+type ArchiveBudget struct {
+	Entries  int   // Оставшееся количество элементов (MaxArchiveEntries)
+	Unpacked int64 // Оставшийся объем распакованного потока (MaxArchiveUnpacked)
+	Total    int64 // Оставшийся суммарный объем извлеченных файлов (MaxTotalSize)
+}
+
+// NewArchiveService создает новый экземпляр ArchiveService
+func NewArchiveService(cfg *config.Config, validationService *ValidationService) *ArchiveService {
+	return &ArchiveService{
+		cfg:               cfg,
+		validationService: validationService,
+	}
+}
+
+// NewBudget возвращает полные лимиты распаковки для нового запроса
+func (s *ArchiveService) NewBudget() *ArchiveBudget {
+	return &ArchiveBudget{
+		Entries:  s.cfg.MaxArchiveEntries,
+		Unpacked: s.cfg.MaxArchiveUnpacked,
+		Total:    s.cfg.MaxTotalSize,
+	}
+}
+
+// IsArchive проверяет, является ли файл поддерживаемым архивом
+func (s *ArchiveService) IsArchive(filename string) bool {
+	return archiveExtension(filename) != ""
+}
+
+// Walk распаковывает архив размером size и передает fn каждый извлеченный файл сразу после
+// чтения, поэтому в памяти находится содержимое только одного элемента. Возвращает пропущенные элементы.
+// Каждый элемент ограничен MaxFileSize; суммарный объем принятых файлов, объем
+// распакованных данных и количество элементов расходуют остаток лимитов запроса budget.
+// Элементы, исключенные правилами .gitignore и .codemergerignore архива, пропускаются
+// без чтения и не учитываются в лимитах; сами файлы правил не извлекаются.
+// При ошибке fn уже могла получить часть файлов архива.
+func (s *ArchiveService) Walk(filename string, r io.ReaderAt, size int64, budget *ArchiveBudget, fn func(ArchiveEntry)) ([]SkippedEntry, error) {
+	collector := s.newEntryCollector(budget, fn)
+
+	var err error
+	switch archiveExtension(filename) {
+	case ".zip":
+		err = s.extractZip(r, size, collector)
+	case ".tar", ".tar.gz", ".tgz":
+		err = s.extractTar(filename, r, size, collector)
+	default:
+		err = fmt.Errorf("unsupported archive type: %s", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return collector.skipped, nil
+}
+
+// extractZip распаковывает zip-архив
+func (s *ArchiveService) extractZip(r io.ReaderAt, size int64, collector *entryCollector) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %v", err)
+	}
+	budget := collector.budget
+
+	// Правила исключения читаются до извлечения файлов, к которым они применяются
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() || !isIgnoreFile(file.Name) {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			collector.skip(file.Name, ReasonReadFailed, fmt.Sprintf("failed to open entry: %v", err))
+			continue
+		}
+		collector.addIgnoreFile(file.Name, &limitedReader{r: rc, n: &budget.Unpacked})
+		rc.Close()
+	}
+
+	for _, file := range reader.File {
+		if collector.ignored(file.Name, file.FileInfo().IsDir()) || file.FileInfo().IsDir() {
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			collector.skip(file.Name, ReasonNotRegularFile, "not a regular file")
+			continue
+		}
+		if !collector.accept(file.Name, int64(file.UncompressedSize64)) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			collector.skip(file.Name, ReasonReadFailed, fmt.Sprintf("failed to open entry: %v", err))
+			continue
+		}
+		// Распакованные данные элементов zip расходуют тот же лимит, что и поток tar.gz
+		err = collector.read(file.Name, &limitedReader{r: rc, n: &budget.Unpacked})
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTar распаковывает tar-архив, в том числе сжатый gzip
+func (s *ArchiveService) extractTar(filename string, archive io.ReaderAt, size int64, collector *entryCollector) error {
+	budget := collector.budget
+
+	// Файлы правил исключения могут идти в потоке после файлов, к которым они применяются,
+	// поэтому архив читается дважды: сначала только файлы правил, затем остальные файлы.
+	// Поток одинаков при обоих чтениях, поэтому лимит распаковки расходует только второе.
+	unpacked := budget.Unpacked
+	err := s.walkTar(filename, io.NewSectionReader(archive, 0, size), &unpacked, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag == tar.TypeReg && isIgnoreFile(header.Name) {
+			collector.addIgnoreFile(header.Name, r)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.walkTar(filename, io.NewSectionReader(archive, 0, size), &budget.Unpacked, func(header *tar.Header, r io.Reader) error {
+		if collector.ignored(header.Name, header.Typeflag == tar.TypeDir) {
+			return nil
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return nil
+		case tar.TypeReg:
+		default:
+			collector.skip(header.Name, ReasonNotRegularFile, "not a regular file")
+			return nil
+		}
+		if !collector.accept(header.Name, header.Size) {
+			return nil
+		}
+		return collector.read(header.Name, r)
+	})
+}
+
+// walkTar вызывает fn для каждого элемента tar-архива, уменьшая остаток лимита
+// распакованного потока unpacked. Ошибка fn прерывает чтение.
+func (s *ArchiveService) walkTar(filename string, r io.Reader, unpacked *int64, fn func(header *tar.Header, r io.Reader) error) error {
+	if archiveExtension(filename) != ".tar" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip stream: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	// Ограничение объема распакованного потока защищает от gzip-бомб:
+	// пропущенные элементы все равно вычитываются из потока
+	limited := &limitedReader{r: r, n: unpacked}
+	reader := tar.NewReader(limited)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, errUnpackedLimit) {
+				return err
+			}
+			return fmt.Errorf("failed to read tar archive: %v", err)
+		}
+
+		if err := fn(header, reader); err != nil {
+			return err
+		}
+	}
+}
+
+// entryCollector накапливает извлеченные элементы архива с учетом лимитов
+type entryCollector struct {
+	cfg          *config.Config
+	validation   *ValidationService
+	budget       *ArchiveBudget     // Остаток лимитов запроса
+	emit         func(ArchiveEntry) // Получатель извлеченных файлов
+	skipped      []SkippedEntry
+	ignore       *ignoreMatcher
+	ignoredPaths map[string]bool // Исключенные пути, уже добавленные в пропущенные
+}
+
+// newEntryCollector создает новый entryCollector, расходующий лимиты budget
+// и передающий извлеченные файлы emit
+func (s *ArchiveService) newEntryCollector(budget *ArchiveBudget, emit func(ArchiveEntry)) *entryCollector {
+	return &entryCollector{
+		cfg:          s.cfg,
+		validation:   s.validationService,
+		budget:       budget,
+		emit:         emit,
+		ignore:       newIgnoreMatcher(),
+		ignoredPaths: make(map[string]bool),
+	}
+}
+
+// skip добавляет элемент в список пропущенных
+func (c *entryCollector) skip(name, code, reason string) {
+	c.skipped = append(c.skipped, SkippedEntry{Path: name, Code: code, Reason: reason})
+}
+
+// addIgnoreFile читает файл правил исключения из архива
+func (c *entryCollector) addIgnoreFile(name string, r io.Reader) {
+	entryPath, err := cleanRelativePath(name)
+	if err != nil {
+		return
+	}
+	content, err := io.ReadAll(io.LimitReader(r, c.cfg.MaxFileSize))
+	if err != nil {
+		if !errors.Is(err, errUnpackedLimit) {
+			c.skip(name, ReasonReadFailed, fmt.Sprintf("failed to read entry: %v", err))
+		}
+		return
+	}
+	c.ignore.add(entryPath, content)
+}
+
+// ignored проверяет, исключен ли элемент правилами или является файлом правил.
+// Исключенный каталог добавляется в пропущенные один раз, а не для каждого его элемента.
+func (c *entryCollector) ignored(name string, isDir bool) bool {
+	entryPath, err := cleanRelativePath(name)
+	if err != nil {
+		return false
+	}
+	if !isDir && isIgnoreFile(entryPath) {
+		return true
+	}
+
+	ignoredPath, rule, ok := c.ignore.match(entryPath, isDir)
+	if !ok {
+		return false
+	}
+	if ignoredPath != entryPath || isDir {
+		ignoredPath += "/"
+	}
+	if !c.ignoredPaths[ignoredPath] {
+		c.ignoredPaths[ignoredPath] = true
+		c.skipped = append(c.skipped, ignoredEntry(ignoredPath, rule))
+	}
+	return true
+}
+
+// accept проверяет элемент по пути, расширению, заявленному размеру и лимиту количества.
+// Отклоненный элемент не читается и не расходует лимит суммарного объема.
+func (c *entryCollector) accept(name string, size int64) bool {
+	if c.budget.Entries <= 0 {
+		c.skip(name, ReasonEntryLimitExceeded, fmt.Sprintf("archive entry limit of %d per request exceeded", c.cfg.MaxArchiveEntries))
+		return false
+	}
+	c.budget.Entries--
+	entryPath, err := cleanRelativePath(name)
+	if err != nil {
+		c.skip(name, ReasonInvalidPath, err.Error())
+		return false
+	}
+	if err := c.validation.ValidateName(path.Base(entryPath)); err != nil {
+		c.skip(name, ReasonUnsupportedType, err.Error())
+		return false
+	}
+	if size > c.cfg.MaxFileSize {
+		c.skip(name, ReasonFileTooLarge, fmt.Sprintf("entry exceeds maximum size limit of %d bytes", c.cfg.MaxFileSize))
+		return false
+	}
+	if size > c.budget.Total {
+		c.skip(name, ReasonTotalSizeExceeded, fmt.Sprintf("total size of extracted files exceeds limit of %d bytes", c.cfg.MaxTotalSize))
+		return false
+	}
+	return true
+}
+
+// read читает содержимое элемента, не доверяя заявленному в заголовке размеру
+func (c *entryCollector) read(name string, r io.Reader) error {
+	content, err := io.ReadAll(io.LimitReader(r, c.cfg.MaxFileSize+1))
+	if err != nil {
+		if errors.Is(err, errUnpackedLimit) {
+			return err
+		}
+		c.skip(name, ReasonReadFailed, fmt.Sprintf("failed to read entry: %v", err))
+		return nil
+	}
+
+	size := int64(len(content))
+	if size > c.cfg.MaxFileSize {
+		c.skip(name, ReasonFileTooLarge, fmt.Sprintf("entry exceeds maximum size limit of %d bytes", c.cfg.MaxFileSize))
+		return nil
+	}
+	if size > c.budget.Total {
+		c.skip(name, ReasonTotalSizeExceeded, fmt.Sprintf("total size of extracted files exceeds limit of %d bytes", c.cfg.MaxTotalSize))
+		return nil
+	}
+
+	entryPath, _ := cleanRelativePath(name)
+	c.budget.Total -= size
+	c.emit(ArchiveEntry{Path: entryPath, Content: content})
+	return nil
+}
+
+// limitedReader читает не более *n байт, уменьшая остаток *n,
+// и возвращает errUnpackedLimit при превышении
+type limitedReader struct {
+	r io.Reader
+	n *int64
+}
+
+// Read реализует io.Reader
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if *l.n <= 0 {
+		return 0, errUnpackedLimit
+	}
+	if int64(len(p)) > *l.n {
+		p = p[:*l.n]
+	}
+	n, err := l.r.Read(p)
+	*l.n -= int64(n)
+	return n, err
+}
+
+// archiveExtension возвращает расширение архива или пустую строку
+func archiveExtension(filename string) string {
+	lower := strings.ToLower(filename)
+	for _, ext := range utils.ArchiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
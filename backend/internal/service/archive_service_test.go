@@ -0,0 +1,375 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты распаковки архивов.
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// testEntry представляет элемент тестового архива
+type testEntry struct {
+	name    string
+	content string
+	link    bool // Символическая ссылка на content
+}
+
+// buildZip формирует zip-архив из элементов
+func buildZip(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.link {
+			header.SetMode(0o777 | 1<<27) // os.ModeSymlink
+		}
+		w, err := writer.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("CreateHeader(%s) error = %v", entry.name, err)
+		}
+		w.Write([]byte(entry.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// buildTarGz формирует tar.gz-архив из элементов
+func buildTarGz(t *testing.T, entries []testEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.link {
+			header = &tar.Header{Name: entry.name, Linkname: entry.content, Typeflag: tar.TypeSymlink}
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatalf("WriteHeader(%s) error = %v", entry.name, err)
+		}
+		if !entry.link {
+			writer.Write([]byte(entry.content))
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	gz.Close()
+	return buf.Bytes()
+}
+
+// newTestArchiveService создает ArchiveService с уменьшенными лимитами
+func newTestArchiveService(t *testing.T) *ArchiveService {
+	t.Helper()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	cfg.MaxFileSize = 1024
+	cfg.MaxTotalSize = 4096
+	cfg.MaxArchiveEntries = 5
+	cfg.MaxArchiveUnpacked = 64 * 1024
+	return NewArchiveService(cfg, NewValidationService())
+}
+
+// walk распаковывает архив content из памяти и собирает извлеченные файлы
+func walk(s *ArchiveService, name string, content []byte, budget *ArchiveBudget) ([]ArchiveEntry, []SkippedEntry, error) {
+	var entries []ArchiveEntry
+	skipped, err := s.Walk(name, bytes.NewReader(content), int64(len(content)), budget, func(entry ArchiveEntry) {
+		entries = append(entries, entry)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, skipped, nil
+}
+
+func TestArchiveWalkPaths(t *testing.T) {
+	tests := []struct {
+		name       string
+		entry      testEntry
+		wantPath   string // Путь извлеченного файла (пусто, если элемент пропущен)
+		wantReason string // Код причины пропуска
+	}{
+		{name: "nested path", entry: testEntry{name: "src/app/main.go", content: "package main"}, wantPath: "src/app/main.go"},
+		{name: "dot segments", entry: testEntry{name: "./src/./main.go", content: "package main"}, wantPath: "src/main.go"},
+		{name: "windows separators", entry: testEntry{name: "src\\main.go", content: "package main"}, wantPath: "src/main.go"},
+		{name: "parent traversal", entry: testEntry{name: "../evil.go", content: "x"}, wantReason: ReasonInvalidPath},
+		{name: "nested traversal", entry: testEntry{name: "src/../../evil.go", content: "x"}, wantReason: ReasonInvalidPath},
+		{name: "absolute path", entry: testEntry{name: "/etc/evil.go", content: "x"}, wantReason: ReasonInvalidPath},
+		{name: "windows drive", entry: testEntry{name: "C:/evil.go", content: "x"}, wantReason: ReasonInvalidPath},
+		{name: "symlink", entry: testEntry{name: "link.go", content: "/etc/passwd", link: true}, wantReason: ReasonNotRegularFile},
+	}
+
+	builders := map[string]func(*testing.T, []testEntry) []byte{
+		"a.zip":    buildZip,
+		"a.tar.gz": buildTarGz,
+	}
+	for _, tt := range tests {
+		for archiveName, build := range builders {
+			t.Run(tt.name+"/"+archiveName, func(t *testing.T) {
+				s := newTestArchiveService(t)
+				entries, skipped, err := walk(s, archiveName, build(t, []testEntry{tt.entry}), s.NewBudget())
+				if err != nil {
+					t.Fatalf("Walk() error = %v", err)
+				}
+
+				if tt.wantPath != "" {
+					if len(entries) != 1 || entries[0].Path != tt.wantPath || len(skipped) != 0 {
+						t.Fatalf("Walk() = %+v, skipped %+v, want %s", entries, skipped, tt.wantPath)
+					}
+					return
+				}
+				if len(entries) != 0 || len(skipped) != 1 || skipped[0].Code != tt.wantReason {
+					t.Fatalf("Walk() = %+v, skipped %+v, want skipped with %s", entries, skipped, tt.wantReason)
+				}
+			})
+		}
+	}
+}
+
+func TestArchiveWalkLimits(t *testing.T) {
+	small := strings.Repeat("a", 100)
+	large := strings.Repeat("b", 1025)
+
+	tests := []struct {
+		name        string
+		entries     []testEntry
+		wantEntries int
+		wantReasons []string
+	}{
+		{
+			name:        "file size",
+			entries:     []testEntry{{name: "large.go", content: large}, {name: "small.go", content: small}},
+			wantEntries: 1,
+			wantReasons: []string{ReasonFileTooLarge},
+		},
+		{
+			name: "total size",
+			entries: []testEntry{
+				{name: "1.go", content: strings.Repeat("1", 1000)},
+				{name: "2.go", content: strings.Repeat("2", 1000)},
+				{name: "3.go", content: strings.Repeat("3", 1000)},
+				{name: "4.go", content: strings.Repeat("4", 1000)},
+				{name: "5.go", content: strings.Repeat("5", 1000)},
+			},
+			wantEntries: 4,
+			wantReasons: []string{ReasonTotalSizeExceeded},
+		},
+		{
+			// Неподдерживаемый элемент не читается и не расходует лимит суммарного объема
+			name: "unsupported type",
+			entries: []testEntry{
+				{name: "image.png", content: strings.Repeat("p", 1000)},
+				{name: "1.go", content: strings.Repeat("1", 1000)},
+				{name: "2.go", content: strings.Repeat("2", 1000)},
+				{name: "3.go", content: strings.Repeat("3", 1000)},
+				{name: "4.go", content: strings.Repeat("4", 1000)},
+			},
+			wantEntries: 4,
+			wantReasons: []string{ReasonUnsupportedType},
+		},
+		{
+			name: "entry count",
+			entries: []testEntry{
+				{name: "1.go", content: "1"}, {name: "2.go", content: "2"}, {name: "3.go", content: "3"},
+				{name: "4.go", content: "4"}, {name: "5.go", content: "5"}, {name: "6.go", content: "6"},
+			},
+			wantEntries: 5,
+			wantReasons: []string{ReasonEntryLimitExceeded},
+		},
+	}
+
+	builders := map[string]func(*testing.T, []testEntry) []byte{
+		"a.zip":    buildZip,
+		"a.tar.gz": buildTarGz,
+	}
+	for _, tt := range tests {
+		for archiveName, build := range builders {
+			t.Run(tt.name+"/"+archiveName, func(t *testing.T) {
+				s := newTestArchiveService(t)
+				entries, skipped, err := walk(s, archiveName, build(t, tt.entries), s.NewBudget())
+				if err != nil {
+					t.Fatalf("Walk() error = %v", err)
+				}
+				if len(entries) != tt.wantEntries {
+					t.Fatalf("Walk() = %d entries, want %d", len(entries), tt.wantEntries)
+				}
+				reasons := make([]string, 0, len(skipped))
+				for _, entry := range skipped {
+					reasons = append(reasons, entry.Code)
+				}
+				if strings.Join(reasons, ",") != strings.Join(tt.wantReasons, ",") {
+					t.Fatalf("skipped reasons = %v, want %v", reasons, tt.wantReasons)
+				}
+			})
+		}
+	}
+}
+
+func TestArchiveWalkBomb(t *testing.T) {
+	// Элементы сжимаются в сотни раз, а распакованные данные превышают MaxArchiveUnpacked
+	var entries []testEntry
+	for i := range 4 {
+		entries = append(entries, testEntry{name: strings.Repeat("z", i+1) + ".go", content: strings.Repeat("\x00", 32*1024)})
+	}
+
+	builders := map[string]func(*testing.T, []testEntry) []byte{
+		"bomb.zip":    buildZip,
+		"bomb.tar.gz": buildTarGz,
+	}
+	for archiveName, build := range builders {
+		t.Run(archiveName, func(t *testing.T) {
+			s := newTestArchiveService(t)
+			s.cfg.MaxFileSize = 64 * 1024
+			s.cfg.MaxTotalSize = 1 << 20
+
+			content := build(t, entries)
+			if len(content) > 4096 {
+				t.Fatalf("archive is %d bytes, want a highly compressed archive", len(content))
+			}
+			if _, _, err := walk(s, archiveName, content, s.NewBudget()); !errors.Is(err, errUnpackedLimit) {
+				t.Fatalf("Walk() error = %v, want %v", err, errUnpackedLimit)
+			}
+		})
+	}
+}
+
+func TestArchiveBudgetIsSharedByRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []testEntry
+		// Количество файлов, извлеченных из первого и второго архива
+		wantFirst, wantSecond int
+	}{
+		{
+			name:      "entries",
+			entries:   []testEntry{{name: "1.go", content: "1"}, {name: "2.go", content: "2"}, {name: "3.go", content: "3"}},
+			wantFirst: 3, wantSecond: 2,
+		},
+		{
+			name:      "total size",
+			entries:   []testEntry{{name: "1.go", content: strings.Repeat("1", 1000)}, {name: "2.go", content: strings.Repeat("2", 1000)}, {name: "3.go", content: strings.Repeat("3", 1000)}},
+			wantFirst: 3, wantSecond: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		for archiveName, build := range map[string]func(*testing.T, []testEntry) []byte{"a.zip": buildZip, "a.tar.gz": buildTarGz} {
+			t.Run(tt.name+"/"+archiveName, func(t *testing.T) {
+				s := newTestArchiveService(t)
+				content := build(t, tt.entries)
+				budget := s.NewBudget()
+
+				first, _, err := walk(s, archiveName, content, budget)
+				if err != nil || len(first) != tt.wantFirst {
+					t.Fatalf("first Walk() = %d entries, %v, want %d", len(first), err, tt.wantFirst)
+				}
+				second, _, err := walk(s, archiveName, content, budget)
+				if err != nil || len(second) != tt.wantSecond {
+					t.Fatalf("second Walk() = %d entries, %v, want %d", len(second), err, tt.wantSecond)
+				}
+
+				// Новый запрос получает лимиты целиком
+				again, _, err := walk(s, archiveName, content, s.NewBudget())
+				if err != nil || len(again) != tt.wantFirst {
+					t.Fatalf("Walk() with a new budget = %d entries, %v, want %d", len(again), err, tt.wantFirst)
+				}
+			})
+		}
+	}
+
+	t.Run("unpacked", func(t *testing.T) {
+		s := newTestArchiveService(t)
+		content := buildTarGz(t, []testEntry{{name: "a.go", content: strings.Repeat("a", 1000)}})
+		budget := s.NewBudget()
+		budget.Unpacked = 3000
+
+		if _, _, err := walk(s, "a.tar.gz", content, budget); err != nil {
+			t.Fatalf("first Walk() error = %v", err)
+		}
+		// Поток tar с блоками заголовков и выравнивания длиннее содержимого
+		if _, _, err := walk(s, "a.tar.gz", content, budget); !errors.Is(err, errUnpackedLimit) {
+			t.Fatalf("second Walk() error = %v, want %v", err, errUnpackedLimit)
+		}
+	})
+}
+
+func TestProcessArchiveInvalid(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	_, _, err := s.ProcessArchiveReader("ws", "broken.zip", strings.NewReader("not a zip"), s.NewArchiveBudget(), nil)
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("ProcessArchiveReader() error = %v, want %v", err, ErrInvalidArchive)
+	}
+}
+
+func TestProcessArchiveReader(t *testing.T) {
+	entries := []testEntry{
+		{name: "cmd/main.go", content: "package main\n"},
+		{name: "image.go", content: "\x00\x01\x02"},
+		{name: "pkg/util.go", content: "package pkg\n"},
+	}
+	builders := map[string]func(*testing.T, []testEntry) []byte{
+		"project.zip":    buildZip,
+		"project.tar.gz": buildTarGz,
+	}
+
+	for archiveName, build := range builders {
+		t.Run(archiveName, func(t *testing.T) {
+			s := newTestFileService(t, storage.NewMemoryStorage())
+			files, skipped, err := s.ProcessArchiveReader("ws", archiveName, bytes.NewReader(build(t, entries)), s.NewArchiveBudget(), nil)
+			if err != nil {
+				t.Fatalf("ProcessArchiveReader() error = %v", err)
+			}
+			if len(files) != 2 || files[0].Path != "cmd/main.go" || files[1].Path != "pkg/util.go" {
+				t.Fatalf("ProcessArchiveReader() files = %+v, want cmd/main.go and pkg/util.go", files)
+			}
+			if len(skipped) != 1 || skipped[0].Path != "image.go" || skipped[0].Code != ReasonBinaryContent {
+				t.Fatalf("ProcessArchiveReader() skipped = %+v, want image.go with %s", skipped, ReasonBinaryContent)
+			}
+		})
+	}
+
+	t.Run("read error", func(t *testing.T) {
+		s := newTestFileService(t, storage.NewMemoryStorage())
+		r := io.MultiReader(strings.NewReader("PK"), iotest.ErrReader(errors.New("connection reset")))
+		if _, _, err := s.ProcessArchiveReader("ws", "project.zip", r, s.NewArchiveBudget(), nil); !errors.Is(err, ErrReadFailed) {
+			t.Fatalf("ProcessArchiveReader() error = %v, want %v", err, ErrReadFailed)
+		}
+	})
+}
+
+func TestProcessArchiveRemovesFilesOnError(t *testing.T) {
+	// Первый файл обрабатывается до того, как распаковка zip превысит лимит
+	entries := []testEntry{
+		{name: "cmd/main.go", content: "package main\n"},
+		{name: "data.go", content: strings.Repeat("\x00", 64*1024)},
+	}
+	st := storage.NewMemoryStorage()
+	s := newTestFileService(t, st)
+	s.cfg.MaxArchiveUnpacked = 32 * 1024
+
+	_, _, err := s.ProcessArchiveReader("ws", "project.zip", bytes.NewReader(buildZip(t, entries)), s.NewArchiveBudget(), nil)
+	if !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("ProcessArchiveReader() error = %v, want %v", err, ErrInvalidArchive)
+	}
+	if stored, err := st.List(storage.ListFilter{SessionID: "ws"}); err != nil || len(stored) != 0 {
+		t.Fatalf("files stored after a failed archive = %v, %v, want none", stored, err)
+	}
+}
@@ -3,11 +3,14 @@
 package service
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
 	"unicode/utf8"
 
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/encoding/unicode"
 	"golang.org/x/text/transform"
@@ -23,43 +26,207 @@ func NewEncodingService() *EncodingService {
 
 // ConvertToUTF8 конвертирует содержимое файла в UTF-8
 func (s *EncodingService) ConvertToUTF8(content []byte) (string, error) {
-	// Валидаци: не UTF-8 ли уже
+	decoded, _, err := s.DecodeToUTF8(content)
+	return decoded, err
+}
+
+// DecodeToUTF8 конвертирует содержимое файла в UTF-8 и возвращает исходную кодировку.
+// Кодировка содержимого, не являющегося UTF-8, определяется эвристикой detectEncoding.
+func (s *EncodingService) DecodeToUTF8(content []byte) (string, string, error) {
 	if utf8.Valid(content) {
-		return string(content), nil
-	}
-
-	// Тестирование распространеннх кодировок
-	encodings := []struct {
-		name    string
-		decoder transform.Transformer
-	}{
-		{"UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder()},
-		{"UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder()},
-		{"Windows-1251", charmap.Windows1251.NewDecoder()},
-		{"Windows-1252", charmap.Windows1252.NewDecoder()},
-		{"ISO-8859-1", charmap.ISO8859_1.NewDecoder()},
-		{"ISO-8859-5", charmap.ISO8859_5.NewDecoder()},
-		{"KOI8-R", charmap.KOI8R.NewDecoder()},
-	}
-
-	for _, encoding := range encodings {
-		decoded, err := s.tryDecode(content, encoding.decoder)
-		if err == nil && utf8.Valid(decoded) {
-			return string(decoded), nil
+		return string(content), "UTF-8", nil
+	}
+
+	invalid := validUTF8Prefix(content)
+	name, enc := detectEncoding(content[:min(len(content), sniffSize)], content[invalid:min(len(content), invalid+sniffSize)])
+	decoded, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: unable to convert content from %s to UTF-8: %v", ErrEncodingFailed, name, err)
+	}
+	return string(decoded), name, nil
+}
+
+// sniffSize - объем содержимого, по которому определяется кодировка
+const sniffSize = 64 * 1024
+
+// detectEncoding определяет кодировку содержимого, не являющегося UTF-8.
+// UTF-16 определяется по BOM или нулевым старшим байтам символов ASCII в начале
+// содержимого head. Иначе однобайтовая кодировка выбирается по sample - содержимому,
+// начиная с первой некорректной последовательности UTF-8: Windows-1251 для кириллицы,
+// Windows-1252 для остальных текстов.
+func detectEncoding(head, sample []byte) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+	}
+
+	var zeroEven, zeroOdd int
+	for i, b := range head {
+		if b != 0 {
+			continue
 		}
+		if i%2 == 0 {
+			zeroEven++
+		} else {
+			zeroOdd++
+		}
+	}
+	switch {
+	case zeroOdd > len(head)/4 && zeroOdd > 2*zeroEven:
+		return "UTF-16LE", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case zeroEven > len(head)/4 && zeroEven > 2*zeroOdd:
+		return "UTF-16BE", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
 	}
 
-	return "", fmt.Errorf("unable to convert content to UTF-8: unrecognized encoding")
+	if looksLikeWindows1251(sample) {
+		return "Windows-1251", charmap.Windows1251
+	}
+	return "Windows-1252", charmap.Windows1252
 }
 
-// tryDecode пытается декодировать контент
-func (s *EncodingService) tryDecode(content []byte, decoder transform.Transformer) ([]byte, error) {
-	reader := transform.NewReader(bytes.NewReader(content), decoder)
-	decoded, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, err
+// StreamDecoder читает содержимое файла из потока и конвертирует его в UTF-8.
+// Пока содержимое остается корректным UTF-8, оно записывается сразу в итоговую
+// строку без промежуточных копий. После первой некорректной последовательности
+// определяется кодировка, и все содержимое, включая уже прочитанное,
+// декодируется потоком через transform.Reader без копии исходных байтов.
+type StreamDecoder struct {
+	text     strings.Builder // Содержимое в UTF-8
+	pending  []byte          // Незавершенная последовательность UTF-8 в конце прочитанной части
+	encoding string          // Исходная кодировка
+}
+
+// NewStreamDecoder создает декодер для потокового чтения содержимого файла
+func (s *EncodingService) NewStreamDecoder() *StreamDecoder {
+	return &StreamDecoder{encoding: "UTF-8"}
+}
+
+// ReadFrom реализует io.ReaderFrom: читает содержимое до конца потока
+// и возвращает количество прочитанных байтов
+func (d *StreamDecoder) ReadFrom(r io.Reader) (int64, error) {
+	source := &countingReader{r: r}
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := source.Read(buf)
+		if rest := d.appendUTF8(buf[:n]); rest != nil {
+			err := d.decode(rest, source)
+			return source.n, err
+		}
+		if err == io.EOF {
+			if len(d.pending) > 0 {
+				// Незавершенная последовательность в конце содержимого некорректна
+				err := d.decode(d.pending, source)
+				return source.n, err
+			}
+			return source.n, nil
+		}
+		if err != nil {
+			return source.n, err
+		}
+	}
+}
+
+// Decode возвращает содержимое в UTF-8 и его исходную кодировку
+func (d *StreamDecoder) Decode() (string, string) {
+	return d.text.String(), d.encoding
+}
+
+// appendUTF8 дописывает корректное UTF-8 начало части в итоговую строку.
+// Возвращает остаток части, начинающийся с некорректной последовательности, или nil.
+func (d *StreamDecoder) appendUTF8(p []byte) []byte {
+	data := p
+	if len(d.pending) > 0 {
+		data = append(d.pending, p...)
+		d.pending = nil
 	}
-	return decoded, nil
+
+	valid := validUTF8Prefix(data)
+	d.text.Write(data[:valid])
+
+	rest := data[valid:]
+	switch {
+	case len(rest) == 0:
+		return nil
+	case !utf8.FullRune(rest):
+		// Последовательность может продолжиться в следующей части
+		d.pending = append([]byte(nil), rest...)
+		return nil
+	default:
+		return rest
+	}
+}
+
+// decode определяет кодировку и декодирует все содержимое: уже записанное
+// UTF-8 начало, остаток rest и непрочитанную часть потока r.
+// Ошибка преобразования возвращается с ErrEncodingFailed, ошибка чтения потока - как есть.
+func (d *StreamDecoder) decode(rest []byte, r io.Reader) error {
+	prefix := d.text.String()
+	d.text.Reset()
+
+	stream := &errorReader{r: r}
+	tail := bufio.NewReaderSize(io.MultiReader(bytes.NewReader(rest), stream), sniffSize)
+	sample, err := tail.Peek(sniffSize)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	head := []byte(prefix[:min(len(prefix), sniffSize)])
+	head = append(head, sample[:min(len(sample), sniffSize-len(head))]...)
+
+	name, enc := detectEncoding(head, sample)
+	d.encoding = name
+	d.text.Grow(len(prefix) + len(rest))
+	source := io.MultiReader(strings.NewReader(prefix), tail)
+	_, err = io.Copy(&d.text, transform.NewReader(source, enc.NewDecoder()))
+	if err != nil && stream.err == nil {
+		return fmt.Errorf("%w: unable to convert content from %s to UTF-8: %v", ErrEncodingFailed, name, err)
+	}
+	return err
+}
+
+// errorReader запоминает ошибку чтения потока, отделяя ее от ошибок преобразования
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+// Read реализует io.Reader
+func (e *errorReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// countingReader считает прочитанные байты
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read реализует io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// validUTF8Prefix возвращает длину начала data, состоящего из корректных символов UTF-8
+func validUTF8Prefix(data []byte) int {
+	if utf8.Valid(data) {
+		return len(data)
+	}
+
+	i := 0
+	for i < len(data) {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			break
+		}
+		i += size
+	}
+	return i
 }
 
 // DetectEncoding пытается определить кодировку содержимого
@@ -69,7 +236,7 @@ func (s *EncodingService) DetectEncoding(content []byte) string {
 	}
 
 	// Простая эвристика для определения распространенных кодировок
-	if s.looksLikeWindows1251(content) {
+	if looksLikeWindows1251(content) {
 		return "Windows-1251"
 	}
 
@@ -77,12 +244,23 @@ func (s *EncodingService) DetectEncoding(content []byte) string {
 }
 
 // looksLikeWindows1251 проверяет, похоже ли содержимое на Windows-1251
-func (s *EncodingService) looksLikeWindows1251(content []byte) bool {
-	// Эвристика: проверяем наличие кириллических символов в типичном для Windows-1251 диапазоне
-	for _, b := range content {
-		if b >= 0xC0 && b <= 0xFF {
-			return true
+func looksLikeWindows1251(content []byte) bool {
+	// Эвристика: кириллические буквы Windows-1251 (0xC0-0xFF) образуют слова,
+	// а буквы с диакритикой Windows-1252 из того же диапазона стоят между латинскими
+	letters, paired := 0, 0
+	for i, b := range content {
+		if !isWindows1251Letter(b) {
+			continue
+		}
+		letters++
+		if i > 0 && isWindows1251Letter(content[i-1]) || i+1 < len(content) && isWindows1251Letter(content[i+1]) {
+			paired++
 		}
 	}
-	return false
+	return letters > 0 && paired*2 >= letters
+}
+
+// isWindows1251Letter проверяет, является ли байт кириллической буквой Windows-1251
+func isWindows1251Letter(b byte) bool {
+	return b >= 0xC0
 }
@@ -0,0 +1,148 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты определения кодировки и потокового декодирования.
+package service
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// mustEncode кодирует текст в указанную кодировку
+func mustEncode(t *testing.T, encode func([]byte) ([]byte, error), text string) []byte {
+	t.Helper()
+
+	encoded, err := encode([]byte(text))
+	if err != nil {
+		t.Fatalf("failed to encode test content: %v", err)
+	}
+	return encoded
+}
+
+func TestStreamDecoder(t *testing.T) {
+	russian := "// Комментарий на русском\nfunc main() {}\n"
+	// Начало в ASCII длиннее буфера чтения: кодировка определяется после записи части содержимого
+	asciiHead := strings.Repeat("x := 1 // ascii\n", 4096)
+
+	tests := []struct {
+		name         string
+		content      []byte
+		want         string
+		wantEncoding string
+	}{
+		{
+			name:         "utf-8",
+			content:      []byte("package main // Привет, 世界\n"),
+			want:         "package main // Привет, 世界\n",
+			wantEncoding: "UTF-8",
+		},
+		{
+			name:         "empty",
+			content:      nil,
+			want:         "",
+			wantEncoding: "UTF-8",
+		},
+		{
+			name:         "windows-1251",
+			content:      mustEncode(t, charmap.Windows1251.NewEncoder().Bytes, russian),
+			want:         russian,
+			wantEncoding: "Windows-1251",
+		},
+		{
+			name:         "windows-1251 after long ascii head",
+			content:      mustEncode(t, charmap.Windows1251.NewEncoder().Bytes, asciiHead+russian),
+			want:         asciiHead + russian,
+			wantEncoding: "Windows-1251",
+		},
+		{
+			name:         "windows-1252",
+			content:      mustEncode(t, charmap.Windows1252.NewEncoder().Bytes, "# café\n"),
+			want:         "# café\n",
+			wantEncoding: "Windows-1252",
+		},
+		{
+			name:         "windows-1252 after long ascii head",
+			content:      mustEncode(t, charmap.Windows1252.NewEncoder().Bytes, asciiHead+"# naïve café\n"),
+			want:         asciiHead + "# naïve café\n",
+			wantEncoding: "Windows-1252",
+		},
+		{
+			name:         "utf-16le with bom",
+			content:      mustEncode(t, unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes, russian),
+			want:         russian,
+			wantEncoding: "UTF-16LE",
+		},
+		{
+			name:         "utf-16be with bom",
+			content:      mustEncode(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM).NewEncoder().Bytes, russian),
+			want:         russian,
+			wantEncoding: "UTF-16BE",
+		},
+		{
+			name:         "utf-16le without bom",
+			content:      mustEncode(t, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewEncoder().Bytes, "package main // café\n"),
+			want:         "package main // café\n",
+			wantEncoding: "UTF-16LE",
+		},
+		{
+			name:         "truncated utf-8 at the end",
+			content:      []byte("abc\xd0"),
+			want:         "abcÐ",
+			wantEncoding: "Windows-1252",
+		},
+	}
+
+	readers := map[string]func([]byte) io.Reader{
+		"whole":    func(b []byte) io.Reader { return bytes.NewReader(b) },
+		"one byte": func(b []byte) io.Reader { return iotest.OneByteReader(bytes.NewReader(b)) },
+	}
+	for _, tt := range tests {
+		for readerName, reader := range readers {
+			t.Run(tt.name+"/"+readerName, func(t *testing.T) {
+				decoder := NewEncodingService().NewStreamDecoder()
+				n, err := decoder.ReadFrom(reader(tt.content))
+				if err != nil {
+					t.Fatalf("ReadFrom() error = %v", err)
+				}
+				if n != int64(len(tt.content)) {
+					t.Fatalf("ReadFrom() = %d bytes, want %d", n, len(tt.content))
+				}
+
+				got, encoding := decoder.Decode()
+				if encoding != tt.wantEncoding {
+					t.Fatalf("encoding = %s, want %s", encoding, tt.wantEncoding)
+				}
+				if got != tt.want {
+					t.Fatalf("content = %q, want %q", truncate(got), truncate(tt.want))
+				}
+
+				// DecodeToUTF8 определяет ту же кодировку для содержимого целиком
+				whole, wholeEncoding, err := NewEncodingService().DecodeToUTF8(tt.content)
+				if err != nil || whole != got || wholeEncoding != encoding {
+					t.Fatalf("DecodeToUTF8() = %q, %s, %v, want %q, %s", truncate(whole), wholeEncoding, err, truncate(got), encoding)
+				}
+			})
+		}
+	}
+}
+
+func TestStreamDecoderReadError(t *testing.T) {
+	decoder := NewEncodingService().NewStreamDecoder()
+	source := io.MultiReader(strings.NewReader("abc\xff"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := decoder.ReadFrom(source); err != io.ErrUnexpectedEOF {
+		t.Fatalf("ReadFrom() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// truncate сокращает строку для сообщения об ошибке
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
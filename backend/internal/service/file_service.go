@@ -3,100 +3,411 @@
 package service
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MindlessMuse666/code-merger/internal/config"
 	"github.com/MindlessMuse666/code-merger/internal/storage"
 )
 
+var (
+	// ErrFileNotFound возвращается, если файл отсутствует в хранилище
+	ErrFileNotFound = errors.New("file not found")
+	// ErrUnknownRename возвращается, если ключ переименования не соответствует ни одному файлу
+	ErrUnknownRename = errors.New("rename key matches no file")
+)
+
 // FileService предоставляет методы для работы с файлами
 type FileService struct {
 	cfg               *config.Config
 	storage           storage.Storage
 	encodingService   *EncodingService
 	validationService *ValidationService
+	archiveService    *ArchiveService
+	templateService   *TemplateService
+	tokenService      *TokenService
+	lastFileID        atomic.Int64
+	uploadsMu         sync.Mutex             // Защищает uploadLocks
+	uploadLocks       map[string]*uploadLock // Блокировки возобновляемых загрузок по ключу записи о загрузке
+}
+
+// UploadedFile представляет сведения о сохраненном файле
+type UploadedFile struct {
+	ID          string    `json:"id"`                     // Идентификатор файла
+	Filename    string    `json:"filename"`               // Имя файла
+	Path        string    `json:"path"`                   // Относительный путь файла
+	Size        int64     `json:"size"`                   // Размер содержимого в байтах (UTF-8)
+	TokenCount  int       `json:"token_count"`            // Количество токенов содержимого
+	UploadedAt  time.Time `json:"uploaded_at"`            // Время загрузки файла
+	Duplicate   bool      `json:"duplicate"`              // Такое же содержимое уже загружено в это рабочее пространство
+	WorkspaceID string    `json:"workspace_id,omitempty"` // Идентификатор рабочего пространства (в списках файлов)
 }
 
 // FileContent представляет содержимое файла с именем
 type FileContent struct {
-	Filename string `json:"filename"`
-	Content  string `json:"content"`
+	ID               string `json:"id"`
+	Filename         string `json:"filename"`
+	Path             string `json:"path"`
+	OriginalFilename string `json:"original_filename"` // Имя файла до переименования
+	Encoding         string `json:"encoding"`          // Исходная кодировка файла
+	Size             int64  `json:"size"`              // Размер содержимого в байтах (UTF-8)
+	TokenCount       int    `json:"token_count"`       // Количество токенов содержимого
+	Part             int    `json:"part,omitempty"`    // Номер фрагмента файла, разбитого по частям (0 - файл целиком)
+	Content          string `json:"content"`
+}
+
+// DisplayName возвращает относительный путь файла, а при его отсутствии - имя
+func (f FileContent) DisplayName() string {
+	if f.Path != "" {
+		return f.Path
+	}
+	return f.Filename
+}
+
+// Title возвращает название файла для заголовков: путь и номер фрагмента, если файл разбит по частям
+func (f FileContent) Title() string {
+	if f.Part > 0 {
+		return fmt.Sprintf("%s (part %d)", f.DisplayName(), f.Part)
+	}
+	return f.DisplayName()
 }
 
 // NewFileService создает новый экземпляр FileService
 func NewFileService(cfg *config.Config, storage storage.Storage) *FileService {
+	validationService := NewValidationService()
 	return &FileService{
 		cfg:               cfg,
 		storage:           storage,
 		encodingService:   NewEncodingService(),
-		validationService: NewValidationService(),
+		validationService: validationService,
+		archiveService:    NewArchiveService(cfg, validationService),
+		templateService:   NewTemplateService(cfg),
+		tokenService:      NewTokenService(),
 	}
 }
 
-// ProcessFile обрабатывает загруженный файл
-func (s *FileService) ProcessFile(filename string, content []byte) (string, error) {
-	// Валидация файла
-	if err := s.validationService.ValidateFile(filename, content, s.cfg.MaxFileSize); err != nil {
-		return "", fmt.Errorf("file validation failed: %v", err)
+// WorkspaceContent содержит хеши содержимого файлов рабочего пространства для флага Duplicate.
+// Создается один раз на запрос загрузки: файлы рабочего пространства перечисляются
+// при первой проверке, а файлы, сохраненные запросом, добавляются в набор.
+type WorkspaceContent struct {
+	hashes map[string]bool // nil - набор еще не загружен
+}
+
+// NewWorkspaceContent возвращает пустой набор содержимого рабочего пространства для нового запроса
+func (s *FileService) NewWorkspaceContent() *WorkspaceContent {
+	return &WorkspaceContent{}
+}
+
+// ProcessFile обрабатывает загруженный файл.
+// name может быть относительным путем (например, cmd/server/main.go),
+// workspaceID - идентификатор рабочего пространства (может быть пустым).
+func (s *FileService) ProcessFile(workspaceID, name string, content []byte) (UploadedFile, error) {
+	return s.ProcessReader(workspaceID, name, bytes.NewReader(content), nil)
+}
+
+// ProcessReader обрабатывает файл, читая содержимое из потока. Чтение прекращается
+// при превышении MaxFileSize, содержимое проверяется и конвертируется в UTF-8
+// по мере чтения и сохраняется без промежуточных копий всего файла.
+// known - набор содержимого рабочего пространства, общий для файлов запроса;
+// при nil файлы рабочего пространства перечисляются для этого файла.
+func (s *FileService) ProcessReader(workspaceID, name string, r io.Reader, known *WorkspaceContent) (UploadedFile, error) {
+	relPath, err := cleanRelativePath(name)
+	if err != nil {
+		return UploadedFile{}, fmt.Errorf("%w %s: %v", ErrInvalidPath, name, err)
 	}
+	filename := path.Base(relPath)
 
-	// Конвертация в UTF-8
-	utf8Content, err := s.encodingService.ConvertToUTF8(content)
+	// Валидация расширения до чтения содержимого
+	if err := s.validationService.ValidateName(filename); err != nil {
+		return UploadedFile{}, fmt.Errorf("file validation failed: %w", err)
+	}
+
+	// Конвертация в UTF-8 по мере чтения
+	decoder := s.encodingService.NewStreamDecoder()
+	size, err := decoder.ReadFrom(io.LimitReader(r, s.cfg.MaxFileSize+1))
+	if errors.Is(err, ErrEncodingFailed) {
+		return UploadedFile{}, fmt.Errorf("file validation failed: %w", err)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to convert file to UTF-8: %v", err)
+		return UploadedFile{}, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	if size > s.cfg.MaxFileSize {
+		return UploadedFile{}, fmt.Errorf("file validation failed: %w: exceeds %d bytes", ErrFileTooLarge, s.cfg.MaxFileSize)
+	}
+	utf8Content, encoding := decoder.Decode()
+
+	// Валидация содержимого
+	if err := s.validationService.ValidateText(filename, utf8Content); err != nil {
+		return UploadedFile{}, fmt.Errorf("file validation failed: %w", err)
 	}
 
 	// Генерация ID файла
 	fileID := s.generateFileID()
+	tokenCount := s.tokenService.Count(utf8Content)
+	uploadedAt := time.Now()
+
+	// Хеш содержимого: одинаковое содержимое хранится однократно
+	contentHash := storage.ContentHash(utf8Content)
+	duplicate := false
+	if _, ok := s.storage.(storage.Deduplicator); ok {
+		if known == nil {
+			known = s.NewWorkspaceContent()
+		}
+		duplicate = s.hasWorkspaceContent(workspaceID, contentHash, known)
+	}
 
 	// Сохранение в хранилище
-	s.storage.Store(fileID, storage.FileData{
-		Content:    utf8Content,
+	err = s.storage.Store(fileKey(workspaceID, fileID), storage.FileData{
+		Content:     utf8Content,
+		Filename:    filename,
+		Path:        relPath,
+		Encoding:    encoding,
+		UploadedAt:  uploadedAt,
+		Size:        int64(len(utf8Content)),
+		TokenCount:  tokenCount,
+		SessionID:   workspaceID,
+		ContentHash: contentHash,
+	})
+	if err != nil {
+		return UploadedFile{}, fmt.Errorf("failed to store file: %w", err)
+	}
+	if known != nil && known.hashes != nil {
+		known.hashes[contentHash] = true
+	}
+
+	return UploadedFile{
+		ID:         fileID,
 		Filename:   filename,
-		UploadedAt: time.Now(),
+		Path:       relPath,
 		Size:       int64(len(utf8Content)),
+		TokenCount: tokenCount,
+		UploadedAt: uploadedAt,
+		Duplicate:  duplicate,
+	}, nil
+}
+
+// hasWorkspaceContent проверяет, есть ли в рабочем пространстве файл с таким же содержимым.
+// Проверка по всему хранилищу (Deduplicator.HasContent) раскрыла бы, какое содержимое
+// загружено в другие рабочие пространства, поэтому учитываются только собственные файлы.
+// Файлы вне рабочих пространств друг от друга не изолированы, для них флаг не вычисляется.
+// Файлы рабочего пространства перечисляются один раз на набор known.
+func (s *FileService) hasWorkspaceContent(workspaceID, contentHash string, known *WorkspaceContent) bool {
+	if workspaceID == "" {
+		return false
+	}
+
+	if known.hashes == nil {
+		files, err := s.storage.List(storage.ListFilter{SessionID: workspaceID, FilesOnly: true})
+		if err != nil {
+			log.Printf("failed to list workspace files: %v", err)
+			return false
+		}
+		known.hashes = make(map[string]bool, len(files))
+		for _, file := range files {
+			known.hashes[file.Data.ContentHash] = true
+		}
+	}
+	return known.hashes[contentHash]
+}
+
+// IsArchive проверяет, является ли файл поддерживаемым архивом
+func (s *FileService) IsArchive(filename string) bool {
+	return s.archiveService.IsArchive(filename)
+}
+
+// NewArchiveBudget возвращает полные лимиты распаковки архивов для нового запроса
+func (s *FileService) NewArchiveBudget() *ArchiveBudget {
+	return s.archiveService.NewBudget()
+}
+
+// ProcessArchive распаковывает архив размером size и обрабатывает каждый извлеченный файл
+// сразу после чтения, поэтому в памяти находится содержимое только одного элемента архива.
+// Распаковка расходует остаток лимитов запроса budget, общий для всех его архивов.
+// Возвращает принятые файлы и список пропущенных элементов с причинами.
+// Ошибка возвращается, только если архив не удалось распаковать; уже сохраненные
+// файлы архива при этом удаляются. known - набор содержимого рабочего пространства,
+// общий для файлов запроса (при nil создается набор для этого архива).
+func (s *FileService) ProcessArchive(workspaceID, filename string, r io.ReaderAt, size int64, budget *ArchiveBudget, known *WorkspaceContent) ([]UploadedFile, []SkippedEntry, error) {
+	if known == nil {
+		known = s.NewWorkspaceContent()
+	}
+
+	var files []UploadedFile
+	var rejected []SkippedEntry
+	skipped, err := s.archiveService.Walk(filename, r, size, budget, func(entry ArchiveEntry) {
+		file, err := s.ProcessReader(workspaceID, entry.Path, bytes.NewReader(entry.Content), known)
+		if err != nil {
+			rejected = append(rejected, SkippedEntry{Path: entry.Path, Code: ReasonCode(err), Reason: err.Error()})
+			return
+		}
+		files = append(files, file)
 	})
+	if err != nil {
+		ids := make([]string, 0, len(files))
+		for _, file := range files {
+			ids = append(ids, file.ID)
+		}
+		s.DeleteFiles(workspaceID, ids)
+		// Удаленные файлы остались в наборе, он перечитывается при следующей проверке
+		known.hashes = nil
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrInvalidArchive, filename, err)
+	}
+
+	return files, append(skipped, rejected...), nil
+}
+
+// ProcessArchiveReader обрабатывает архив из потока. zip читается с произвольным доступом,
+// а tar - дважды, поэтому поток предварительно копируется во временный файл, а не в память.
+// Ошибка чтения потока возвращается с ErrReadFailed.
+func (s *FileService) ProcessArchiveReader(workspaceID, filename string, r io.Reader, budget *ArchiveBudget, known *WorkspaceContent) ([]UploadedFile, []SkippedEntry, error) {
+	spool, err := os.CreateTemp("", "code-merger-archive-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, sourceReader{r: r})
+	if errors.Is(err, ErrReadFailed) {
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	return s.ProcessArchive(workspaceID, filename, spool, size, budget, known)
+}
 
-	return fileID, nil
+// sourceReader помечает ошибки чтения потока ErrReadFailed, отделяя их от ошибок записи копии
+type sourceReader struct {
+	r io.Reader
 }
 
-// GetFileByID возвращает файл по его ID
-func (s *FileService) GetFileByID(fileID string) (storage.FileData, error) {
-	fileData, exists := s.storage.Get(fileID)
-	if !exists {
-		return storage.FileData{}, fmt.Errorf("file not found: %s", fileID)
+// Read реализует io.Reader
+func (r sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	return n, err
+}
+
+// DeleteFiles удаляет файлы рабочего пространства (например, при откате загрузки)
+func (s *FileService) DeleteFiles(workspaceID string, fileIDs []string) {
+	for _, id := range fileIDs {
+		s.storage.Delete(fileKey(workspaceID, id))
+	}
+}
+
+// StorageStats возвращает статистику хранилища
+func (s *FileService) StorageStats() storage.Stats {
+	return s.storage.Stats()
+}
+
+// GetFileByID возвращает файл рабочего пространства по его ID
+func (s *FileService) GetFileByID(workspaceID, fileID string) (storage.FileData, error) {
+	fileData, exists := s.storage.Get(fileKey(workspaceID, fileID))
+	if !exists || fileData.Upload != nil {
+		return storage.FileData{}, fmt.Errorf("%w: %s", ErrFileNotFound, fileID)
 	}
 	return fileData, nil
 }
 
-// GetFiles возвращает файлы по их ID
-func (s *FileService) GetFiles(fileIDs []string, renames map[string]string) ([]FileContent, error) {
+// TouchFile продлевает время жизни файла, а с ним и рабочего пространства,
+// и возвращает новое время удаления
+func (s *FileService) TouchFile(workspaceID, fileID string) (time.Time, error) {
+	if !s.storage.Touch(fileKey(workspaceID, fileID)) {
+		return time.Time{}, fmt.Errorf("%w: %s", ErrFileNotFound, fileID)
+	}
+	return time.Now().Add(s.cfg.FileTTL), nil
+}
+
+// ListFiles возвращает сведения о загруженных файлах, удовлетворяющих фильтру
+func (s *FileService) ListFiles(filter storage.ListFilter) ([]UploadedFile, error) {
+	filter.FilesOnly = true
+	stored, err := s.storage.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]UploadedFile, 0, len(stored))
+	for _, file := range stored {
+		files = append(files, UploadedFile{
+			ID:          publicFileID(file),
+			Filename:    file.Data.Filename,
+			Path:        file.Data.Path,
+			Size:        file.Data.Size,
+			TokenCount:  file.Data.TokenCount,
+			UploadedAt:  file.Data.UploadedAt,
+			WorkspaceID: file.Data.SessionID,
+		})
+	}
+	return files, nil
+}
+
+// GetFiles возвращает файлы рабочего пространства по их ID.
+// Ключом переименования может быть ID файла, относительный путь или имя файла
+// (в порядке убывания приоритета): переименование по ID затрагивает только один файл,
+// по имени - все файлы с этим именем. Ключ, не совпавший ни с одним файлом, считается ошибкой.
+func (s *FileService) GetFiles(workspaceID string, fileIDs []string, renames map[string]string) ([]FileContent, error) {
 	if len(fileIDs) == 0 {
 		return nil, fmt.Errorf("no file IDs provided")
 	}
 
 	var files []FileContent
+	usedRenames := make(map[string]bool, len(renames))
 
 	for _, id := range fileIDs {
-		fileData, err := s.GetFileByID(id)
+		fileData, err := s.GetFileByID(workspaceID, id)
 		if err != nil {
-			return nil, fmt.Errorf("file not found: %s", id)
+			return nil, err
+		}
+
+		// Ключ считается совпавшим, даже если его перекрыл ключ с большим приоритетом
+		for _, key := range []string{id, fileData.Path, fileData.Filename} {
+			if _, exists := renames[key]; exists && key != "" {
+				usedRenames[key] = true
+			}
 		}
 
 		// Применяем переименование
 		filename := fileData.Filename
-		if newName, exists := renames[filename]; exists {
-			filename = newName
+		relPath := fileData.Path
+		if newName, exists := renames[id]; exists {
+			filename, relPath = renameFile(relPath, newName)
+		} else if newPath, exists := renames[relPath]; exists && relPath != "" {
+			filename, relPath = path.Base(newPath), newPath
+		} else if newName, exists := renames[filename]; exists {
+			filename, relPath = renameFile(relPath, newName)
 		}
 
 		files = append(files, FileContent{
-			Filename: filename,
-			Content:  fileData.Content,
+			ID:               id,
+			Filename:         filename,
+			Path:             relPath,
+			OriginalFilename: fileData.Filename,
+			Encoding:         fileData.Encoding,
+			Size:             fileData.Size,
+			TokenCount:       fileData.TokenCount,
+			Content:          fileData.Content,
 		})
 	}
 
+	for key := range renames {
+		if !usedRenames[key] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRename, key)
+		}
+	}
+
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no valid files found")
 	}
@@ -104,27 +415,103 @@ func (s *FileService) GetFiles(fileIDs []string, renames map[string]string) ([]F
 	return files, nil
 }
 
-// MergeFiles объединяет файлы с соблюдением правил форматирования
-func (s *FileService) MergeFiles(files []FileContent) string {
-	var result strings.Builder
+// renameFile возвращает новое имя и путь файла.
+// Если новое имя не содержит каталогов, файл остается в исходном каталоге.
+func renameFile(relPath, newName string) (string, string) {
+	if strings.Contains(newName, "/") || relPath == "" {
+		return path.Base(newName), newName
+	}
+	return newName, path.Join(path.Dir(relPath), newName)
+}
 
-	for i, file := range files {
-		// Получаем префикс комментария для файла
-		prefix := s.validationService.GetCommentPrefix(file.Filename)
+// SortFiles упорядочивает файлы согласно указанному порядку.
+// Пустой порядок сохраняет исходную последовательность, "path" сортирует по относительному пути.
+func (s *FileService) SortFiles(files []FileContent, order string) error {
+	switch order {
+	case "":
+		return nil
+	case "path":
+		sort.SliceStable(files, func(i, j int) bool {
+			return files[i].DisplayName() < files[j].DisplayName()
+		})
+		return nil
+	default:
+		return fmt.Errorf("unsupported sort order: %s", order)
+	}
+}
 
-		// Добавляем заголовок файла
-		result.WriteString(s.formatFileHeader(prefix, file.Filename))
+// CountTokens возвращает количество токенов в тексте
+func (s *FileService) CountTokens(text string) int {
+	return s.tokenService.Count(text)
+}
 
-		// Добавляем содержимое файла
-		result.WriteString(file.Content)
+// LoadTemplates регистрирует шаблоны объединения из каталога
+func (s *FileService) LoadTemplates(dir string) error {
+	return s.templateService.LoadDir(dir)
+}
 
-		// Добавляем разделитель между файлами (кроме последнего)
+// MergeFiles объединяет файлы с соблюдением правил форматирования выбранного формата
+func (s *FileService) MergeFiles(files []FileContent, opts MergeOptions) (string, error) {
+	formatter, err := s.newFormatter(opts)
+	if err != nil {
+		return "", err
+	}
+
+	// Части вывода собираются заранее, чтобы оглавление могло сослаться на номера строк
+	preamble, err := formatter.preamble(files)
+	if err != nil {
+		return "", err
+	}
+
+	blocks := make([]string, len(files))
+	for i, file := range files {
+		// Заголовок и содержимое файла
+		formatted, err := formatter.file(i, file)
+		if err != nil {
+			return "", err
+		}
+
+		// Разделитель между файлами (кроме последнего)
 		if i < len(files)-1 {
-			result.WriteString("\n\n\n")
+			separator, err := formatter.separator()
+			if err != nil {
+				return "", err
+			}
+			formatted += separator
+		}
+		blocks[i] = formatted
+	}
+
+	footer, err := formatter.footer(files)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+
+	if opts.TableOfContents {
+		prefix, err := s.tocCommentPrefix(opts)
+		if err != nil {
+			return "", err
+		}
+
+		// Номер строки начала файла: строки оглавления и преамбулы плюс предыдущие файлы
+		line := tocLineCount(prefix, files) + strings.Count(preamble, "\n") + 1
+		startLines := make([]int, len(files))
+		for i, block := range blocks {
+			startLines[i] = line
+			line += strings.Count(block, "\n")
 		}
+		result.WriteString(buildTableOfContents(prefix, files, startLines))
+	}
+
+	result.WriteString(preamble)
+	for _, block := range blocks {
+		result.WriteString(block)
 	}
+	result.WriteString(footer)
 
-	return result.String()
+	return result.String(), nil
 }
 
 // formatFileHeader форматирует заголовок файла в соответствии с префиксом комментария
@@ -139,7 +526,37 @@ func (s *FileService) formatFileHeader(prefix, filename string) string {
 	}
 }
 
-// generateFileID генерирует уникальный ID для файла
+// cleanRelativePath нормализует относительный путь файла и отклоняет небезопасные пути
+func cleanRelativePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", fmt.Errorf("absolute path is not allowed")
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path traversal is not allowed")
+		}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == "" {
+		return "", fmt.Errorf("empty path")
+	}
+	return cleaned, nil
+}
+
+// generateFileID генерирует уникальный ID для файла.
+// ID монотонно возрастают, чтобы файлы из одного архива не получили одинаковый ID.
 func (s *FileService) generateFileID() string {
-	return fmt.Sprintf("file_%d", time.Now().UnixNano())
+	for {
+		last := s.lastFileID.Load()
+		next := time.Now().UnixNano()
+		if next <= last {
+			next = last + 1
+		}
+		if s.lastFileID.CompareAndSwap(last, next) {
+			return fmt.Sprintf("file_%d", next)
+		}
+	}
 }
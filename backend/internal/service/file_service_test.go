@@ -0,0 +1,184 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты относительных путей файлов, получения файлов для объединения
+// и их переименования.
+package service
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+func TestRelativePaths(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		wantPath string // Нормализованный путь ("" - путь отклоняется)
+	}{
+		{name: "file name", filename: "main.go", wantPath: "main.go"},
+		{name: "nested path", filename: "src/cmd/main.go", wantPath: "src/cmd/main.go"},
+		{name: "backslashes", filename: `src\cmd\main.go`, wantPath: "src/cmd/main.go"},
+		{name: "mixed separators", filename: `src/cmd\main.go`, wantPath: "src/cmd/main.go"},
+		{name: "empty segments", filename: "src//cmd///main.go", wantPath: "src/cmd/main.go"},
+		{name: "current directory segments", filename: "./src/./main.go", wantPath: "src/main.go"},
+		{name: "dots in names", filename: "..src/main..go", wantPath: "..src/main..go"},
+		{name: "parent directory", filename: "../main.go"},
+		{name: "parent directory inside path", filename: "src/../main.go"},
+		{name: "parent directory with backslashes", filename: `src\..\..\main.go`},
+		{name: "absolute path", filename: "/etc/main.go"},
+		{name: "absolute path with backslashes", filename: `\\server\share\main.go`},
+		{name: "drive letter", filename: `C:\src\main.go`},
+		{name: "drive letter with slashes", filename: "c:/src/main.go"},
+		{name: "empty", filename: ""},
+		{name: "only separators", filename: "//"},
+		{name: "current directory", filename: "./"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cleanRelativePath(tt.filename)
+			if tt.wantPath == "" {
+				if err == nil {
+					t.Fatalf("cleanRelativePath(%q) = %q, want error", tt.filename, got)
+				}
+			} else if err != nil || got != tt.wantPath {
+				t.Fatalf("cleanRelativePath(%q) = %q, %v, want %q", tt.filename, got, err, tt.wantPath)
+			}
+
+			// Загрузка сохраняет нормализованный путь, он же выводится в заголовке файла
+			s := newTestFileService(t, storage.NewMemoryStorage())
+			file, err := s.ProcessFile("ws", tt.filename, []byte("package main\n"))
+			if tt.wantPath == "" {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("ProcessFile(%q) error = %v, want %v", tt.filename, err, ErrInvalidPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessFile(%q) error = %v", tt.filename, err)
+			}
+			if file.Path != tt.wantPath || file.Filename != path.Base(tt.wantPath) {
+				t.Fatalf("uploaded file = path %q, filename %q, want %q", file.Path, file.Filename, tt.wantPath)
+			}
+
+			files, err := s.GetFiles("ws", []string{file.ID}, nil)
+			if err != nil {
+				t.Fatalf("GetFiles() error = %v", err)
+			}
+			merged, err := s.MergeFiles(files, MergeOptions{})
+			if err != nil {
+				t.Fatalf("MergeFiles() error = %v", err)
+			}
+			if header := "// " + tt.wantPath + "\n"; !strings.HasPrefix(merged, header) {
+				t.Fatalf("merged output starts with %q, want header %q", strings.SplitN(merged, "\n", 2)[0], header)
+			}
+		})
+	}
+}
+
+func TestGetFilesRenames(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+
+	var ids []string
+	for _, name := range []string{"cmd/main.go", "pkg/main.go", "README.md"} {
+		file, err := s.ProcessFile("ws", name, []byte("content of "+name+"\n"))
+		if err != nil {
+			t.Fatalf("ProcessFile(%s) error = %v", name, err)
+		}
+		ids = append(ids, file.ID)
+	}
+	cmdMain, pkgMain, readme := ids[0], ids[1], ids[2]
+
+	tests := []struct {
+		name      string
+		renames   map[string]string
+		wantPaths []string // Пути файлов в порядке ids
+		wantErr   error
+	}{
+		{
+			name:      "no renames",
+			wantPaths: []string{"cmd/main.go", "pkg/main.go", "README.md"},
+		},
+		{
+			name:      "by id renames one file in its directory",
+			renames:   map[string]string{cmdMain: "app.go"},
+			wantPaths: []string{"cmd/app.go", "pkg/main.go", "README.md"},
+		},
+		{
+			name:      "by id with directories moves the file",
+			renames:   map[string]string{cmdMain: "internal/app.go"},
+			wantPaths: []string{"internal/app.go", "pkg/main.go", "README.md"},
+		},
+		{
+			name:      "by path",
+			renames:   map[string]string{"pkg/main.go": "lib/core.go"},
+			wantPaths: []string{"cmd/main.go", "lib/core.go", "README.md"},
+		},
+		{
+			name:      "by filename renames every file with the name",
+			renames:   map[string]string{"main.go": "app.go"},
+			wantPaths: []string{"cmd/app.go", "pkg/app.go", "README.md"},
+		},
+		{
+			name:      "id wins over path and filename",
+			renames:   map[string]string{cmdMain: "by_id.go", "cmd/main.go": "by_path.go", "main.go": "by_name.go"},
+			wantPaths: []string{"cmd/by_id.go", "pkg/by_name.go", "README.md"},
+		},
+		{
+			name:      "path wins over filename",
+			renames:   map[string]string{"pkg/main.go": "pkg/by_path.go", "main.go": "by_name.go"},
+			wantPaths: []string{"cmd/by_name.go", "pkg/by_path.go", "README.md"},
+		},
+		{
+			name:      "clashing renames of the same name",
+			renames:   map[string]string{cmdMain: "first.go", pkgMain: "second.go", "main.go": "unused.go"},
+			wantPaths: []string{"cmd/first.go", "pkg/second.go", "README.md"},
+		},
+		{
+			name:    "unknown filename",
+			renames: map[string]string{"missing.go": "x.go"},
+			wantErr: ErrUnknownRename,
+		},
+		{
+			name:    "unknown id",
+			renames: map[string]string{"file_0": "x.go", readme: "README.txt"},
+			wantErr: ErrUnknownRename,
+		},
+		{
+			name:    "path of a file not in the request",
+			renames: map[string]string{"docs/README.md": "x.md"},
+			wantErr: ErrUnknownRename,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := s.GetFiles("ws", ids, tt.renames)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetFiles() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetFiles() error = %v", err)
+			}
+
+			originals := []string{"main.go", "main.go", "README.md"}
+			for i, file := range files {
+				if file.Path != tt.wantPaths[i] {
+					t.Fatalf("file %d path = %q, want %q", i, file.Path, tt.wantPaths[i])
+				}
+				if want := path.Base(tt.wantPaths[i]); file.Filename != want {
+					t.Fatalf("file %d filename = %q, want %q", i, file.Filename, want)
+				}
+				if file.OriginalFilename != originals[i] || file.ID != ids[i] {
+					t.Fatalf("file %d = id %q, original %q, want %q, %q", i, file.ID, file.OriginalFilename, ids[i], originals[i])
+				}
+			}
+		})
+	}
+}
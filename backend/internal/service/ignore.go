@@ -0,0 +1,194 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит правила исключения файлов в формате .gitignore.
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// Файлы с правилами исключения
+const (
+	GitignoreFile = ".gitignore"        // Правила исключения git
+	IgnoreFile    = ".codemergerignore" // Правила исключения code-merger, важнее правил .gitignore
+)
+
+// ignoreRule представляет правило файла исключений
+type ignoreRule struct {
+	source  string // Путь файла с правилом
+	line    int    // Номер строки в файле
+	pattern string // Исходный текст правила
+	base    string // Каталог файла с правилом ("" - корень)
+	glob    string // Шаблон doublestar относительно base
+	negate  bool   // Правило с ! возвращает ранее исключенный путь
+	dirOnly bool   // Правило с / в конце применяется только к каталогам
+}
+
+// String возвращает правило в формате git check-ignore -v: <файл>:<строка>:<правило>
+func (r ignoreRule) String() string {
+	return fmt.Sprintf("%s:%d:%s", r.source, r.line, r.pattern)
+}
+
+// matches проверяет, соответствует ли путь правилу без учета отрицания
+func (r ignoreRule) matches(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel := name
+	if r.base != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(name, r.base+"/"); !ok {
+			return false
+		}
+	}
+	matched, _ := doublestar.Match(r.glob, rel)
+	return matched
+}
+
+// ignoreMatcher определяет, исключен ли путь правилами .gitignore и .codemergerignore.
+// Как и в git, путь внутри исключенного каталога не может быть возвращен отрицанием.
+type ignoreMatcher struct {
+	gitignore []ignoreRule // Правила .gitignore от корневых к вложенным
+	project   []ignoreRule // Правила .codemergerignore от корневых к вложенным
+}
+
+// newIgnoreMatcher создает ignoreMatcher со встроенным исключением каталога .git
+func newIgnoreMatcher() *ignoreMatcher {
+	m := &ignoreMatcher{}
+	m.addRules("(built-in)", "", []byte(".git/"), &m.gitignore)
+	return m
+}
+
+// isIgnoreFile проверяет, является ли файл файлом правил исключения
+func isIgnoreFile(name string) bool {
+	base := path.Base(name)
+	return base == GitignoreFile || base == IgnoreFile
+}
+
+// add добавляет правила файла исключений с путем source относительно корня.
+// Правила действуют в каталоге файла и его подкаталогах.
+func (m *ignoreMatcher) add(source string, content []byte) {
+	base := path.Dir(source)
+	if base == "." {
+		base = ""
+	}
+
+	switch path.Base(source) {
+	case IgnoreFile:
+		m.addRules(source, base, content, &m.project)
+	case GitignoreFile:
+		m.addRules(source, base, content, &m.gitignore)
+	}
+}
+
+// addRules разбирает файл исключений и добавляет правила в rules
+func (m *ignoreMatcher) addRules(source, base string, content []byte, rules *[]ignoreRule) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			rule.source, rule.line, rule.base = source, line, base
+			*rules = append(*rules, rule)
+		}
+	}
+	// Правила вложенных каталогов проверяются позже и поэтому важнее
+	sort.SliceStable(*rules, func(i, j int) bool {
+		return ignoreDepth((*rules)[i].base) < ignoreDepth((*rules)[j].base)
+	})
+}
+
+// match проверяет, исключен ли путь, и возвращает исключенный путь (сам путь или
+// его каталог) и исключившее его правило
+func (m *ignoreMatcher) match(name string, isDir bool) (string, ignoreRule, bool) {
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		if rule, ignored := m.decide(prefix, isDir || i < len(parts)-1); ignored {
+			return prefix, rule, true
+		}
+	}
+	return "", ignoreRule{}, false
+}
+
+// decide применяет последнее подходящее правило: сначала .codemergerignore, затем .gitignore
+func (m *ignoreMatcher) decide(name string, isDir bool) (ignoreRule, bool) {
+	for _, rules := range [][]ignoreRule{m.project, m.gitignore} {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].matches(name, isDir) {
+				return rules[i], !rules[i].negate
+			}
+		}
+	}
+	return ignoreRule{}, false
+}
+
+// parseIgnoreRule разбирает строку файла исключений. Пустые строки, комментарии
+// и некорректные шаблоны пропускаются.
+func parseIgnoreRule(text string) (ignoreRule, bool) {
+	text = strings.TrimSuffix(text, "\r")
+	// Пробелы в конце отбрасываются, если не экранированы
+	for strings.HasSuffix(text, " ") && !strings.HasSuffix(text, `\ `) {
+		text = text[:len(text)-1]
+	}
+	if text == "" || strings.HasPrefix(text, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{pattern: text}
+	if strings.HasPrefix(text, "!") {
+		rule.negate = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, `\!`) || strings.HasPrefix(text, `\#`) {
+		text = text[1:]
+	}
+	if strings.HasSuffix(text, "/") {
+		rule.dirOnly = true
+		text = strings.TrimSuffix(text, "/")
+	}
+	if text == "" {
+		return ignoreRule{}, false
+	}
+
+	// Шаблон со / в начале или середине привязан к каталогу файла правил,
+	// без / - соответствует имени на любой глубине
+	anchored := strings.Contains(text, "/")
+	text = strings.TrimPrefix(text, "/")
+	// Фигурные скобки в .gitignore не имеют особого значения
+	text = strings.NewReplacer("{", `\{`, "}", `\}`).Replace(text)
+	if !anchored {
+		text = "**/" + text
+	}
+	// В .gitignore "dir/**" соответствует содержимому каталога, но не ему самому
+	if strings.HasSuffix(text, "/**") {
+		text += "/*"
+	}
+	if !doublestar.ValidatePattern(text) {
+		return ignoreRule{}, false
+	}
+
+	rule.glob = text
+	return rule, true
+}
+
+// ignoreDepth возвращает глубину каталога файла правил
+func ignoreDepth(base string) int {
+	if base == "" {
+		return 0
+	}
+	return strings.Count(base, "/") + 1
+}
+
+// ignoredEntry возвращает пропущенный элемент для пути, исключенного правилом
+func ignoredEntry(name string, rule ignoreRule) SkippedEntry {
+	return SkippedEntry{
+		Path:   name,
+		Code:   ReasonIgnored,
+		Reason: fmt.Sprintf("ignored by %s", rule),
+		Rule:   rule.String(),
+	}
+}
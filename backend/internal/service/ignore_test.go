@@ -0,0 +1,218 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты правил исключения файлов в формате .gitignore.
+package service
+
+import "testing"
+
+func TestParseIgnoreRule(t *testing.T) {
+	tests := []struct {
+		text        string
+		wantOK      bool
+		wantGlob    string
+		wantNegate  bool
+		wantDirOnly bool
+	}{
+		{text: "", wantOK: false},
+		{text: "# comment", wantOK: false},
+		{text: "   ", wantOK: false},
+		{text: "!", wantOK: false},
+		{text: "/", wantOK: false},
+		{text: "*.log", wantOK: true, wantGlob: "**/*.log"},
+		{text: "*.log   ", wantOK: true, wantGlob: "**/*.log"},
+		{text: "*.log\r", wantOK: true, wantGlob: "**/*.log"},
+		{text: `name\ `, wantOK: true, wantGlob: `**/name\ `},
+		{text: "/build", wantOK: true, wantGlob: "build"},
+		{text: "docs/*.md", wantOK: true, wantGlob: "docs/*.md"},
+		{text: "logs/", wantOK: true, wantGlob: "**/logs", wantDirOnly: true},
+		{text: "/out/", wantOK: true, wantGlob: "out", wantDirOnly: true},
+		{text: "!keep.log", wantOK: true, wantGlob: "**/keep.log", wantNegate: true},
+		{text: `\!bang`, wantOK: true, wantGlob: "**/!bang"},
+		{text: `\#hash`, wantOK: true, wantGlob: "**/#hash"},
+		{text: "{a,b}.txt", wantOK: true, wantGlob: `**/\{a,b\}.txt`},
+		{text: "dist/**", wantOK: true, wantGlob: "dist/**/*"},
+		{text: "**/cache", wantOK: true, wantGlob: "**/cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			rule, ok := parseIgnoreRule(tt.text)
+			if ok != tt.wantOK {
+				t.Fatalf("parseIgnoreRule(%q) ok = %v, want %v", tt.text, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if rule.glob != tt.wantGlob || rule.negate != tt.wantNegate || rule.dirOnly != tt.wantDirOnly {
+				t.Fatalf("parseIgnoreRule(%q) = glob %q, negate %v, dirOnly %v, want %q, %v, %v",
+					tt.text, rule.glob, rule.negate, rule.dirOnly, tt.wantGlob, tt.wantNegate, tt.wantDirOnly)
+			}
+		})
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string // Файл правил -> содержимое
+		path        string
+		isDir       bool
+		wantIgnored string // Исключенный путь (пусто, если путь не исключен)
+		wantRule    string
+	}{
+		// Привязка шаблонов
+		{
+			name:        "unanchored pattern matches at any depth",
+			files:       map[string]string{".gitignore": "*.log"},
+			path:        "a/b/debug.log",
+			wantIgnored: "a/b/debug.log",
+			wantRule:    ".gitignore:1:*.log",
+		},
+		{
+			name:        "leading slash anchors to the root",
+			files:       map[string]string{".gitignore": "/build"},
+			path:        "build/main.go",
+			wantIgnored: "build",
+			wantRule:    ".gitignore:1:/build",
+		},
+		{
+			name:  "anchored pattern does not match deeper",
+			files: map[string]string{".gitignore": "/build"},
+			path:  "src/build/main.go",
+		},
+		{
+			name:        "middle slash anchors to the root",
+			files:       map[string]string{".gitignore": "docs/*.md"},
+			path:        "docs/api.md",
+			wantIgnored: "docs/api.md",
+			wantRule:    ".gitignore:1:docs/*.md",
+		},
+		{
+			name:  "middle slash pattern does not match deeper",
+			files: map[string]string{".gitignore": "docs/*.md"},
+			path:  "pkg/docs/api.md",
+		},
+		{
+			name:        "directory pattern matches the directory",
+			files:       map[string]string{".gitignore": "logs/"},
+			path:        "src/logs/today.txt",
+			wantIgnored: "src/logs",
+			wantRule:    ".gitignore:1:logs/",
+		},
+		{
+			name:  "directory pattern does not match a file",
+			files: map[string]string{".gitignore": "logs/"},
+			path:  "src/logs",
+		},
+		{
+			name:        "double star suffix matches the contents",
+			files:       map[string]string{".gitignore": "dist/**"},
+			path:        "dist/js/app.js",
+			wantIgnored: "dist/js",
+			wantRule:    ".gitignore:1:dist/**",
+		},
+		{
+			name:  "double star suffix does not match the directory itself",
+			files: map[string]string{".gitignore": "dist/**"},
+			path:  "dist",
+			isDir: true,
+		},
+		{
+			name:        "nested rules are anchored to their directory",
+			files:       map[string]string{"web/.gitignore": "/build"},
+			path:        "web/build/app.js",
+			wantIgnored: "web/build",
+			wantRule:    "web/.gitignore:1:/build",
+		},
+		{
+			name:  "nested rules do not apply outside their directory",
+			files: map[string]string{"web/.gitignore": "*.tmp"},
+			path:  "cache.tmp",
+		},
+
+		// Отрицание
+		{
+			name:  "negation re-includes a file",
+			files: map[string]string{".gitignore": "*.log\n!keep.log"},
+			path:  "keep.log",
+		},
+		{
+			name:        "later rule wins over negation",
+			files:       map[string]string{".gitignore": "!keep.log\n*.log"},
+			path:        "keep.log",
+			wantIgnored: "keep.log",
+			wantRule:    ".gitignore:2:*.log",
+		},
+		{
+			name:        "negation cannot re-include inside an excluded directory",
+			files:       map[string]string{".gitignore": "node_modules/\n!node_modules/keep.js"},
+			path:        "node_modules/keep.js",
+			wantIgnored: "node_modules",
+			wantRule:    ".gitignore:1:node_modules/",
+		},
+
+		// Приоритет файлов правил
+		{
+			name:  "nested negation overrides root rule",
+			files: map[string]string{".gitignore": "*.txt", "docs/.gitignore": "!notes.txt"},
+			path:  "docs/notes.txt",
+		},
+		{
+			name:        "root rule still applies outside the nested directory",
+			files:       map[string]string{".gitignore": "*.txt", "docs/.gitignore": "!notes.txt"},
+			path:        "notes.txt",
+			wantIgnored: "notes.txt",
+			wantRule:    ".gitignore:1:*.txt",
+		},
+		{
+			name:        "nested rule overrides root negation",
+			files:       map[string]string{".gitignore": "!*.gen.go", "api/.gitignore": "*.gen.go"},
+			path:        "api/types.gen.go",
+			wantIgnored: "api/types.gen.go",
+			wantRule:    "api/.gitignore:1:*.gen.go",
+		},
+		{
+			name:  "codemergerignore negation overrides gitignore",
+			files: map[string]string{".gitignore": "*.gen.go", "api/.gitignore": "*.gen.go", ".codemergerignore": "!*.gen.go"},
+			path:  "api/types.gen.go",
+		},
+		{
+			name:        "codemergerignore excludes files kept by gitignore",
+			files:       map[string]string{".gitignore": "!*.lock", ".codemergerignore": "*.lock"},
+			path:        "go.lock",
+			wantIgnored: "go.lock",
+			wantRule:    ".codemergerignore:1:*.lock",
+		},
+		{
+			name:        "built-in .git directory",
+			files:       map[string]string{},
+			path:        "sub/.git/config",
+			wantIgnored: "sub/.git",
+			wantRule:    "(built-in):1:.git/",
+		},
+		{
+			name:  "braces are literal",
+			files: map[string]string{".gitignore": "{a,b}.txt"},
+			path:  "a.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newIgnoreMatcher()
+			for source, content := range tt.files {
+				m.add(source, []byte(content))
+			}
+
+			ignored, rule, ok := m.match(tt.path, tt.isDir)
+			if ok != (tt.wantIgnored != "") {
+				t.Fatalf("match(%q) ignored = %v (%s), want %v", tt.path, ok, rule, tt.wantIgnored != "")
+			}
+			if !ok {
+				return
+			}
+			if ignored != tt.wantIgnored || rule.String() != tt.wantRule {
+				t.Fatalf("match(%q) = %q by %s, want %q by %s", tt.path, ignored, rule, tt.wantIgnored, tt.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит логику загрузки файлов из каталогов сервера.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+var (
+	// ErrIngestDisabled возвращается, если каталоги для загрузки с диска не настроены (INGEST_ROOTS)
+	ErrIngestDisabled = errors.New("directory ingestion is disabled")
+	// ErrRootNotAllowed возвращается, если каталог не входит в INGEST_ROOTS
+	ErrRootNotAllowed = errors.New("directory is not allowed for ingestion")
+	// ErrInvalidPattern возвращается, если шаблон отбора файлов некорректен
+	ErrInvalidPattern = errors.New("invalid glob pattern")
+)
+
+// IngestRequest задает каталог сервера и правила отбора файлов.
+// Шаблоны применяются к пути относительно каталога и поддерживают ** для любого числа каталогов.
+type IngestRequest struct {
+	Root    string   `json:"root"`    // Каталог из INGEST_ROOTS или его подкаталог (необязателен, если в INGEST_ROOTS один каталог)
+	Include []string `json:"include"` // Шаблоны включаемых файлов (пустой список - все файлы)
+	Exclude []string `json:"exclude"` // Шаблоны исключаемых файлов и каталогов
+}
+
+// IngestDirectory обходит каталог сервера и сохраняет отобранные файлы в рабочее
+// пространство так же, как загруженные: с проверкой, конвертацией в UTF-8 и лимитами
+// MAX_FILE_SIZE и MAX_TOTAL_SIZE. Файлы читаются через os.Root, поэтому символические
+// ссылки за пределы каталога не открываются; такие ссылки и ссылки на каталоги пропускаются.
+// Файлы и каталоги, исключенные правилами .gitignore и .codemergerignore, не обходятся.
+// Возвращает принятые файлы и пропущенные файлы с причинами.
+func (s *FileService) IngestDirectory(workspaceID string, req IngestRequest) ([]UploadedFile, []SkippedEntry, error) {
+	root, err := s.resolveIngestRoot(req.Root)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, pattern := range append(append([]string(nil), req.Include...), req.Exclude...) {
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPattern, pattern)
+		}
+	}
+
+	dir, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open directory %s: %v", root, err)
+	}
+	defer dir.Close()
+
+	var files []UploadedFile
+	var skipped []SkippedEntry
+	totalSize := int64(0)
+	skip := func(name, code, reason string) {
+		skipped = append(skipped, SkippedEntry{Path: name, Code: code, Reason: reason})
+	}
+	ignore := newIgnoreMatcher()
+	known := s.NewWorkspaceContent()
+
+	err = fs.WalkDir(dir.FS(), ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if name == "." {
+				return err
+			}
+			skip(name, ReasonReadFailed, err.Error())
+			return nil
+		}
+
+		if entry.IsDir() {
+			if name != "." {
+				if matchAnyPattern(req.Exclude, name) {
+					return fs.SkipDir
+				}
+				if _, rule, ok := ignore.match(name, true); ok {
+					skipped = append(skipped, ignoredEntry(name+"/", rule))
+					return fs.SkipDir
+				}
+			}
+			// Правила каталога читаются до обхода его содержимого
+			for _, source := range []string{path.Join(name, GitignoreFile), path.Join(name, IgnoreFile)} {
+				content, err := s.readIgnoreFile(dir, source)
+				if err != nil {
+					skip(source, ReasonReadFailed, err.Error())
+					continue
+				}
+				ignore.add(source, content)
+			}
+			return nil
+		}
+		if isIgnoreFile(name) || len(req.Include) > 0 && !matchAnyPattern(req.Include, name) || matchAnyPattern(req.Exclude, name) {
+			return nil
+		}
+		if _, rule, ok := ignore.match(name, false); ok {
+			skipped = append(skipped, ignoredEntry(name, rule))
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			skip(name, ReasonReadFailed, err.Error())
+			return nil
+		}
+		if entry.Type()&fs.ModeSymlink != 0 {
+			// Ссылка разрешается вне os.Root только для проверки, куда она ведет
+			target, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+			if err != nil {
+				skip(name, ReasonReadFailed, fmt.Sprintf("failed to resolve symlink: %v", err))
+				return nil
+			}
+			if !withinDir(root, target) {
+				skip(name, ReasonSymlinkEscapesRoot, "symlink points outside of the directory")
+				return nil
+			}
+			if info, err = dir.Stat(name); err != nil {
+				skip(name, ReasonReadFailed, err.Error())
+				return nil
+			}
+		}
+
+		switch {
+		case !info.Mode().IsRegular():
+			skip(name, ReasonNotRegularFile, "not a regular file")
+		case info.Size() > s.cfg.MaxFileSize:
+			skip(name, ReasonFileTooLarge, fmt.Sprintf("file exceeds maximum size limit of %d bytes", s.cfg.MaxFileSize))
+		case totalSize+info.Size() > s.cfg.MaxTotalSize:
+			skip(name, ReasonTotalSizeExceeded, fmt.Sprintf("total size of files exceeds limit of %d bytes", s.cfg.MaxTotalSize))
+		default:
+			file, err := s.ingestFile(dir, workspaceID, name, known)
+			if err != nil {
+				skip(name, ReasonCode(err), err.Error())
+				return nil
+			}
+			totalSize += info.Size()
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to walk directory %s: %v", root, err)
+	}
+
+	return files, skipped, nil
+}
+
+// ingestFile читает файл каталога и обрабатывает его как загруженный
+func (s *FileService) ingestFile(dir *os.Root, workspaceID, name string, known *WorkspaceContent) (UploadedFile, error) {
+	file, err := dir.Open(name)
+	if err != nil {
+		return UploadedFile{}, fmt.Errorf("%w: %w", ErrReadFailed, err)
+	}
+	defer file.Close()
+
+	return s.ProcessReader(workspaceID, name, file, known)
+}
+
+// readIgnoreFile читает файл правил исключения каталога. Отсутствующий файл не является ошибкой.
+func (s *FileService) readIgnoreFile(dir *os.Root, name string) ([]byte, error) {
+	file, err := dir.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file: %v", err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, s.cfg.MaxFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file: %v", err)
+	}
+	return content, nil
+}
+
+// resolveIngestRoot проверяет, что каталог входит в INGEST_ROOTS, и возвращает
+// его абсолютный путь без символических ссылок
+func (s *FileService) resolveIngestRoot(requested string) (string, error) {
+	if len(s.cfg.IngestRoots) == 0 {
+		return "", ErrIngestDisabled
+	}
+	if requested == "" {
+		if len(s.cfg.IngestRoots) > 1 {
+			return "", fmt.Errorf("%w: root is required when several directories are configured", ErrRootNotAllowed)
+		}
+		requested = s.cfg.IngestRoots[0]
+	}
+
+	root, err := resolveDir(requested)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRootNotAllowed, err)
+	}
+	for _, allowed := range s.cfg.IngestRoots {
+		allowedRoot, err := resolveDir(allowed)
+		if err == nil && withinDir(allowedRoot, root) {
+			return root, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrRootNotAllowed, requested)
+}
+
+// resolveDir возвращает абсолютный путь каталога без символических ссылок
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// withinDir проверяет, совпадает ли путь с каталогом или находится внутри него
+func withinDir(dir, target string) bool {
+	return target == dir || strings.HasPrefix(target, dir+string(filepath.Separator))
+}
+
+// matchAnyPattern проверяет, соответствует ли путь хотя бы одному шаблону
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := doublestar.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты загрузки файлов из каталогов сервера и защиты от выхода за их пределы.
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// writeTestFiles создает файлы с содержимым в каталоге
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+}
+
+// symlink создает символическую ссылку или пропускает тест, если ссылки не поддерживаются
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+}
+
+// newIngestTest создает каталог для загрузки и каталог рядом с ним, недоступный для загрузки
+func newIngestTest(t *testing.T) (*FileService, string, string) {
+	t.Helper()
+
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	writeTestFiles(t, root, map[string]string{"main.go": "package main\n", "pkg/util.go": "package pkg\n"})
+	writeTestFiles(t, outside, map[string]string{"secret.go": "package secret\n"})
+
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	s.cfg.IngestRoots = []string{root}
+	return s, root, outside
+}
+
+// ingestedPaths возвращает отсортированные пути принятых файлов
+func ingestedPaths(files []UploadedFile) []string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIngestDirectorySkipsEscapingSymlinks(t *testing.T) {
+	s, root, outside := newIngestTest(t)
+	symlink(t, filepath.Join(outside, "secret.go"), filepath.Join(root, "leak.go"))
+	symlink(t, outside, filepath.Join(root, "leakdir"))
+	symlink(t, "../../outside/secret.go", filepath.Join(root, "pkg", "relative.go"))
+	symlink(t, "main.go", filepath.Join(root, "alias.go"))
+
+	files, skipped, err := s.IngestDirectory("ws", IngestRequest{})
+	if err != nil {
+		t.Fatalf("IngestDirectory() error = %v", err)
+	}
+
+	want := []string{"alias.go", "main.go", "pkg/util.go"}
+	if got := ingestedPaths(files); !slices.Equal(got, want) {
+		t.Fatalf("ingested = %v, want %v", got, want)
+	}
+
+	reasons := make(map[string]string)
+	for _, entry := range skipped {
+		reasons[entry.Path] = entry.Code
+	}
+	for _, name := range []string{"leak.go", "leakdir", "pkg/relative.go"} {
+		if reasons[name] != ReasonSymlinkEscapesRoot {
+			t.Fatalf("skipped %s with %q, want %q (skipped: %+v)", name, reasons[name], ReasonSymlinkEscapesRoot, skipped)
+		}
+	}
+
+	stored, err := s.ListFiles(storage.ListFilter{SessionID: "ws"})
+	if err != nil {
+		t.Fatalf("ListFiles() error = %v", err)
+	}
+	if len(stored) != len(want) {
+		t.Fatalf("stored %d files, want %d", len(stored), len(want))
+	}
+}
+
+func TestIngestDirectoryRootEscape(t *testing.T) {
+	s, root, outside := newIngestTest(t)
+	symlink(t, outside, filepath.Join(root, "link"))
+	if err := os.MkdirAll(root+"2", 0o755); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		root string
+	}{
+		{name: "parent directory", root: filepath.Join(root, "..")},
+		{name: "dot dot inside path", root: root + string(filepath.Separator) + ".." + string(filepath.Separator) + "outside"},
+		{name: "absolute path outside", root: outside},
+		{name: "symlinked subdirectory", root: filepath.Join(root, "link")},
+		{name: "sibling with common prefix", root: root + "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.IngestDirectory("ws", IngestRequest{Root: tt.root}); !errors.Is(err, ErrRootNotAllowed) {
+				t.Fatalf("IngestDirectory(%s) error = %v, want %v", tt.root, err, ErrRootNotAllowed)
+			}
+		})
+	}
+
+	t.Run("subdirectory", func(t *testing.T) {
+		files, _, err := s.IngestDirectory("ws", IngestRequest{Root: filepath.Join(root, "pkg")})
+		if err != nil || len(files) != 1 || files[0].Path != "util.go" {
+			t.Fatalf("IngestDirectory() = %+v, %v, want util.go", files, err)
+		}
+	})
+}
+
+func TestIngestDirectoryIncludeCannotEscape(t *testing.T) {
+	s, _, outside := newIngestTest(t)
+
+	// Шаблоны сопоставляются с путями внутри каталога, поэтому абсолютные пути
+	// и .. не отбирают файлы за его пределами
+	patterns := [][]string{
+		{filepath.ToSlash(filepath.Join(outside, "*.go"))},
+		{"/**/*.go"},
+		{"../outside/*.go"},
+		{"../**"},
+	}
+	for _, include := range patterns {
+		t.Run(include[0], func(t *testing.T) {
+			files, _, err := s.IngestDirectory("ws", IngestRequest{Include: include})
+			if err != nil {
+				t.Fatalf("IngestDirectory() error = %v", err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("IngestDirectory() ingested %v, want nothing", ingestedPaths(files))
+			}
+		})
+	}
+}
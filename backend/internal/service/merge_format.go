@@ -0,0 +1,291 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит форматы вывода объединенного файла.
+package service
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MergeFormat определяет формат объединенного файла
+type MergeFormat string
+
+const (
+	FormatComments MergeFormat = "comments" // Заголовки в комментариях (по умолчанию)
+	FormatMarkdown MergeFormat = "markdown" // Заголовки Markdown и блоки кода
+	FormatXML      MergeFormat = "xml"      // Документы в XML-обертке для промптов LLM
+	FormatJSON     MergeFormat = "json"     // JSON-массив файлов с метаданными
+	FormatJSONL    MergeFormat = "jsonl"    // JSON Lines: один объект файла на строку
+	FormatTemplate MergeFormat = "template" // Пользовательский шаблон text/template
+)
+
+// ContentType возвращает MIME-тип объединенного файла для формата
+func (f MergeFormat) ContentType() string {
+	switch f {
+	case FormatJSON:
+		return "application/json"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// MergeOptions содержит параметры объединения файлов
+type MergeOptions struct {
+	Format          MergeFormat // Формат вывода
+	Template        string      // Исходный текст шаблона (для формата template)
+	TemplateName    string      // Имя зарегистрированного на сервере шаблона (для формата template)
+	TableOfContents bool        // Добавить дерево каталогов и оглавление перед файлами
+	OutputFilename  string      // Имя выходного файла (определяет синтаксис комментария оглавления)
+
+	deadline time.Time // Общий срок отрисовки шаблона для всех вызовов MergeFiles одного запроса
+}
+
+// mergeFormatter форматирует части объединенного файла
+type mergeFormatter interface {
+	preamble(files []FileContent) (string, error)     // Текст перед первым файлом
+	file(index int, file FileContent) (string, error) // Заголовок и содержимое файла
+	separator() (string, error)                       // Разделитель между файлами
+	footer(files []FileContent) (string, error)       // Текст после последнего файла
+}
+
+// newFormatter создает форматтер для указанного формата
+func (s *FileService) newFormatter(opts MergeOptions) (mergeFormatter, error) {
+	if opts.Format != FormatTemplate && (opts.Template != "" || opts.TemplateName != "") {
+		return nil, fmt.Errorf("template can only be used with %s format", FormatTemplate)
+	}
+
+	switch opts.Format {
+	case "", FormatComments:
+		return &commentsFormatter{service: s}, nil
+	case FormatMarkdown:
+		return &markdownFormatter{validationService: s.validationService}, nil
+	case FormatXML:
+		return &xmlFormatter{}, nil
+	case FormatJSON:
+		return &jsonFormatter{validationService: s.validationService}, nil
+	case FormatJSONL:
+		return &jsonFormatter{validationService: s.validationService, lines: true}, nil
+	case FormatTemplate:
+		return s.newTemplateFormatter(opts)
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", opts.Format)
+	}
+}
+
+// commentsFormatter выводит заголовок файла в комментарии соответствующего языка
+type commentsFormatter struct {
+	service *FileService
+}
+
+// preamble реализует mergeFormatter
+func (f *commentsFormatter) preamble([]FileContent) (string, error) {
+	return "", nil
+}
+
+// separator реализует mergeFormatter
+func (f *commentsFormatter) separator() (string, error) {
+	return "\n\n\n", nil
+}
+
+// footer реализует mergeFormatter
+func (f *commentsFormatter) footer([]FileContent) (string, error) {
+	return "", nil
+}
+
+// file реализует mergeFormatter
+func (f *commentsFormatter) file(_ int, file FileContent) (string, error) {
+	// Получаем префикс комментария для файла
+	prefix := f.service.validationService.GetCommentPrefix(file.Filename)
+
+	return f.service.formatFileHeader(prefix, file.Title()) + file.Content, nil
+}
+
+// markdownFormatter выводит файл как заголовок Markdown и блок кода
+type markdownFormatter struct {
+	validationService *ValidationService
+}
+
+// preamble реализует mergeFormatter
+func (f *markdownFormatter) preamble([]FileContent) (string, error) {
+	return "", nil
+}
+
+// separator реализует mergeFormatter
+func (f *markdownFormatter) separator() (string, error) {
+	return "\n", nil
+}
+
+// footer реализует mergeFormatter
+func (f *markdownFormatter) footer([]FileContent) (string, error) {
+	return "", nil
+}
+
+// file реализует mergeFormatter
+func (f *markdownFormatter) file(_ int, file FileContent) (string, error) {
+	// Ограждение длиннее любой последовательности обратных кавычек в содержимом,
+	// чтобы вложенные блоки кода не закрывали внешний
+	fence := strings.Repeat("`", max(3, longestRun(file.Content, '`')+1))
+	language := f.validationService.GetLanguage(file.Filename)
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "### %s\n\n", file.Title())
+	fmt.Fprintf(&result, "%s%s\n", fence, language)
+	result.WriteString(file.Content)
+	if !strings.HasSuffix(file.Content, "\n") {
+		result.WriteString("\n")
+	}
+	fmt.Fprintf(&result, "%s\n", fence)
+	return result.String(), nil
+}
+
+// xmlFormatter выводит файлы как элементы <document> внутри корневого <documents>
+type xmlFormatter struct{}
+
+// preamble реализует mergeFormatter
+func (f *xmlFormatter) preamble([]FileContent) (string, error) {
+	return "<documents>\n", nil
+}
+
+// separator реализует mergeFormatter
+func (f *xmlFormatter) separator() (string, error) {
+	return "\n", nil
+}
+
+// footer реализует mergeFormatter
+func (f *xmlFormatter) footer([]FileContent) (string, error) {
+	return "\n</documents>\n", nil
+}
+
+// file реализует mergeFormatter
+func (f *xmlFormatter) file(index int, file FileContent) (string, error) {
+	var source strings.Builder
+	xml.EscapeText(&source, []byte(file.DisplayName()))
+
+	var result strings.Builder
+	if file.Part > 0 {
+		fmt.Fprintf(&result, "<document index=\"%d\" part=\"%d\">\n", index+1, file.Part)
+	} else {
+		fmt.Fprintf(&result, "<document index=\"%d\">\n", index+1)
+	}
+	fmt.Fprintf(&result, "<source>%s</source>\n", source.String())
+	fmt.Fprintf(&result, "<document_content>%s</document_content>\n", cdata(file.Content))
+	result.WriteString("</document>")
+	return result.String(), nil
+}
+
+// cdata оборачивает текст в секцию CDATA.
+// Последовательность "]]>" внутри текста разбивается на две секции, чтобы не закрыть секцию раньше времени.
+// Символы, недопустимые в XML 1.0 (управляющие, кроме табуляции и переводов строк), не могут
+// быть записаны даже в CDATA и заменяются на U+FFFD, как это делает xml.EscapeText.
+func cdata(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if isXMLChar(r) {
+			return r
+		}
+		return '\uFFFD'
+	}, text)
+	return "<![CDATA[" + strings.ReplaceAll(text, "]]>", "]]]]><![CDATA[>") + "]]>"
+}
+
+// isXMLChar проверяет, допустим ли символ в документе XML 1.0
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// jsonFormatter выводит файлы как JSON-объекты с метаданными:
+// JSON-массивом либо в формате JSON Lines
+type jsonFormatter struct {
+	validationService *ValidationService
+	lines             bool
+}
+
+// jsonFile представляет файл в форматах json и jsonl
+type jsonFile struct {
+	Path             string `json:"path"`              // Относительный путь (с учетом переименования)
+	OriginalFilename string `json:"original_filename"` // Имя файла при загрузке
+	Language         string `json:"language"`          // Язык файла
+	Encoding         string `json:"encoding"`          // Исходная кодировка файла
+	Size             int64  `json:"size"`              // Размер содержимого в байтах
+	LineCount        int    `json:"line_count"`        // Количество строк
+	Part             int    `json:"part,omitempty"`    // Номер фрагмента файла, разбитого по частям
+	Content          string `json:"content"`           // Содержимое файла в UTF-8
+}
+
+// preamble реализует mergeFormatter
+func (f *jsonFormatter) preamble([]FileContent) (string, error) {
+	if f.lines {
+		return "", nil
+	}
+	return "[\n", nil
+}
+
+// separator реализует mergeFormatter
+func (f *jsonFormatter) separator() (string, error) {
+	if f.lines {
+		return "\n", nil
+	}
+	return ",\n", nil
+}
+
+// footer реализует mergeFormatter
+func (f *jsonFormatter) footer([]FileContent) (string, error) {
+	if f.lines {
+		return "\n", nil
+	}
+	return "\n]\n", nil
+}
+
+// file реализует mergeFormatter
+func (f *jsonFormatter) file(_ int, file FileContent) (string, error) {
+	var result strings.Builder
+	encoder := json.NewEncoder(&result)
+	encoder.SetEscapeHTML(false)
+
+	// Кодирование структуры из строк и чисел не может завершиться ошибкой
+	encoder.Encode(jsonFile{
+		Path:             file.DisplayName(),
+		OriginalFilename: file.OriginalFilename,
+		Language:         f.validationService.GetLanguage(file.Filename),
+		Encoding:         file.Encoding,
+		Size:             file.Size,
+		LineCount:        countLines(file.Content),
+		Part:             file.Part,
+		Content:          file.Content,
+	})
+
+	return strings.TrimSuffix(result.String(), "\n"), nil
+}
+
+// countLines возвращает количество строк в тексте
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	lines := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	return lines
+}
+
+// longestRun возвращает длину самой длинной последовательности символа c в строке
+func longestRun(content string, c byte) int {
+	longest, current := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == c {
+			current++
+			longest = max(longest, current)
+		} else {
+			current = 0
+		}
+	}
+	return longest
+}
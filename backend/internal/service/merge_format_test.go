@@ -0,0 +1,268 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты форматов вывода объединенного файла и оглавления.
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// testMergeFiles возвращает файлы с содержимым, требующим экранирования во всех форматах
+func testMergeFiles() []FileContent {
+	files := []FileContent{
+		{
+			Filename: "README.md",
+			Path:     "docs/README.md",
+			Content:  "# Title\n\n```go\nfmt.Println(\"```\")\n```\n\n````\nnested\n````\n",
+		},
+		{
+			Filename: "main.go",
+			Path:     "cmd/a&b/<main>.go",
+			Content:  "package main\n\n// ]]> ends CDATA, <tag> & \"quotes\"\nvar s = \"]]]]>\"",
+		},
+		{
+			Filename: "term.sh",
+			Path:     "scripts/term.sh",
+			Content:  "printf '\x1b[1mbold\x1b[0m'\nform\x0cfeed\tand tab\r\n",
+		},
+	}
+	for i := range files {
+		files[i].OriginalFilename = files[i].Filename
+		files[i].Encoding = "UTF-8"
+		files[i].Size = int64(len(files[i].Content))
+	}
+	return files
+}
+
+func TestMergeMarkdownFences(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := testMergeFiles()
+
+	merged, err := s.MergeFiles(files, MergeOptions{Format: FormatMarkdown})
+	if err != nil {
+		t.Fatalf("MergeFiles() error = %v", err)
+	}
+
+	// Разбор блоков кода по правилам CommonMark: блок закрывается строкой
+	// из обратных кавычек не короче открывающей
+	lines := strings.Split(merged, "\n")
+	var got []string
+	for i := 0; i < len(lines); i++ {
+		if !strings.HasPrefix(lines[i], "### ") {
+			continue
+		}
+		path := strings.TrimPrefix(lines[i], "### ")
+		open := lines[i+2]
+		fence := open[:len(open)-len(strings.TrimLeft(open, "`"))]
+		if len(fence) < 3 {
+			t.Fatalf("%s: opening fence %q is shorter than 3 backticks", path, open)
+		}
+
+		var content []string
+		j := i + 3
+		for ; j < len(lines); j++ {
+			trimmed := strings.TrimRight(lines[j], " ")
+			if strings.Trim(trimmed, "`") == "" && len(trimmed) >= len(fence) {
+				break
+			}
+			content = append(content, lines[j])
+		}
+		if j == len(lines) {
+			t.Fatalf("%s: code block is not closed", path)
+		}
+		got = append(got, strings.Join(content, "\n")+"\n")
+		i = j
+	}
+
+	if len(got) != len(files) {
+		t.Fatalf("parsed %d code blocks, want %d:\n%s", len(got), len(files), merged)
+	}
+	for i, file := range files {
+		want := file.Content
+		if !strings.HasSuffix(want, "\n") {
+			want += "\n"
+		}
+		if got[i] != want {
+			t.Fatalf("code block %d = %q, want %q", i, got[i], want)
+		}
+	}
+	if !strings.Contains(merged, "\n`````markdown\n") {
+		t.Fatalf("fence of README.md is not longer than its longest backtick run:\n%s", merged)
+	}
+}
+
+func TestMergeXMLRoundTrip(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := testMergeFiles()
+
+	merged, err := s.MergeFiles(files, MergeOptions{Format: FormatXML})
+	if err != nil {
+		t.Fatalf("MergeFiles() error = %v", err)
+	}
+
+	var parsed struct {
+		XMLName   xml.Name `xml:"documents"`
+		Documents []struct {
+			Index   int    `xml:"index,attr"`
+			Source  string `xml:"source"`
+			Content string `xml:"document_content"`
+		} `xml:"document"`
+	}
+	if err := xml.Unmarshal([]byte(merged), &parsed); err != nil {
+		t.Fatalf("output is not valid XML: %v\n%s", err, merged)
+	}
+
+	if len(parsed.Documents) != len(files) {
+		t.Fatalf("parsed %d documents, want %d", len(parsed.Documents), len(files))
+	}
+	// Символы, недопустимые в XML 1.0, заменяются на U+FFFD; \r нормализуется парсером
+	replacer := strings.NewReplacer("\x1b", "\uFFFD", "\x0c", "\uFFFD", "\r\n", "\n")
+	for i, file := range files {
+		doc := parsed.Documents[i]
+		if doc.Index != i+1 || doc.Source != file.Path {
+			t.Fatalf("document %d = index %d, source %q, want %d, %q", i, doc.Index, doc.Source, i+1, file.Path)
+		}
+		if want := replacer.Replace(file.Content); doc.Content != want {
+			t.Fatalf("document %d content = %q, want %q", i, doc.Content, want)
+		}
+	}
+}
+
+func TestMergeJSONRoundTrip(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := testMergeFiles()
+
+	check := func(t *testing.T, i int, got jsonFile) {
+		t.Helper()
+
+		file := files[i]
+		if got.Path != file.Path || got.OriginalFilename != file.OriginalFilename || got.Content != file.Content ||
+			got.Size != file.Size || got.Encoding != file.Encoding || got.LineCount != countLines(file.Content) {
+			t.Fatalf("file %d = %+v, want %+v", i, got, file)
+		}
+		if got.Language == "" {
+			t.Fatalf("file %d has no language", i)
+		}
+	}
+
+	t.Run("json", func(t *testing.T) {
+		merged, err := s.MergeFiles(files, MergeOptions{Format: FormatJSON})
+		if err != nil {
+			t.Fatalf("MergeFiles() error = %v", err)
+		}
+
+		var parsed []jsonFile
+		if err := json.Unmarshal([]byte(merged), &parsed); err != nil {
+			t.Fatalf("output is not valid JSON: %v\n%s", err, merged)
+		}
+		if len(parsed) != len(files) {
+			t.Fatalf("parsed %d files, want %d", len(parsed), len(files))
+		}
+		for i, got := range parsed {
+			check(t, i, got)
+		}
+	})
+
+	t.Run("jsonl", func(t *testing.T) {
+		merged, err := s.MergeFiles(files, MergeOptions{Format: FormatJSONL})
+		if err != nil {
+			t.Fatalf("MergeFiles() error = %v", err)
+		}
+		if !strings.HasSuffix(merged, "}\n") {
+			t.Fatalf("output does not end with a newline-terminated object: %q", merged)
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(merged))
+		i := 0
+		for ; scanner.Scan(); i++ {
+			var got jsonFile
+			if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+				t.Fatalf("line %d is not a JSON object: %v\n%s", i+1, err, scanner.Text())
+			}
+			if i < len(files) {
+				check(t, i, got)
+			}
+		}
+		if i != len(files) {
+			t.Fatalf("output has %d lines, want %d", i, len(files))
+		}
+	})
+}
+
+// tocEntryPattern соответствует строке оглавления: "<номер>. <путь> (line <строка>)"
+var tocEntryPattern = regexp.MustCompile(`(\d+)\. (.+) \(line (\d+)\)`)
+
+func TestMergeTableOfContentsLines(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := testMergeFiles()
+
+	tests := []struct {
+		name     string
+		opts     MergeOptions
+		fileLine func(index int, file FileContent) string // Первая строка вывода файла
+	}{
+		{
+			name: "comments",
+			opts: MergeOptions{Format: FormatComments, OutputFilename: "merged.go"},
+			fileLine: func(_ int, file FileContent) string {
+				return strings.TrimSuffix(s.formatFileHeader(s.validationService.GetCommentPrefix(file.Filename), file.Path), "\n\n")
+			},
+		},
+		{
+			name:     "markdown",
+			opts:     MergeOptions{Format: FormatMarkdown},
+			fileLine: func(_ int, file FileContent) string { return "### " + file.Path },
+		},
+		{
+			name:     "xml",
+			opts:     MergeOptions{Format: FormatXML},
+			fileLine: func(index int, _ FileContent) string { return fmt.Sprintf("<document index=\"%d\">", index+1) },
+		},
+		{
+			name: "template with multiline preamble",
+			opts: MergeOptions{
+				Format:         FormatTemplate,
+				OutputFilename: "merged.txt",
+				Template:       `{{define "preamble"}}Files:{{range .Files}}` + "\n- {{.Path}}" + `{{end}}` + "\n\n" + `{{end}}{{define "header"}}== {{.Path}} ==` + "\n" + `{{end}}`,
+			},
+			fileLine: func(_ int, file FileContent) string { return "== " + file.Path + " ==" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.TableOfContents = true
+			merged, err := s.MergeFiles(files, opts)
+			if err != nil {
+				t.Fatalf("MergeFiles() error = %v", err)
+			}
+			lines := strings.Split(merged, "\n")
+
+			entries := tocEntryPattern.FindAllStringSubmatch(merged, -1)
+			if len(entries) != len(files) {
+				t.Fatalf("found %d table of contents entries, want %d:\n%s", len(entries), len(files), merged)
+			}
+			for i, entry := range entries {
+				if entry[1] != strconv.Itoa(i+1) || entry[2] != files[i].Path {
+					t.Fatalf("entry %d = %q, want %d. %s", i, entry[0], i+1, files[i].Path)
+				}
+				line, _ := strconv.Atoi(entry[3])
+				if line < 1 || line > len(lines) {
+					t.Fatalf("entry %d points to line %d of %d", i, line, len(lines))
+				}
+				if want := tt.fileLine(i, files[i]); lines[line-1] != want {
+					t.Fatalf("line %d = %q, want %q", line, lines[line-1], want)
+				}
+			}
+		})
+	}
+}
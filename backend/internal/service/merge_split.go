@@ -0,0 +1,330 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит разбиение объединенного файла на части по лимиту токенов или байтов.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrBudgetTooSmall возвращается, если лимит части меньше минимально возможного вывода
+var ErrBudgetTooSmall = errors.New("part size limit is too small")
+
+// MergeLimits содержит лимиты размера одной части объединенного файла.
+// Нулевое значение лимита означает отсутствие ограничения.
+type MergeLimits struct {
+	MaxTokens int   // Максимальное количество токенов в части
+	MaxBytes  int64 // Максимальный размер части в байтах
+}
+
+// Enabled проверяет, задан ли хотя бы один лимит
+func (l MergeLimits) Enabled() bool {
+	return l.MaxTokens > 0 || l.MaxBytes > 0
+}
+
+// MergeParts объединяет файлы и разбивает результат на части, каждая из которых укладывается в лимиты.
+// Части разбиваются по границам файлов; файл, не помещающийся в одну часть целиком,
+// разбивается по границам строк на фрагменты с номерами (FileContent.Part), которые выводятся
+// в заголовках "(part N)", а путь файла не меняется. Строка, не помещающаяся в часть даже одна,
+// разрезается посередине по границе символа UTF-8. Каждая часть является самостоятельным
+// документом выбранного формата. Время отрисовки шаблона ограничено один раз на весь вызов,
+// а не на каждую отрисовку части или фрагмента.
+func (s *FileService) MergeParts(files []FileContent, opts MergeOptions, limits MergeLimits) ([]string, error) {
+	if opts.Format == FormatTemplate && opts.deadline.IsZero() {
+		opts.deadline = time.Now().Add(s.cfg.TemplateTimeout)
+	}
+
+	result, err := s.MergeFiles(files, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !limits.Enabled() || s.fits(result, limits) {
+		return []string{result}, nil
+	}
+
+	// Файлы, превышающие лимит, разбиваются на фрагменты по строкам
+	var items []FileContent
+	for _, file := range files {
+		single, err := s.MergeFiles([]FileContent{file}, opts)
+		if err != nil {
+			return nil, err
+		}
+		if s.fits(single, limits) {
+			items = append(items, file)
+			continue
+		}
+
+		chunks, err := s.splitFile(file, opts, limits)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, chunks...)
+	}
+
+	return s.packParts(items, opts, limits)
+}
+
+// packParts жадно распределяет файлы по частям.
+// Размер части оценивается суммой размеров отдельных файлов и проверяется итоговой отрисовкой;
+// при превышении лимита граница части ищется двоичным поиском, а не по одному файлу.
+func (s *FileService) packParts(items []FileContent, opts MergeOptions, limits MergeLimits) ([]string, error) {
+	empty, err := s.MergeFiles(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	base := s.measure(empty, limits)
+
+	costs := make([]int64, len(items))
+	for i, item := range items {
+		single, err := s.MergeFiles([]FileContent{item}, opts)
+		if err != nil {
+			return nil, err
+		}
+		costs[i] = s.measure(single, limits) - base
+	}
+
+	var parts []string
+	for start := 0; start < len(items); {
+		// Оценка: набираем файлы, пока сумма укладывается в лимит
+		end, total := start+1, base+costs[start]
+		for end < len(items) && total+costs[end] <= s.budget(limits) {
+			total += costs[end]
+			end++
+		}
+
+		// Проверка: отрисованная часть должна уложиться в лимит. Если оценка оказалась
+		// завышенной, наибольшее подходящее количество файлов ищется двоичным поиском
+		part, err := s.MergeFiles(items[start:end], opts)
+		if err != nil {
+			return nil, err
+		}
+		if !s.fits(part, limits) {
+			var renderErr error
+			rendered := make(map[int]string) // Количество файлов -> отрисованная часть, уложившаяся в лимит
+			count := sort.Search(end-start-1, func(n int) bool {
+				if renderErr != nil {
+					return true
+				}
+				text, err := s.MergeFiles(items[start:start+n+1], opts)
+				if err != nil {
+					renderErr = err
+					return true
+				}
+				if !s.fits(text, limits) {
+					return true
+				}
+				rendered[n+1] = text
+				return false
+			})
+			if renderErr != nil {
+				return nil, renderErr
+			}
+			if count == 0 {
+				return nil, fmt.Errorf("%w: %s does not fit into a single part", ErrBudgetTooSmall, items[start].Title())
+			}
+			// Поиск сужается только после проверки, что count файлов укладываются в лимит
+			end, part = start+count, rendered[count]
+		}
+		parts = append(parts, part)
+		start = end
+	}
+
+	return parts, nil
+}
+
+// splitFile разбивает содержимое файла на фрагменты, каждый из которых помещается в отдельную часть.
+// Каждая строка токенизируется один раз: количество строк фрагмента оценивается по префиксным
+// суммам размеров строк и проверяется отрисовкой фрагмента. Если оценка оказалась завышенной
+// (экранирование содержимого форматом, токены на границах строк), допустимый объем уменьшается
+// пропорционально ошибке оценки.
+func (s *FileService) splitFile(file FileContent, opts MergeOptions, limits MergeLimits) ([]FileContent, error) {
+	lines := strings.SplitAfter(file.Content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	// Префиксные суммы размеров строк в байтах и токенах
+	byteSums := make([]int64, len(lines)+1)
+	tokenSums := make([]int64, len(lines)+1)
+	for i, line := range lines {
+		byteSums[i+1] = byteSums[i] + int64(len(line))
+		tokenSums[i+1] = tokenSums[i]
+		if limits.MaxTokens > 0 {
+			tokenSums[i+1] += int64(s.tokenService.Count(line))
+		}
+	}
+
+	// Первая строка фрагмента может быть остатком строки, разрезанной по символам,
+	// поэтому ее размер хранится отдельно от префиксных сумм
+	var firstBytes, firstTokens int64
+	resetFirst := func(start int) {
+		if start < len(lines) {
+			firstBytes, firstTokens = byteSums[start+1]-byteSums[start], tokenSums[start+1]-tokenSums[start]
+		}
+	}
+	span := func(sums []int64, first int64, start, n int) int64 {
+		if n == 0 {
+			return 0
+		}
+		return first + sums[start+n] - sums[start+1]
+	}
+
+	var chunks []FileContent
+	resetFirst(0)
+	for start := 0; start < len(lines); {
+		chunk := file
+		chunk.Part = len(chunks) + 1
+		render := func(content string) (string, error) {
+			chunk.Content = content
+			chunk.Size = int64(len(content))
+			return s.MergeFiles([]FileContent{chunk}, opts)
+		}
+
+		// Объем, остающийся для содержимого после заголовка фрагмента
+		header, err := render("")
+		if err != nil {
+			return nil, err
+		}
+		headerTokens := int64(0)
+		byteBudget, tokenBudget := int64(math.MaxInt64), int64(math.MaxInt64)
+		if limits.MaxBytes > 0 {
+			byteBudget = limits.MaxBytes - int64(len(header))
+		}
+		if limits.MaxTokens > 0 {
+			headerTokens = int64(s.tokenService.Count(header))
+			tokenBudget = int64(limits.MaxTokens) - headerTokens
+		}
+		if byteBudget <= 0 || tokenBudget <= 0 {
+			return nil, fmt.Errorf("%w: header of %s does not fit into a single part", ErrBudgetTooSmall, file.DisplayName())
+		}
+
+		// Оценка: наибольшее количество строк, укладывающееся в лимиты по префиксным суммам
+		estimate := func() int {
+			return sort.Search(len(lines)-start, func(n int) bool {
+				return span(byteSums, firstBytes, start, n+1) > byteBudget || span(tokenSums, firstTokens, start, n+1) > tokenBudget
+			})
+		}
+
+		// Проверка: отрисованный фрагмент должен уложиться в лимиты
+		count := estimate()
+		for count > 0 {
+			rendered, err := render(strings.Join(lines[start:start+count], ""))
+			if err != nil {
+				return nil, err
+			}
+			renderedBytes, renderedTokens := int64(len(rendered)), int64(0)
+			if limits.MaxTokens > 0 {
+				renderedTokens = int64(s.tokenService.Count(rendered))
+			}
+			overBytes := limits.MaxBytes > 0 && renderedBytes > limits.MaxBytes
+			overTokens := limits.MaxTokens > 0 && renderedTokens > int64(limits.MaxTokens)
+			if !overBytes && !overTokens {
+				break
+			}
+
+			if overBytes {
+				byteBudget = scaleBudget(span(byteSums, firstBytes, start, count),
+					renderedBytes-int64(len(header)), renderedBytes-limits.MaxBytes)
+			}
+			if overTokens {
+				tokenBudget = scaleBudget(span(tokenSums, firstTokens, start, count),
+					renderedTokens-headerTokens, renderedTokens-int64(limits.MaxTokens))
+			}
+			count = min(count-1, estimate())
+		}
+
+		if count > 0 {
+			chunk.Content = strings.Join(lines[start:start+count], "")
+			start += count
+			resetFirst(start)
+		} else {
+			// Даже одна строка не помещается: режем ее по границе символа
+			line := lines[start]
+			fitsChunk := func(content string) bool {
+				rendered, err := render(content)
+				return err == nil && s.fits(rendered, limits)
+			}
+			size := sort.Search(len(line), func(n int) bool {
+				return !fitsChunk(truncateUTF8(line, n+1))
+			})
+			size = len(truncateUTF8(line, size))
+			if size == 0 {
+				return nil, fmt.Errorf("%w: header of %s does not fit into a single part", ErrBudgetTooSmall, file.DisplayName())
+			}
+
+			chunk.Content = line[:size]
+			lines[start] = line[size:]
+			firstBytes = int64(len(lines[start]))
+			if limits.MaxTokens > 0 {
+				firstTokens = int64(s.tokenService.Count(lines[start]))
+			}
+		}
+
+		chunk.Size = int64(len(chunk.Content))
+		chunk.TokenCount = s.tokenService.Count(chunk.Content)
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// scaleBudget возвращает допустимый объем содержимого по оценке строк после превышения лимита.
+// estimated - оценка объема фрагмента по строкам, actual - объем его содержимого в отрисовке,
+// excess - превышение лимита. Отрисованный объем считается пропорциональным оценке.
+func scaleBudget(estimated, actual, excess int64) int64 {
+	if actual <= excess {
+		return 0
+	}
+	return estimated * (actual - excess) / actual
+}
+
+// fits проверяет, укладывается ли текст в лимиты
+func (s *FileService) fits(text string, limits MergeLimits) bool {
+	if limits.MaxBytes > 0 && int64(len(text)) > limits.MaxBytes {
+		return false
+	}
+	if limits.MaxTokens > 0 && s.tokenService.Count(text) > limits.MaxTokens {
+		return false
+	}
+	return true
+}
+
+// measure возвращает размер текста в единицах основного лимита (токены, если задан лимит токенов)
+func (s *FileService) measure(text string, limits MergeLimits) int64 {
+	if limits.MaxTokens > 0 {
+		return int64(s.tokenService.Count(text))
+	}
+	return int64(len(text))
+}
+
+// budget возвращает значение основного лимита
+func (s *FileService) budget(limits MergeLimits) int64 {
+	if limits.MaxTokens > 0 {
+		return int64(limits.MaxTokens)
+	}
+	return limits.MaxBytes
+}
+
+// PartFilename возвращает имя файла части: code-base.txt -> code-base.part01.txt
+func PartFilename(filename string, index, total int) string {
+	width := max(2, len(fmt.Sprint(total)))
+	ext := path.Ext(filename)
+	return fmt.Sprintf("%s.part%0*d%s", strings.TrimSuffix(filename, ext), width, index+1, ext)
+}
+
+// truncateUTF8 обрезает строку до n байт, не разрывая многобайтовые символы
+func truncateUTF8(text string, n int) string {
+	if n >= len(text) {
+		return text
+	}
+	for n > 0 && !utf8.RuneStart(text[n]) {
+		n--
+	}
+	return text[:n]
+}
@@ -0,0 +1,269 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты разбиения объединенного файла на части.
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// testSource возвращает исходный текст из lines строк разной длины
+func testSource(lines int) string {
+	var source strings.Builder
+	for i := range lines {
+		fmt.Fprintf(&source, "\tvalue%d := compute(%q) // строка %d\n", i, strings.Repeat("x", i%17), i)
+	}
+	return source.String()
+}
+
+func TestSplitFile(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+
+	contents := map[string]string{
+		"many lines":           testSource(400),
+		"no trailing newline":  strings.TrimSuffix(testSource(50), "\n"),
+		"single long line":     strings.Repeat("токен ", 2000),
+		"long line in between": testSource(20) + strings.Repeat("\"quoted\" ", 800) + "\n" + testSource(20),
+	}
+	formats := []MergeFormat{FormatComments, FormatMarkdown, FormatXML, FormatJSON}
+	limits := []MergeLimits{
+		{MaxBytes: 2048},
+		{MaxTokens: 300},
+		{MaxBytes: 1500, MaxTokens: 500},
+	}
+
+	for contentName, content := range contents {
+		for _, format := range formats {
+			for _, limit := range limits {
+				name := fmt.Sprintf("%s/%s/bytes=%d,tokens=%d", contentName, format, limit.MaxBytes, limit.MaxTokens)
+				t.Run(name, func(t *testing.T) {
+					file := FileContent{Filename: "main.go", Path: "cmd/main.go", Content: content, Size: int64(len(content))}
+					opts := MergeOptions{Format: format}
+
+					chunks, err := s.splitFile(file, opts, limit)
+					if err != nil {
+						t.Fatalf("splitFile() error = %v", err)
+					}
+					if len(chunks) < 2 {
+						t.Fatalf("splitFile() = %d chunks, want at least 2", len(chunks))
+					}
+
+					var joined strings.Builder
+					for i, chunk := range chunks {
+						if chunk.Path != file.Path || chunk.Part != i+1 {
+							t.Fatalf("chunk %d path = %q, part %d, want %q, part %d", i, chunk.Path, chunk.Part, file.Path, i+1)
+						}
+						if chunk.Content == "" || chunk.Size != int64(len(chunk.Content)) {
+							t.Fatalf("chunk %d size = %d, content %d bytes", i, chunk.Size, len(chunk.Content))
+						}
+						rendered, err := s.MergeFiles([]FileContent{chunk}, opts)
+						if err != nil {
+							t.Fatalf("MergeFiles() error = %v", err)
+						}
+						if !s.fits(rendered, limit) {
+							t.Fatalf("chunk %d does not fit: %d bytes, %d tokens", i, len(rendered), s.tokenService.Count(rendered))
+						}
+						joined.WriteString(chunk.Content)
+					}
+					if joined.String() != content {
+						t.Fatalf("joined chunks differ from the file content")
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestSplitFileBudgetTooSmall(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	file := FileContent{Filename: "main.go", Path: "cmd/main.go", Content: testSource(10)}
+
+	tests := []struct {
+		name   string
+		limits MergeLimits
+	}{
+		{name: "bytes", limits: MergeLimits{MaxBytes: 10}},
+		{name: "tokens", limits: MergeLimits{MaxTokens: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.splitFile(file, MergeOptions{}, tt.limits); !errors.Is(err, ErrBudgetTooSmall) {
+				t.Fatalf("splitFile() error = %v, want %v", err, ErrBudgetTooSmall)
+			}
+		})
+	}
+}
+
+func TestMergeParts(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := []FileContent{
+		{Filename: "a.go", Path: "a.go", Content: testSource(5)},
+		{Filename: "b.go", Path: "b.go", Content: testSource(200)},
+		{Filename: "c.go", Path: "c.go", Content: testSource(5)},
+	}
+
+	tests := []struct {
+		name      string
+		limits    MergeLimits
+		wantParts int // 0 - больше одной части
+	}{
+		{name: "no limits", limits: MergeLimits{}, wantParts: 1},
+		{name: "large limit", limits: MergeLimits{MaxBytes: 1 << 20}, wantParts: 1},
+		{name: "bytes", limits: MergeLimits{MaxBytes: 4096}},
+		{name: "tokens", limits: MergeLimits{MaxTokens: 600}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := s.MergeParts(files, MergeOptions{}, tt.limits)
+			if err != nil {
+				t.Fatalf("MergeParts() error = %v", err)
+			}
+			if tt.wantParts > 0 && len(parts) != tt.wantParts || tt.wantParts == 0 && len(parts) < 2 {
+				t.Fatalf("MergeParts() = %d parts, want %d", len(parts), tt.wantParts)
+			}
+
+			all := strings.Join(parts, "")
+			for i, part := range parts {
+				if tt.limits.Enabled() && !s.fits(part, tt.limits) {
+					t.Fatalf("part %d does not fit into the limits", i)
+				}
+			}
+			for _, file := range files {
+				if !strings.Contains(all, file.Path) {
+					t.Fatalf("parts do not contain %s", file.Path)
+				}
+			}
+		})
+	}
+}
+
+func TestPackParts(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	limits := MergeLimits{MaxBytes: 2000}
+
+	// Оценка по отдельным файлам не учитывает разделители между ними и оказывается завышенной
+	items := make([]FileContent, 200)
+	for i := range items {
+		name := fmt.Sprintf("f%03d.go", i)
+		items[i] = FileContent{Filename: name, Path: name, Content: "x"}
+	}
+
+	parts, err := s.packParts(items, MergeOptions{}, limits)
+	if err != nil {
+		t.Fatalf("packParts() error = %v", err)
+	}
+
+	// Части совпадают с жадным распределением, добавляющим файлы по одному
+	var want []string
+	for start := 0; start < len(items); {
+		end := start + 1
+		for end < len(items) {
+			next, err := s.MergeFiles(items[start:end+1], MergeOptions{})
+			if err != nil {
+				t.Fatalf("MergeFiles() error = %v", err)
+			}
+			if !s.fits(next, limits) {
+				break
+			}
+			end++
+		}
+		part, err := s.MergeFiles(items[start:end], MergeOptions{})
+		if err != nil {
+			t.Fatalf("MergeFiles() error = %v", err)
+		}
+		want = append(want, part)
+		start = end
+	}
+
+	if len(parts) != len(want) {
+		t.Fatalf("packParts() = %d parts, want %d", len(parts), len(want))
+	}
+	for i := range parts {
+		if parts[i] != want[i] {
+			t.Fatalf("part %d differs from the greedy packing", i)
+		}
+	}
+}
+
+func TestMergePartsFragmentPaths(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	files := []FileContent{
+		{Filename: "a.go", Path: "a.go", Content: testSource(5)},
+		{Filename: "main.go", Path: "cmd/main.go", Content: testSource(200)},
+	}
+	limits := MergeLimits{MaxBytes: 4096}
+
+	t.Run("json", func(t *testing.T) {
+		parts, err := s.MergeParts(files, MergeOptions{Format: FormatJSON}, limits)
+		if err != nil {
+			t.Fatalf("MergeParts() error = %v", err)
+		}
+
+		// Путь фрагментов не меняется, номер фрагмента передается отдельным полем
+		var fragments []jsonFile
+		for i, part := range parts {
+			var decoded []jsonFile
+			if err := json.Unmarshal([]byte(part), &decoded); err != nil {
+				t.Fatalf("part %d is not valid JSON: %v", i, err)
+			}
+			for _, file := range decoded {
+				if file.Path == "a.go" {
+					if file.Part != 0 {
+						t.Fatalf("a.go part = %d, want 0", file.Part)
+					}
+					continue
+				}
+				fragments = append(fragments, file)
+			}
+		}
+		if len(fragments) < 2 {
+			t.Fatalf("cmd/main.go is split into %d fragments, want at least 2", len(fragments))
+		}
+		for i, fragment := range fragments {
+			if fragment.Path != "cmd/main.go" || fragment.Part != i+1 {
+				t.Fatalf("fragment %d path = %q, part %d, want %q, part %d", i, fragment.Path, fragment.Part, "cmd/main.go", i+1)
+			}
+		}
+	})
+
+	t.Run("headers", func(t *testing.T) {
+		tests := map[MergeFormat]string{
+			FormatComments: "// cmd/main.go (part 2)\n",
+			FormatMarkdown: "### cmd/main.go (part 2)\n",
+			FormatXML:      "part=\"2\">\n<source>cmd/main.go</source>",
+		}
+		for format, want := range tests {
+			parts, err := s.MergeParts(files, MergeOptions{Format: format}, limits)
+			if err != nil {
+				t.Fatalf("MergeParts(%s) error = %v", format, err)
+			}
+			if all := strings.Join(parts, ""); !strings.Contains(all, want) {
+				t.Fatalf("MergeParts(%s) does not contain %q", format, want)
+			}
+		}
+	})
+}
+
+func TestPartFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		index    int
+		total    int
+		want     string
+	}{
+		{filename: "code-base.txt", index: 0, total: 3, want: "code-base.part01.txt"},
+		{filename: "code-base.txt", index: 99, total: 100, want: "code-base.part100.txt"},
+		{filename: "merged", index: 1, total: 2, want: "merged.part02"},
+		{filename: "out.tar.md", index: 4, total: 9, want: "out.tar.part05.md"},
+	}
+	for _, tt := range tests {
+		if got := PartFilename(tt.filename, tt.index, tt.total); got != tt.want {
+			t.Fatalf("PartFilename(%q, %d, %d) = %q, want %q", tt.filename, tt.index, tt.total, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит построение оглавления и дерева каталогов объединенного файла.
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// tocCommentPrefix возвращает префикс комментария, в который оборачивается оглавление
+func (s *FileService) tocCommentPrefix(opts MergeOptions) (string, error) {
+	switch opts.Format {
+	case "", FormatComments, FormatTemplate:
+		// Оглавление оформляется комментарием языка выходного файла
+		return s.validationService.GetCommentPrefix(opts.OutputFilename), nil
+	case FormatMarkdown, FormatXML:
+		return "<!--", nil
+	default:
+		return "", fmt.Errorf("table of contents is not supported for %s format", opts.Format)
+	}
+}
+
+// buildTableOfContents формирует блок с деревом каталогов и оглавлением.
+// startLines - номера строк, с которых начинаются файлы в итоговом выводе.
+func buildTableOfContents(prefix string, files []FileContent, startLines []int) string {
+	lines := []string{"Directory structure:"}
+	lines = append(lines, buildDirectoryTree(files)...)
+	lines = append(lines, "", "Table of contents:")
+	for i, file := range files {
+		lines = append(lines, fmt.Sprintf("%d. %s (line %d)", i+1, file.Title(), startLines[i]))
+	}
+
+	return commentBlock(prefix, lines) + "\n\n"
+}
+
+// tocLineCount возвращает количество строк, которое займет блок оглавления.
+// Не зависит от номеров строк, поэтому вычисляется до их расчета.
+func tocLineCount(prefix string, files []FileContent) int {
+	block := buildTableOfContents(prefix, files, make([]int, len(files)))
+	return strings.Count(block, "\n")
+}
+
+// commentBlock оборачивает строки в комментарий с указанным префиксом
+func commentBlock(prefix string, lines []string) string {
+	suffix := commentSuffix(prefix)
+
+	var result strings.Builder
+	if suffix != "" {
+		result.WriteString(prefix + "\n")
+		for _, line := range lines {
+			result.WriteString(escapeComment(prefix, line) + "\n")
+		}
+		result.WriteString(suffix)
+		return result.String()
+	}
+
+	for i, line := range lines {
+		if i > 0 {
+			result.WriteString("\n")
+		}
+		result.WriteString(strings.TrimRight(prefix+" "+line, " "))
+	}
+	return result.String()
+}
+
+// escapeComment разбивает последовательности, которые закрыли бы блочный комментарий.
+// В комментариях HTML/XML запрещено "--", в комментариях C-стиля - "*/".
+func escapeComment(prefix, line string) string {
+	forbidden := "*/"
+	if strings.Contains(prefix, "<!--") {
+		forbidden = "--"
+	}
+
+	for strings.Contains(line, forbidden) {
+		line = strings.ReplaceAll(line, forbidden, forbidden[:1]+" "+forbidden[1:])
+	}
+	return line
+}
+
+// treeNode представляет каталог или файл в дереве каталогов
+type treeNode struct {
+	name     string
+	children map[string]*treeNode
+}
+
+// buildDirectoryTree строит дерево каталогов в стиле утилиты tree по путям файлов
+func buildDirectoryTree(files []FileContent) []string {
+	root := &treeNode{children: make(map[string]*treeNode)}
+	for _, file := range files {
+		node := root
+		for _, part := range strings.Split(file.DisplayName(), "/") {
+			child, exists := node.children[part]
+			if !exists {
+				child = &treeNode{name: part, children: make(map[string]*treeNode)}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	lines := []string{"."}
+	return appendTreeLines(lines, root, "")
+}
+
+// appendTreeLines добавляет строки дерева для дочерних элементов узла.
+// Каталоги выводятся перед файлами, внутри групп - по алфавиту.
+func appendTreeLines(lines []string, node *treeNode, indent string) []string {
+	children := make([]*treeNode, 0, len(node.children))
+	for _, child := range node.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		iDir, jDir := len(children[i].children) > 0, len(children[j].children) > 0
+		if iDir != jDir {
+			return iDir
+		}
+		return children[i].name < children[j].name
+	})
+
+	for i, child := range children {
+		connector, childIndent := "├── ", "│   "
+		if i == len(children)-1 {
+			connector, childIndent = "└── ", "    "
+		}
+
+		lines = append(lines, indent+connector+child.name)
+		lines = appendTreeLines(lines, child, indent+childIndent)
+	}
+	return lines
+}
@@ -0,0 +1,71 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит коды причин отказа в приеме загруженных файлов.
+package service
+
+import (
+	"errors"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// Коды причин отказа в приеме файла
+const (
+	ReasonFileTooLarge       = "file_too_large"       // Файл больше MAX_FILE_SIZE
+	ReasonTotalSizeExceeded  = "total_size_exceeded"  // Превышен суммарный размер файлов запроса или архива
+	ReasonUnsupportedType    = "unsupported_type"     // Неподдерживаемое расширение файла
+	ReasonBinaryContent      = "binary_content"       // Содержимое не является текстом
+	ReasonEncodingFailed     = "encoding_failed"      // Не удалось преобразовать содержимое в UTF-8
+	ReasonInvalidPath        = "invalid_path"         // Абсолютный путь, выход за пределы каталога или пустой путь
+	ReasonNotRegularFile     = "not_regular_file"     // Элемент архива или каталога не является обычным файлом
+	ReasonSymlinkEscapesRoot = "symlink_escapes_root" // Символическая ссылка ведет за пределы загружаемого каталога
+	ReasonIgnored            = "ignored"              // Файл исключен правилом .gitignore или .codemergerignore
+	ReasonEntryLimitExceeded = "entry_limit_exceeded" // Превышено количество элементов архива
+	ReasonReadFailed         = "read_failed"          // Не удалось прочитать файл или элемент архива
+	ReasonInvalidArchive     = "invalid_archive"      // Архив поврежден или превышен лимит распаковки
+	ReasonQuotaExceeded      = "quota_exceeded"       // Превышена квота рабочего пространства
+	ReasonStorageFull        = "storage_full"         // Файл не помещается в хранилище
+	ReasonStorageFailed      = "storage_failed"       // Ошибка записи в хранилище
+)
+
+var (
+	// ErrFileTooLarge возвращается, если файл превышает допустимый размер
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrUnsupportedType возвращается, если расширение файла не поддерживается
+	ErrUnsupportedType = errors.New("unsupported file type")
+	// ErrBinaryContent возвращается, если содержимое файла не является текстом
+	ErrBinaryContent = errors.New("binary content")
+	// ErrEncodingFailed возвращается, если содержимое не удалось преобразовать в UTF-8
+	ErrEncodingFailed = errors.New("encoding conversion failed")
+	// ErrInvalidPath возвращается, если путь файла небезопасен или пуст
+	ErrInvalidPath = errors.New("invalid file path")
+	// ErrReadFailed возвращается, если не удалось прочитать содержимое файла
+	ErrReadFailed = errors.New("failed to read file content")
+	// ErrInvalidArchive возвращается, если архив не удалось распаковать
+	ErrInvalidArchive = errors.New("invalid archive")
+)
+
+// ReasonCode возвращает код причины отказа по ошибке обработки файла
+func ReasonCode(err error) string {
+	switch {
+	case errors.Is(err, ErrFileTooLarge):
+		return ReasonFileTooLarge
+	case errors.Is(err, ErrUnsupportedType):
+		return ReasonUnsupportedType
+	case errors.Is(err, ErrBinaryContent):
+		return ReasonBinaryContent
+	case errors.Is(err, ErrEncodingFailed):
+		return ReasonEncodingFailed
+	case errors.Is(err, ErrInvalidPath):
+		return ReasonInvalidPath
+	case errors.Is(err, ErrReadFailed):
+		return ReasonReadFailed
+	case errors.Is(err, ErrInvalidArchive):
+		return ReasonInvalidArchive
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return ReasonQuotaExceeded
+	case errors.Is(err, storage.ErrStorageFull):
+		return ReasonStorageFull
+	default:
+		return ReasonStorageFailed
+	}
+}
@@ -0,0 +1,399 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит логику возобновляемых загрузок файлов по частям.
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+var (
+	// ErrUploadNotFound возвращается, если возобновляемая загрузка не найдена или истекла
+	ErrUploadNotFound = errors.New("upload not found")
+	// ErrUploadOffset возвращается, если смещение части не совпадает с текущим смещением загрузки
+	ErrUploadOffset = errors.New("upload offset mismatch")
+	// ErrUploadIncomplete возвращается при завершении загрузки, получившей не все данные
+	ErrUploadIncomplete = errors.New("upload is incomplete")
+)
+
+// ResumableUpload представляет состояние возобновляемой загрузки
+type ResumableUpload struct {
+	ID        string    `json:"id"`         // Идентификатор загрузки
+	Name      string    `json:"name"`       // Имя (относительный путь) загружаемого файла
+	Length    int64     `json:"length"`     // Полный размер файла в байтах
+	Offset    int64     `json:"offset"`     // Количество полученных байтов
+	ExpiresAt time.Time `json:"expires_at"` // Время удаления загрузки без активности
+
+	createdAt time.Time // Время создания загрузки
+	chunks    []int64   // Смещения полученных частей по порядку
+}
+
+// CreateUpload создает возобновляемую загрузку файла размером length.
+// Имя проверяется сразу, чтобы не принимать данные файла, который будет отклонен.
+// Архивы ограничены MaxTotalSize, остальные файлы - MaxFileSize.
+func (s *FileService) CreateUpload(workspaceID, name string, length int64) (ResumableUpload, error) {
+	relPath, err := cleanRelativePath(name)
+	if err != nil {
+		return ResumableUpload{}, fmt.Errorf("%w %s: %v", ErrInvalidPath, name, err)
+	}
+
+	limit := s.cfg.MaxFileSize
+	if s.IsArchive(relPath) {
+		limit = s.cfg.MaxTotalSize
+	} else if err := s.validationService.ValidateName(path.Base(relPath)); err != nil {
+		return ResumableUpload{}, fmt.Errorf("file validation failed: %w", err)
+	}
+	if length < 0 {
+		return ResumableUpload{}, fmt.Errorf("invalid upload length: %d", length)
+	}
+	if length > limit {
+		return ResumableUpload{}, fmt.Errorf("%w: upload length %d exceeds limit of %d bytes", ErrFileTooLarge, length, limit)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ResumableUpload{}, fmt.Errorf("failed to generate upload id: %v", err)
+	}
+	upload := ResumableUpload{
+		ID:        hex.EncodeToString(id),
+		Name:      relPath,
+		Length:    length,
+		createdAt: time.Now(),
+	}
+
+	// Запись о загрузке хранит ее состояние, поэтому запросы к загрузке не перебирают хранилище
+	if err := s.storeUpload(workspaceID, upload); err != nil {
+		return ResumableUpload{}, err
+	}
+	upload.ExpiresAt = time.Now().Add(s.cfg.FileTTL)
+	return upload, nil
+}
+
+// GetUpload возвращает состояние возобновляемой загрузки
+func (s *FileService) GetUpload(workspaceID, uploadID string) (ResumableUpload, error) {
+	if uploadID == "" {
+		return ResumableUpload{}, fmt.Errorf("%w: empty upload id", ErrUploadNotFound)
+	}
+
+	data, ok := s.storage.Get(uploadKey(workspaceID, uploadID))
+	if !ok || data.Upload == nil {
+		return ResumableUpload{}, fmt.Errorf("%w: %s", ErrUploadNotFound, uploadID)
+	}
+
+	return ResumableUpload{
+		ID:        uploadID,
+		Name:      data.Path,
+		Length:    data.Upload.Length,
+		Offset:    data.Upload.Offset,
+		ExpiresAt: data.LastActive().Add(s.cfg.FileTTL),
+		createdAt: data.UploadedAt,
+		chunks:    data.Upload.Chunks,
+	}, nil
+}
+
+// uploadSliceSize - наибольший объем данных, читаемый из запроса перед сохранением.
+// Тело запроса сохраняется по частям этого размера и не буферизуется целиком.
+const uploadSliceSize = 1 << 20
+
+// AppendUpload дописывает часть данных загрузки, начиная со смещения offset.
+// Смещение должно совпадать с количеством уже полученных байтов. Данные читаются
+// и сохраняются отдельными частями по uploadSliceSize байт. Если чтение прервано
+// (например, оборвалось соединение), полученные данные сохраняются и загрузку можно
+// продолжить с нового смещения. Если данных больше, чем осталось до конца загрузки,
+// возвращается ErrFileTooLarge, а последняя прочитанная часть не сохраняется.
+func (s *FileService) AppendUpload(workspaceID, uploadID string, offset int64, r io.Reader) (ResumableUpload, error) {
+	upload, err := s.GetUpload(workspaceID, uploadID)
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("%w: expected %d, got %d", ErrUploadOffset, upload.Offset, offset)
+	}
+
+	buf := make([]byte, min(uploadSliceSize, upload.Length-offset)+1)
+	for {
+		// Последняя часть читается с лишним байтом, чтобы обнаружить данные сверх размера загрузки
+		remaining := upload.Length - upload.Offset
+		size := min(uploadSliceSize, remaining)
+		if size == remaining {
+			size++
+		}
+
+		n, readErr := readSlice(r, buf[:size])
+		if int64(n) > remaining {
+			return upload, fmt.Errorf("%w: chunk exceeds upload length of %d bytes", ErrFileTooLarge, upload.Length)
+		}
+		if n > 0 {
+			if upload, err = s.appendChunk(workspaceID, uploadID, upload.Offset, buf[:n]); err != nil {
+				return upload, err
+			}
+		}
+
+		if readErr == io.EOF {
+			return upload, nil
+		}
+		if readErr != nil {
+			return upload, fmt.Errorf("%w: %w", ErrReadFailed, readErr)
+		}
+	}
+}
+
+// readSlice читает из r, пока буфер buf не заполнится или поток не закончится.
+// В конце потока возвращается io.EOF вместе с количеством прочитанных байтов.
+func readSlice(r io.Reader, buf []byte) (int, error) {
+	n := 0
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// appendChunk сохраняет часть данных загрузки, начинающуюся со смещения offset.
+// Блокировка берется только на время сохранения, а не чтения части из запроса.
+func (s *FileService) appendChunk(workspaceID, uploadID string, offset int64, chunk []byte) (ResumableUpload, error) {
+	unlock := s.lockUpload(workspaceID, uploadID)
+	defer unlock()
+
+	// Смещение проверяется повторно: пока читалась часть, загрузку могли дополнить
+	upload, err := s.GetUpload(workspaceID, uploadID)
+	if err != nil {
+		return ResumableUpload{}, err
+	}
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("%w: expected %d, got %d", ErrUploadOffset, upload.Offset, offset)
+	}
+
+	if err := s.storeChunk(workspaceID, upload, chunk); err != nil {
+		return upload, err
+	}
+	received := upload
+	received.Offset += int64(len(chunk))
+	received.chunks = append(received.chunks, offset)
+	if err := s.storeUpload(workspaceID, received); err != nil {
+		s.storage.Delete(chunkKey(workspaceID, uploadID, offset))
+		return upload, err
+	}
+	received.ExpiresAt = time.Now().Add(s.cfg.FileTTL)
+	return received, nil
+}
+
+// FinalizeUpload собирает полученные части и обрабатывает файл так же, как при обычной
+// загрузке: архив распаковывается, файл проверяется и конвертируется в UTF-8.
+// Части собираются во временный файл, а не в память, и удаляются до сохранения файла,
+// поэтому не занимают квоту вместе с ним.
+// Если часть удалена хранилищем (например, истек срок жизни ключа redis), загрузка
+// укорачивается до этой части и возвращается ErrUploadIncomplete: клиент досылает данные заново.
+// Ошибки ErrUploadNotFound и ErrUploadIncomplete означают, что файл не обрабатывался;
+// остальные ошибки - что файл отклонен.
+func (s *FileService) FinalizeUpload(workspaceID, uploadID string) (ResumableUpload, []UploadedFile, []SkippedEntry, error) {
+	upload, content, err := s.takeUpload(workspaceID, uploadID)
+	if err != nil {
+		return upload, nil, nil, err
+	}
+
+	defer os.Remove(content.Name())
+	defer content.Close()
+
+	// Загрузка уже удалена из хранилища, поэтому файл обрабатывается без блокировки
+	if s.IsArchive(upload.Name) {
+		files, skipped, err := s.ProcessArchive(workspaceID, upload.Name, content, upload.Length, s.NewArchiveBudget(), nil)
+		return upload, files, skipped, err
+	}
+
+	file, err := s.ProcessReader(workspaceID, upload.Name, content, nil)
+	if err != nil {
+		return upload, nil, nil, err
+	}
+	return upload, []UploadedFile{file}, nil, nil
+}
+
+// DeleteUpload прерывает возобновляемую загрузку и удаляет полученные части
+func (s *FileService) DeleteUpload(workspaceID, uploadID string) error {
+	unlock := s.lockUpload(workspaceID, uploadID)
+	defer unlock()
+
+	upload, err := s.GetUpload(workspaceID, uploadID)
+	if err != nil {
+		return err
+	}
+	s.deleteUpload(workspaceID, upload)
+	return nil
+}
+
+// takeUpload собирает содержимое полностью полученной загрузки во временный файл
+// и удаляет загрузку из хранилища. Файл открыт для чтения с начала; его закрывает и удаляет вызывающий.
+func (s *FileService) takeUpload(workspaceID, uploadID string) (ResumableUpload, *os.File, error) {
+	unlock := s.lockUpload(workspaceID, uploadID)
+	defer unlock()
+
+	upload, err := s.GetUpload(workspaceID, uploadID)
+	if err != nil {
+		return ResumableUpload{}, nil, err
+	}
+	if upload.Offset < upload.Length {
+		return upload, nil, fmt.Errorf("%w: received %d of %d bytes", ErrUploadIncomplete, upload.Offset, upload.Length)
+	}
+
+	content, err := os.CreateTemp("", "code-merger-upload-*")
+	if err != nil {
+		s.deleteUpload(workspaceID, upload)
+		return upload, nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	// discard удаляет временный файл, если он не передается вызывающему
+	discard := func() {
+		content.Close()
+		os.Remove(content.Name())
+	}
+
+	for i, offset := range upload.chunks {
+		data, ok := s.storage.Get(chunkKey(workspaceID, uploadID, offset))
+		if !ok {
+			discard()
+			upload, err = s.truncateUpload(workspaceID, upload, i)
+			if err != nil {
+				return upload, nil, err
+			}
+			return upload, nil, fmt.Errorf("%w: chunk at offset %d is missing, received %d of %d bytes",
+				ErrUploadIncomplete, offset, upload.Offset, upload.Length)
+		}
+		if _, err := io.WriteString(content, data.Content); err != nil {
+			discard()
+			s.deleteUpload(workspaceID, upload)
+			return upload, nil, fmt.Errorf("failed to write temporary file: %v", err)
+		}
+	}
+	s.deleteUpload(workspaceID, upload)
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		discard()
+		return upload, nil, fmt.Errorf("failed to read temporary file: %v", err)
+	}
+	return upload, content, nil
+}
+
+// truncateUpload укорачивает загрузку до отсутствующей части с номером missing
+// и удаляет следующие за ней части. Вызывается под блокировкой загрузки.
+func (s *FileService) truncateUpload(workspaceID string, upload ResumableUpload, missing int) (ResumableUpload, error) {
+	for _, offset := range upload.chunks[missing+1:] {
+		s.storage.Delete(chunkKey(workspaceID, upload.ID, offset))
+	}
+
+	upload.Offset = upload.chunks[missing]
+	upload.chunks = upload.chunks[:missing]
+	if err := s.storeUpload(workspaceID, upload); err != nil {
+		return upload, err
+	}
+	upload.ExpiresAt = time.Now().Add(s.cfg.FileTTL)
+	return upload, nil
+}
+
+// storeUpload сохраняет запись о загрузке: полученный объем и смещения частей.
+// Время последней активности загрузки обновляется.
+func (s *FileService) storeUpload(workspaceID string, upload ResumableUpload) error {
+	err := s.storage.Store(uploadKey(workspaceID, upload.ID), storage.FileData{
+		Filename:   path.Base(upload.Name),
+		Path:       upload.Name,
+		UploadedAt: upload.createdAt,
+		AccessedAt: time.Now(),
+		SessionID:  workspaceID,
+		Upload: &storage.UploadChunk{
+			ID:     upload.ID,
+			Offset: upload.Offset,
+			Length: upload.Length,
+			Chunks: upload.chunks,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	return nil
+}
+
+// storeChunk сохраняет часть загрузки, начинающуюся с текущего смещения upload.Offset
+func (s *FileService) storeChunk(workspaceID string, upload ResumableUpload, chunk []byte) error {
+	err := s.storage.Store(chunkKey(workspaceID, upload.ID, upload.Offset), storage.FileData{
+		Content:    string(chunk),
+		Filename:   path.Base(upload.Name),
+		Path:       upload.Name,
+		UploadedAt: time.Now(),
+		Size:       int64(len(chunk)),
+		SessionID:  workspaceID,
+		Upload: &storage.UploadChunk{
+			ID:     upload.ID,
+			Offset: upload.Offset,
+			Length: upload.Length,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store upload chunk: %w", err)
+	}
+	return nil
+}
+
+// deleteUpload удаляет запись о загрузке и ее части. Части, не попавшие в запись
+// (например, при сбое между сохранением части и записи), удаляет очистка вместе с загрузкой.
+func (s *FileService) deleteUpload(workspaceID string, upload ResumableUpload) {
+	for _, offset := range upload.chunks {
+		s.storage.Delete(chunkKey(workspaceID, upload.ID, offset))
+	}
+	s.storage.Delete(uploadKey(workspaceID, upload.ID))
+}
+
+// lockUpload блокирует загрузку на время изменения ее частей и возвращает функцию
+// снятия блокировки. Разные загрузки не блокируют друг друга.
+func (s *FileService) lockUpload(workspaceID, uploadID string) func() {
+	key := uploadKey(workspaceID, uploadID)
+
+	s.uploadsMu.Lock()
+	if s.uploadLocks == nil {
+		s.uploadLocks = make(map[string]*uploadLock)
+	}
+	lock, ok := s.uploadLocks[key]
+	if !ok {
+		lock = &uploadLock{}
+		s.uploadLocks[key] = lock
+	}
+	lock.refs++
+	s.uploadsMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		s.uploadsMu.Lock()
+		defer s.uploadsMu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(s.uploadLocks, key)
+		}
+	}
+}
+
+// uploadLock представляет блокировку загрузки со счетчиком использующих ее запросов
+type uploadLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// uploadKey возвращает ключ записи о загрузке в хранилище
+func uploadKey(workspaceID, uploadID string) string {
+	return fileKey(workspaceID, "upload_"+uploadID)
+}
+
+// chunkKey возвращает ключ части загрузки, начинающейся со смещения offset
+func chunkKey(workspaceID, uploadID string, offset int64) string {
+	return uploadKey(workspaceID, uploadID) + "_" + strconv.FormatInt(offset, 10)
+}
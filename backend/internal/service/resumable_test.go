@@ -0,0 +1,308 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты возобновляемых загрузок.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// newTestFileService создает FileService с конфигурацией по умолчанию поверх хранилища
+func newTestFileService(t *testing.T, st storage.Storage) *FileService {
+	t.Helper()
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	return NewFileService(cfg, st)
+}
+
+func TestAppendUploadOffsets(t *testing.T) {
+	type step struct {
+		offset     int64
+		data       string
+		wantErr    error
+		wantOffset int64
+	}
+	tests := []struct {
+		name   string
+		length int64
+		steps  []step
+	}{
+		{
+			name:   "sequential chunks",
+			length: 10,
+			steps: []step{
+				{offset: 0, data: "abcd", wantOffset: 4},
+				{offset: 4, data: "efghij", wantOffset: 10},
+			},
+		},
+		{
+			name:   "stale offset",
+			length: 10,
+			steps: []step{
+				{offset: 0, data: "abcd", wantOffset: 4},
+				{offset: 0, data: "abcd", wantErr: ErrUploadOffset, wantOffset: 4},
+				{offset: 4, data: "ef", wantOffset: 6},
+			},
+		},
+		{
+			name:   "offset ahead",
+			length: 10,
+			steps: []step{
+				{offset: 3, data: "abc", wantErr: ErrUploadOffset, wantOffset: 0},
+			},
+		},
+		{
+			name:   "chunk exceeds length",
+			length: 4,
+			steps: []step{
+				{offset: 0, data: "abc", wantOffset: 3},
+				{offset: 3, data: "de", wantErr: ErrFileTooLarge, wantOffset: 3},
+			},
+		},
+		{
+			name:   "empty chunk",
+			length: 4,
+			steps: []step{
+				{offset: 0, data: "", wantOffset: 0},
+				{offset: 0, data: "abcd", wantOffset: 4},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestFileService(t, storage.NewMemoryStorage())
+			upload, err := s.CreateUpload("ws", "main.go", tt.length)
+			if err != nil {
+				t.Fatalf("CreateUpload() error = %v", err)
+			}
+
+			for i, step := range tt.steps {
+				got, err := s.AppendUpload("ws", upload.ID, step.offset, strings.NewReader(step.data))
+				if !errors.Is(err, step.wantErr) {
+					t.Fatalf("step %d: AppendUpload() error = %v, want %v", i, err, step.wantErr)
+				}
+				if got.Offset != step.wantOffset {
+					t.Fatalf("step %d: offset = %d, want %d", i, got.Offset, step.wantOffset)
+				}
+				state, err := s.GetUpload("ws", upload.ID)
+				if err != nil {
+					t.Fatalf("step %d: GetUpload() error = %v", i, err)
+				}
+				if state.Offset != step.wantOffset {
+					t.Fatalf("step %d: stored offset = %d, want %d", i, state.Offset, step.wantOffset)
+				}
+			}
+		})
+	}
+}
+
+func TestAppendUploadSlices(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	s.cfg.MaxFileSize = 4 * uploadSliceSize
+	content := strings.Repeat("value := compute(x)\n", 2*uploadSliceSize/20+10)
+	upload, err := s.CreateUpload("ws", "main.go", int64(len(content)))
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	// Тело запроса сохраняется частями не больше uploadSliceSize
+	got, err := s.AppendUpload("ws", upload.ID, 0, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+	if got.Offset != int64(len(content)) {
+		t.Fatalf("offset = %d, want %d", got.Offset, len(content))
+	}
+	state, err := s.GetUpload("ws", upload.ID)
+	if err != nil {
+		t.Fatalf("GetUpload() error = %v", err)
+	}
+	if want := []int64{0, uploadSliceSize, 2 * uploadSliceSize}; fmt.Sprint(state.chunks) != fmt.Sprint(want) {
+		t.Fatalf("chunks = %v, want %v", state.chunks, want)
+	}
+	for _, offset := range state.chunks {
+		chunk, ok := s.storage.Get(chunkKey("ws", upload.ID, offset))
+		if !ok || chunk.Size > uploadSliceSize {
+			t.Fatalf("chunk at %d = %d bytes, %v, want at most %d bytes", offset, chunk.Size, ok, uploadSliceSize)
+		}
+	}
+
+	_, files, _, err := s.FinalizeUpload("ws", upload.ID)
+	if err != nil {
+		t.Fatalf("FinalizeUpload() error = %v", err)
+	}
+	if stored, err := s.GetFileByID("ws", files[0].ID); err != nil || stored.Content != content {
+		t.Fatalf("GetFileByID() = %d bytes, %v, want the uploaded content", len(stored.Content), err)
+	}
+}
+
+func TestFinalizeUpload(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	upload, err := s.CreateUpload("ws", "cmd/main.go", 12)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	if _, _, _, err := s.FinalizeUpload("ws", upload.ID); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("FinalizeUpload() before data error = %v, want %v", err, ErrUploadIncomplete)
+	}
+	if _, err := s.AppendUpload("ws", upload.ID, 0, strings.NewReader("package ")); err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+	if _, err := s.AppendUpload("ws", upload.ID, 8, strings.NewReader("main")); err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+
+	_, files, _, err := s.FinalizeUpload("ws", upload.ID)
+	if err != nil {
+		t.Fatalf("FinalizeUpload() error = %v", err)
+	}
+	if len(files) != 1 || files[0].Path != "cmd/main.go" {
+		t.Fatalf("FinalizeUpload() files = %+v, want cmd/main.go", files)
+	}
+	content, err := s.GetFileByID("ws", files[0].ID)
+	if err != nil {
+		t.Fatalf("GetFileByID() error = %v", err)
+	}
+	if content.Content != "package main" {
+		t.Fatalf("content = %q, want %q", content.Content, "package main")
+	}
+
+	// Запись о загрузке и части удаляются, остается только файл
+	if _, _, _, err := s.FinalizeUpload("ws", upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("second FinalizeUpload() error = %v, want %v", err, ErrUploadNotFound)
+	}
+	stored, err := s.storage.List(storage.ListFilter{SessionID: "ws"})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("stored records = %d, want 1", len(stored))
+	}
+}
+
+func TestFinalizeUploadMissingChunk(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	upload, err := s.CreateUpload("ws", "main.go", 9)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	for _, chunk := range []struct {
+		offset int64
+		data   string
+	}{{0, "abc"}, {3, "def"}, {6, "ghi"}} {
+		if _, err := s.AppendUpload("ws", upload.ID, chunk.offset, strings.NewReader(chunk.data)); err != nil {
+			t.Fatalf("AppendUpload(%d) error = %v", chunk.offset, err)
+		}
+	}
+
+	// Часть удалена хранилищем (например, истек ключ redis)
+	s.storage.Delete(chunkKey("ws", upload.ID, 3))
+
+	got, _, _, err := s.FinalizeUpload("ws", upload.ID)
+	if !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("FinalizeUpload() error = %v, want %v", err, ErrUploadIncomplete)
+	}
+	if got.Offset != 3 {
+		t.Fatalf("offset = %d, want 3", got.Offset)
+	}
+	if _, ok := s.storage.Get(chunkKey("ws", upload.ID, 6)); ok {
+		t.Fatalf("chunk after the missing one was not deleted")
+	}
+
+	// Загрузка продолжается с нового смещения
+	if _, err := s.AppendUpload("ws", upload.ID, 3, strings.NewReader("DEFGHI")); err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+	_, files, _, err := s.FinalizeUpload("ws", upload.ID)
+	if err != nil {
+		t.Fatalf("FinalizeUpload() error = %v", err)
+	}
+	content, err := s.GetFileByID("ws", files[0].ID)
+	if err != nil {
+		t.Fatalf("GetFileByID() error = %v", err)
+	}
+	if content.Content != "abcDEFGHI" {
+		t.Fatalf("content = %q, want %q", content.Content, "abcDEFGHI")
+	}
+}
+
+func TestAppendUploadConcurrentConflict(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	upload, err := s.CreateUpload("ws", "main.go", 4)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	const writers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.AppendUpload("ws", upload.ID, 0, strings.NewReader("abcd"))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrUploadOffset) && !errors.Is(err, ErrFileTooLarge):
+			t.Fatalf("AppendUpload() unexpected error = %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("successful appends = %d, want 1", succeeded)
+	}
+	state, err := s.GetUpload("ws", upload.ID)
+	if err != nil {
+		t.Fatalf("GetUpload() error = %v", err)
+	}
+	if state.Offset != 4 || len(state.chunks) != 1 {
+		t.Fatalf("upload state = offset %d, %d chunks, want offset 4, 1 chunk", state.Offset, len(state.chunks))
+	}
+}
+
+func TestDeleteUpload(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	upload, err := s.CreateUpload("ws", "main.go", 8)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	if _, err := s.AppendUpload("ws", upload.ID, 0, strings.NewReader("abcd")); err != nil {
+		t.Fatalf("AppendUpload() error = %v", err)
+	}
+
+	if err := s.DeleteUpload("other", upload.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Fatalf("DeleteUpload() from other workspace error = %v, want %v", err, ErrUploadNotFound)
+	}
+	if err := s.DeleteUpload("ws", upload.ID); err != nil {
+		t.Fatalf("DeleteUpload() error = %v", err)
+	}
+	stored, err := s.storage.List(storage.ListFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(stored) != 0 {
+		t.Fatalf("stored records = %d, want 0", len(stored))
+	}
+	if len(s.uploadLocks) != 0 {
+		t.Fatalf("upload locks = %d, want 0", len(s.uploadLocks))
+	}
+}
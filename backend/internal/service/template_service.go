@@ -0,0 +1,560 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит методы для работы с пользовательскими шаблонами объединения.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/utils"
+)
+
+var (
+	// ErrTemplateTimeout возвращается, если отрисовка шаблона не уложилась в отведенное время
+	ErrTemplateTimeout = errors.New("template rendering timed out")
+	// ErrTemplateOutputLimit возвращается, если шаблон сгенерировал слишком большой результат
+	ErrTemplateOutputLimit = errors.New("template output exceeds size limit")
+)
+
+// Ограничения отрисовки шаблона
+const (
+	maxTemplateWidth  = 1000    // Максимальные ширина и точность в формате printf
+	maxTemplateWrites = 1 << 20 // Максимальное количество записей в результат за все блоки
+)
+
+var (
+	templateNumberPattern   = regexp.MustCompile(`\d+`)
+	templateArgIndexPattern = regexp.MustCompile(`\[\d+\]`)
+)
+
+// Блоки шаблона объединения
+const (
+	templatePreamble  = "preamble"  // Текст перед первым файлом
+	templateHeader    = "header"    // Заголовок каждого файла
+	templateBody      = "body"      // Содержимое каждого файла
+	templateSeparator = "separator" // Разделитель между файлами
+	templateFooter    = "footer"    // Текст после последнего файла
+)
+
+// TemplateService предоставляет методы для разбора и хранения шаблонов объединения
+type TemplateService struct {
+	cfg       *config.Config
+	mu        sync.RWMutex
+	templates map[string]*template.Template
+}
+
+// TemplateFile представляет данные файла, доступные в блоках header и body
+type TemplateFile struct {
+	Index            int    // Порядковый номер файла (с 1)
+	Path             string // Относительный путь (с учетом переименования)
+	Filename         string // Имя файла (с учетом переименования)
+	OriginalFilename string // Имя файла при загрузке
+	Lang             string // Язык файла
+	Encoding         string // Исходная кодировка файла
+	Size             int64  // Размер содержимого в байтах
+	LineCount        int    // Количество строк
+	Part             int    // Номер фрагмента файла, разбитого по частям (0 - файл целиком)
+	CommentPrefix    string // Открывающая часть комментария языка файла
+	CommentSuffix    string // Закрывающая часть комментария (для <!-- --> и /* */)
+	Content          string // Содержимое файла
+}
+
+// TemplateSummary представляет данные, доступные в блоках preamble и footer
+type TemplateSummary struct {
+	Files []TemplateFile // Все объединяемые файлы
+	Count int            // Количество файлов
+}
+
+// NewTemplateService создает новый экземпляр TemplateService
+func NewTemplateService(cfg *config.Config) *TemplateService {
+	return &TemplateService{
+		cfg:       cfg,
+		templates: make(map[string]*template.Template),
+	}
+}
+
+// LoadDir регистрирует шаблоны из каталога. Имя шаблона - имя файла *.tmpl без расширения.
+func (s *TemplateService) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return fmt.Errorf("failed to list templates: %v", err)
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read template %s: %v", path, err)
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		if err := s.Register(name, string(source)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register проверяет шаблон и регистрирует его под указанным именем
+func (s *TemplateService) Register(name, source string) error {
+	tmpl, err := s.Parse(source)
+	if err != nil {
+		return fmt.Errorf("invalid template %s: %v", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates[name] = tmpl
+	return nil
+}
+
+// Get возвращает зарегистрированный шаблон по имени
+func (s *TemplateService) Get(name string) (*template.Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, exists := s.templates[name]
+	if !exists {
+		return nil, fmt.Errorf("template not found: %s", name)
+	}
+	return tmpl, nil
+}
+
+// Parse разбирает и проверяет шаблон объединения.
+// Шаблон должен определять хотя бы один из блоков preamble, header, body, separator, footer.
+func (s *TemplateService) Parse(source string) (*template.Template, error) {
+	if len(source) > utils.MaxTemplateSize {
+		return nil, fmt.Errorf("template exceeds maximum size of %d bytes", utils.MaxTemplateSize)
+	}
+
+	// Шаблону не передаются дополнительные функции: доступны только встроенные
+	// функции text/template, не имеющие доступа к файловой системе и сети.
+	// Строящие строки функции заменяются версиями с ограничением размера (см. templateFuncs).
+	tmpl, err := template.New("merge").Option("missingkey=error").Funcs(templateFuncs(nil)).Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			if err := checkTemplateNode(t.Tree.Root, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, name := range []string{templatePreamble, templateHeader, templateBody, templateSeparator, templateFooter} {
+		if tmpl.Lookup(name) != nil {
+			return tmpl, nil
+		}
+	}
+	return nil, fmt.Errorf("template must define at least one of blocks: preamble, header, body, separator, footer")
+}
+
+// checkTemplateNode ограничивает конструкции шаблона так, чтобы время отрисовки
+// зависело только от размера шаблона и количества файлов: range допускается только
+// по .Files и без вложенности, вызовы {{template}} (и {{block}}) запрещены, так как
+// позволяют рекурсию, а формат printf должен быть литералом без больших ширины и точности
+func checkTemplateNode(node parse.Node, inRange bool) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateNode(child, inRange); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPipe(n.Pipe)
+	case *parse.TemplateNode:
+		return fmt.Errorf("template calls are not allowed")
+	case *parse.RangeNode:
+		if inRange {
+			return fmt.Errorf("nested range is not allowed")
+		}
+		if !rangesOverFiles(n.Pipe) {
+			return fmt.Errorf("range is only allowed over .Files")
+		}
+		return checkBranch(&n.BranchNode, true)
+	case *parse.IfNode:
+		if err := checkPipe(n.Pipe); err != nil {
+			return err
+		}
+		return checkBranch(&n.BranchNode, inRange)
+	case *parse.WithNode:
+		if err := checkPipe(n.Pipe); err != nil {
+			return err
+		}
+		return checkBranch(&n.BranchNode, inRange)
+	}
+	return nil
+}
+
+// checkBranch проверяет вложенные узлы ветвления шаблона
+func checkBranch(branch *parse.BranchNode, inRange bool) error {
+	if err := checkTemplateNode(branch.List, inRange); err != nil {
+		return err
+	}
+	return checkTemplateNode(branch.ElseList, inRange)
+}
+
+// checkPipe проверяет вызовы printf в конвейере, включая вложенные в скобки
+func checkPipe(pipe *parse.PipeNode) error {
+	if pipe == nil {
+		return nil
+	}
+	for _, cmd := range pipe.Cmds {
+		if ident, ok := cmd.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "printf" {
+			if err := checkPrintf(cmd); err != nil {
+				return err
+			}
+		}
+		for _, arg := range cmd.Args {
+			switch a := arg.(type) {
+			case *parse.PipeNode:
+				if err := checkPipe(a); err != nil {
+					return err
+				}
+			case *parse.ChainNode:
+				if nested, ok := a.Node.(*parse.PipeNode); ok {
+					if err := checkPipe(nested); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rangesOverFiles проверяет, что range перебирает .Files (или $.Files)
+func rangesOverFiles(pipe *parse.PipeNode) bool {
+	if len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		return len(arg.Ident) == 1 && arg.Ident[0] == "Files"
+	case *parse.VariableNode:
+		return len(arg.Ident) == 2 && arg.Ident[0] == "$" && arg.Ident[1] == "Files"
+	}
+	return false
+}
+
+// checkPrintf требует литеральный формат printf без * и с шириной и точностью
+// не больше maxTemplateWidth: иначе строка размером в гигабайты строится до записи
+// в результат, и ограничение размера не срабатывает
+func checkPrintf(cmd *parse.CommandNode) error {
+	if len(cmd.Args) < 2 {
+		return fmt.Errorf("printf format must be a string literal")
+	}
+	format, ok := cmd.Args[1].(*parse.StringNode)
+	if !ok {
+		return fmt.Errorf("printf format must be a string literal")
+	}
+
+	text := format.Text
+	for i := 0; i < len(text); i++ {
+		if text[i] != '%' {
+			continue
+		}
+		j := i + 1
+		for j < len(text) && strings.IndexByte("+-# 0123456789.[]*", text[j]) >= 0 {
+			j++
+		}
+		spec := text[i+1 : j]
+		if strings.Contains(spec, "*") {
+			return fmt.Errorf("printf width and precision from arguments are not allowed")
+		}
+		// Индексы аргументов [n] на размер результата не влияют
+		for _, number := range templateNumberPattern.FindAllString(templateArgIndexPattern.ReplaceAllString(spec, ""), -1) {
+			if value, err := strconv.Atoi(number); err != nil || value > maxTemplateWidth {
+				return fmt.Errorf("printf width and precision must not exceed %d", maxTemplateWidth)
+			}
+		}
+		i = j
+	}
+	return nil
+}
+
+// templateBudget ограничивает суммарный размер строк, построенных функциями шаблона.
+// Без него переменные и {{with}} позволяют удваивать строку на каждом шаге
+// (например, {{$a := print .Content .Content}}{{$b := print $a $a}}) до записи в результат.
+type templateBudget struct {
+	mu        sync.Mutex
+	remaining int64
+	closed    bool
+}
+
+// charge учитывает построенную строку в бюджете
+func (b *templateBudget) charge(value string) (string, error) {
+	if b == nil {
+		return value, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return "", ErrTemplateTimeout
+	}
+	if int64(len(value)) > b.remaining {
+		return "", ErrTemplateOutputLimit
+	}
+	b.remaining -= int64(len(value))
+	return value, nil
+}
+
+// close запрещает дальнейшие вызовы функций, прерывая отрисовку по истечении времени
+func (b *templateBudget) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+}
+
+// templateFuncs заменяет встроенные функции text/template, строящие строки
+// (print, printf, println, html, js, urlquery), версиями, учитывающими результат в бюджете.
+// Строка вычисляется целиком до проверки, но каждый аргумент уже прошел проверку,
+// поэтому превышение ограничено одним вызовом. При budget == nil ограничений нет:
+// такие функции нужны только для разбора шаблона.
+func templateFuncs(budget *templateBudget) template.FuncMap {
+	return template.FuncMap{
+		"print": func(args ...any) (string, error) {
+			return budget.charge(fmt.Sprint(args...))
+		},
+		"printf": func(format string, args ...any) (string, error) {
+			return budget.charge(fmt.Sprintf(format, args...))
+		},
+		"println": func(args ...any) (string, error) {
+			return budget.charge(fmt.Sprintln(args...))
+		},
+		"html": func(args ...any) (string, error) {
+			return budget.charge(template.HTMLEscaper(args...))
+		},
+		"js": func(args ...any) (string, error) {
+			return budget.charge(template.JSEscaper(args...))
+		},
+		"urlquery": func(args ...any) (string, error) {
+			return budget.charge(template.URLQueryEscaper(args...))
+		},
+	}
+}
+
+// templateFormatter выводит файлы по пользовательскому шаблону.
+// Отрисовка всех блоков ограничена общим временем, размером результата, количеством записей
+// и суммарным размером строк, построенных функциями шаблона.
+type templateFormatter struct {
+	service   *FileService
+	tmpl      *template.Template
+	budget    *templateBudget
+	deadline  time.Time
+	remaining int64
+	writes    int
+	summary   TemplateSummary
+}
+
+// newTemplateFormatter создает форматтер по шаблону
+func (s *FileService) newTemplateFormatter(opts MergeOptions) (*templateFormatter, error) {
+	var tmpl *template.Template
+	var err error
+
+	switch {
+	case opts.Template != "" && opts.TemplateName != "":
+		return nil, fmt.Errorf("only one of template and template name can be specified")
+	case opts.Template != "":
+		tmpl, err = s.templateService.Parse(opts.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v", err)
+		}
+	case opts.TemplateName != "":
+		tmpl, err = s.templateService.Get(opts.TemplateName)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("template format requires template or template name")
+	}
+
+	// Зарегистрированный шаблон общий для всех запросов, поэтому функции с бюджетом
+	// этой отрисовки привязываются к копии
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone template: %v", err)
+	}
+	// Запас на заголовки и разделители относительно максимального объема загруженных файлов
+	limit := 4 * s.cfg.MaxTotalSize
+	budget := &templateBudget{remaining: limit}
+	tmpl.Funcs(templateFuncs(budget))
+
+	// Срок, заданный MergeParts, общий для всех отрисовок запроса
+	deadline := opts.deadline
+	if deadline.IsZero() {
+		deadline = time.Now().Add(s.cfg.TemplateTimeout)
+	}
+
+	return &templateFormatter{
+		service:   s,
+		tmpl:      tmpl,
+		budget:    budget,
+		deadline:  deadline,
+		remaining: limit,
+		writes:    maxTemplateWrites,
+	}, nil
+}
+
+// preamble реализует mergeFormatter
+func (f *templateFormatter) preamble(files []FileContent) (string, error) {
+	f.summary = TemplateSummary{Count: len(files)}
+	for i, file := range files {
+		f.summary.Files = append(f.summary.Files, f.templateFile(i, file))
+	}
+
+	return f.execute(templatePreamble, f.summary, "")
+}
+
+// separator реализует mergeFormatter
+func (f *templateFormatter) separator() (string, error) {
+	return f.execute(templateSeparator, f.summary, "\n\n\n")
+}
+
+// footer реализует mergeFormatter
+func (f *templateFormatter) footer([]FileContent) (string, error) {
+	return f.execute(templateFooter, f.summary, "")
+}
+
+// file реализует mergeFormatter
+func (f *templateFormatter) file(index int, file FileContent) (string, error) {
+	data := f.templateFile(index, file)
+
+	header, err := f.execute(templateHeader, data, f.service.formatFileHeader(data.CommentPrefix, file.Title()))
+	if err != nil {
+		return "", err
+	}
+	body, err := f.execute(templateBody, data, data.Content)
+	if err != nil {
+		return "", err
+	}
+
+	return header + body, nil
+}
+
+// templateFile собирает данные файла для шаблона
+func (f *templateFormatter) templateFile(index int, file FileContent) TemplateFile {
+	prefix := f.service.validationService.GetCommentPrefix(file.Filename)
+
+	return TemplateFile{
+		Index:            index + 1,
+		Path:             file.DisplayName(),
+		Filename:         file.Filename,
+		OriginalFilename: file.OriginalFilename,
+		Lang:             f.service.validationService.GetLanguage(file.Filename),
+		Encoding:         file.Encoding,
+		Size:             file.Size,
+		LineCount:        countLines(file.Content),
+		Part:             file.Part,
+		CommentPrefix:    prefix,
+		CommentSuffix:    commentSuffix(prefix),
+		Content:          file.Content,
+	}
+}
+
+// execute отрисовывает блок шаблона или возвращает значение по умолчанию, если блок не определен.
+// Отрисовка выполняется в отдельной горутине: text/template не поддерживает отмену,
+// поэтому по истечении времени запрос завершается ошибкой, а запись результата и вызовы
+// функций шаблона блокируются. Проверка шаблона в Parse исключает циклы и рекурсию без записи,
+// а бюджеты записей и построенных строк ограничивают работу горутины, поэтому прерванная
+// отрисовка завершается при следующей записи или вызове функции.
+func (f *templateFormatter) execute(name string, data any, fallback string) (string, error) {
+	if f.tmpl.Lookup(name) == nil {
+		return fallback, nil
+	}
+
+	timeout := time.Until(f.deadline)
+	if timeout <= 0 {
+		return "", ErrTemplateTimeout
+	}
+
+	out := &limitedBuffer{limit: f.remaining, writes: f.writes}
+	done := make(chan error, 1)
+	go func() {
+		done <- f.tmpl.ExecuteTemplate(out, name, data)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			if errors.Is(err, ErrTemplateOutputLimit) {
+				return "", ErrTemplateOutputLimit
+			}
+			return "", fmt.Errorf("failed to render template block %s: %v", name, err)
+		}
+		f.remaining -= int64(out.buf.Len())
+		f.writes = out.writes
+		return out.buf.String(), nil
+	case <-timer.C:
+		out.close()
+		f.budget.close()
+		return "", ErrTemplateTimeout
+	}
+}
+
+// limitedBuffer накапливает результат отрисовки с ограничением размера и количества записей
+type limitedBuffer struct {
+	mu     sync.Mutex
+	buf    strings.Builder
+	limit  int64
+	writes int
+	closed bool
+}
+
+// Write реализует io.Writer
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, ErrTemplateTimeout
+	}
+	if b.writes <= 0 || int64(b.buf.Len()+len(p)) > b.limit {
+		return 0, ErrTemplateOutputLimit
+	}
+	b.writes--
+	return b.buf.Write(p)
+}
+
+// close запрещает дальнейшую запись, прерывая отрисовку при следующей записи
+func (b *limitedBuffer) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+}
+
+// commentSuffix возвращает закрывающую часть комментария для префикса
+func commentSuffix(prefix string) string {
+	switch {
+	case strings.Contains(prefix, "<!--"):
+		return "-->"
+	case strings.Contains(prefix, "/*"):
+		return "*/"
+	default:
+		return ""
+	}
+}
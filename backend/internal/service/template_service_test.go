@@ -0,0 +1,233 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты проверки и отрисовки шаблонов объединения.
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MindlessMuse666/code-merger/internal/config"
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+func TestTemplateServiceParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr string
+	}{
+		{
+			name:   "fields and builtins",
+			source: `{{define "header"}}{{.CommentPrefix}} {{.Path}} {{len .Content}} {{printf "%-20s|%5d" .Lang .Size}}{{end}}`,
+		},
+		{
+			name:   "range over files",
+			source: `{{define "preamble"}}{{range $i, $f := .Files}}{{$i}} {{$f.Path}}{{else}}empty{{end}}{{end}}`,
+		},
+		{
+			name:   "range over root files inside with",
+			source: `{{define "footer"}}{{with .Count}}{{range $.Files}}{{.Path}}{{end}}{{end}}{{end}}`,
+		},
+		{
+			name:   "printf with argument index",
+			source: `{{define "header"}}{{printf "%[1]s %%d %[1]q" .Path}}{{end}}`,
+		},
+		{
+			name:    "range over integer literal",
+			source:  `{{define "preamble"}}{{range 1000000000}}{{end}}{{end}}`,
+			wantErr: "range is only allowed over .Files",
+		},
+		{
+			name:    "range over other field",
+			source:  `{{define "body"}}{{range .Content}}{{end}}{{end}}`,
+			wantErr: "range is only allowed over .Files",
+		},
+		{
+			name:    "range over pipeline",
+			source:  `{{define "preamble"}}{{range .Files | len}}{{end}}{{end}}`,
+			wantErr: "range is only allowed over .Files",
+		},
+		{
+			name:    "nested range",
+			source:  `{{define "preamble"}}{{range .Files}}{{range $.Files}}{{end}}{{end}}{{end}}`,
+			wantErr: "nested range is not allowed",
+		},
+		{
+			name:    "nested range in else",
+			source:  `{{define "preamble"}}{{range .Files}}{{else}}{{range .Files}}{{end}}{{end}}{{end}}`,
+			wantErr: "nested range is not allowed",
+		},
+		{
+			name:    "recursive template call",
+			source:  `{{define "loop"}}{{template "loop" .}}{{end}}{{define "preamble"}}{{template "loop" .}}{{end}}`,
+			wantErr: "template calls are not allowed",
+		},
+		{
+			name:    "block",
+			source:  `{{define "preamble"}}{{block "inner" .}}x{{end}}{{end}}`,
+			wantErr: "template calls are not allowed",
+		},
+		{
+			name:    "printf huge width",
+			source:  `{{define "header"}}{{printf "%0999999999d" 1}}{{end}}`,
+			wantErr: "printf width and precision must not exceed",
+		},
+		{
+			name:    "printf huge precision",
+			source:  `{{define "header"}}{{printf "%.5000f" 1.0}}{{end}}`,
+			wantErr: "printf width and precision must not exceed",
+		},
+		{
+			name:    "printf width from argument",
+			source:  `{{define "header"}}{{printf "%[2]*[1]d" 1 1000000000}}{{end}}`,
+			wantErr: "from arguments are not allowed",
+		},
+		{
+			name:    "printf format from data",
+			source:  `{{define "body"}}{{printf .Content 1}}{{end}}`,
+			wantErr: "printf format must be a string literal",
+		},
+		{
+			name:    "printf format from pipeline",
+			source:  `{{define "body"}}{{"%0999999999d" | printf}}{{end}}`,
+			wantErr: "printf format must be a string literal",
+		},
+		{
+			name:    "printf in parentheses",
+			source:  `{{define "body"}}{{if (printf "%9999d" 1)}}{{end}}{{end}}`,
+			wantErr: "printf width and precision must not exceed",
+		},
+		{
+			name:    "no blocks",
+			source:  `{{.Path}}`,
+			wantErr: "template must define at least one of blocks",
+		},
+	}
+
+	service := NewTemplateService(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.Parse(tt.source)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Parse() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimitedBuffer(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int64
+		writes  int
+		chunks  []string
+		want    string
+		wantErr error
+	}{
+		{name: "within limits", limit: 10, writes: 3, chunks: []string{"ab", "cd"}, want: "abcd"},
+		{name: "size limit", limit: 3, writes: 3, chunks: []string{"ab", "cd"}, want: "ab", wantErr: ErrTemplateOutputLimit},
+		{name: "write budget", limit: 10, writes: 2, chunks: []string{"a", "b", "c"}, want: "ab", wantErr: ErrTemplateOutputLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &limitedBuffer{limit: tt.limit, writes: tt.writes}
+			var err error
+			for _, chunk := range tt.chunks {
+				if _, err = b.Write([]byte(chunk)); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Write() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := b.buf.String(); got != tt.want {
+				t.Fatalf("buffer = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("closed", func(t *testing.T) {
+		b := &limitedBuffer{limit: 10, writes: 10}
+		b.close()
+		if _, err := b.Write([]byte("a")); !errors.Is(err, ErrTemplateTimeout) {
+			t.Fatalf("Write() error = %v, want %v", err, ErrTemplateTimeout)
+		}
+	})
+}
+
+func TestTemplateValueAmplification(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	s.cfg.MaxTotalSize = 1 << 16
+
+	// Каждый шаг удваивает строку, не записывая ее в результат
+	var doubling strings.Builder
+	doubling.WriteString(`{{$v := print .Content .Content}}`)
+	for range 30 {
+		doubling.WriteString(`{{$v = print $v $v}}`)
+	}
+	doubling.WriteString(`{{len $v}}`)
+
+	var rebinding strings.Builder
+	rebinding.WriteString(`{{with print .Content .Content}}`)
+	for range 30 {
+		rebinding.WriteString(`{{with urlquery . .}}`)
+	}
+	rebinding.WriteString(`{{len .}}`)
+	rebinding.WriteString(strings.Repeat(`{{end}}`, 31))
+
+	tests := map[string]string{
+		"variable doubling": doubling.String(),
+		"dot rebinding":     rebinding.String(),
+	}
+
+	files := []FileContent{{Filename: "main.go", Content: strings.Repeat("x", 100), Size: 100}}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := MergeOptions{Format: FormatTemplate, Template: `{{define "body"}}` + body + `{{end}}`}
+			if _, err := s.MergeFiles(files, opts); !errors.Is(err, ErrTemplateOutputLimit) {
+				t.Fatalf("MergeFiles() error = %v, want %v", err, ErrTemplateOutputLimit)
+			}
+		})
+	}
+
+	t.Run("within budget", func(t *testing.T) {
+		opts := MergeOptions{Format: FormatTemplate, Template: `{{define "body"}}{{$v := print .Content .Content}}{{printf "%d" (len $v)}}{{end}}`}
+		merged, err := s.MergeFiles(files, opts)
+		if err != nil {
+			t.Fatalf("MergeFiles() error = %v", err)
+		}
+		if !strings.Contains(merged, "200") {
+			t.Fatalf("MergeFiles() = %q, want rendered length 200", merged)
+		}
+	})
+}
+
+func TestMergePartsTemplateDeadline(t *testing.T) {
+	s := newTestFileService(t, storage.NewMemoryStorage())
+	s.cfg.TemplateTimeout = time.Hour
+	files := []FileContent{
+		{Filename: "a.go", Path: "a.go", Content: testSource(5)},
+		{Filename: "b.go", Path: "b.go", Content: testSource(200)},
+	}
+	opts := MergeOptions{Format: FormatTemplate, Template: `{{define "body"}}{{.Path}}: {{.Content}}{{end}}`}
+	limits := MergeLimits{MaxBytes: 4096}
+
+	if _, err := s.MergeParts(files, opts, limits); err != nil {
+		t.Fatalf("MergeParts() error = %v", err)
+	}
+
+	// Срок запроса истек: повторные отрисовки частей не получают новый срок
+	opts.deadline = time.Now().Add(-time.Second)
+	if _, err := s.MergeParts(files, opts, limits); !errors.Is(err, ErrTemplateTimeout) {
+		t.Fatalf("MergeParts() after the deadline error = %v, want %v", err, ErrTemplateTimeout)
+	}
+}
@@ -0,0 +1,50 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит методы для подсчета токенов LLM.
+package service
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// tokenEncoding кодировка BPE, используемая для подсчета токенов
+const tokenEncoding = "cl100k_base"
+
+// TokenService предоставляет методы для подсчета токенов.
+// Словарь BPE встроен в бинарный файл, подсчет не требует доступа к сети.
+type TokenService struct {
+	name     string // Имя кодировки BPE
+	once     sync.Once
+	encoding *tiktoken.Tiktoken
+}
+
+// NewTokenService создает новый экземпляр TokenService
+func NewTokenService() *TokenService {
+	return &TokenService{name: tokenEncoding}
+}
+
+// Count возвращает количество токенов в тексте.
+// Если словарь не удалось загрузить, возвращается оценка из расчета 4 байта на токен.
+func (s *TokenService) Count(text string) int {
+	s.once.Do(s.load)
+
+	if s.encoding == nil {
+		return (len(text) + 3) / 4
+	}
+	return len(s.encoding.EncodeOrdinary(text))
+}
+
+// load загружает встроенный словарь BPE при первом обращении
+func (s *TokenService) load() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+
+	encoding, err := tiktoken.GetEncoding(s.name)
+	if err != nil {
+		log.Printf("failed to load %s tokenizer, using estimation: %v", s.name, err)
+		return
+	}
+	s.encoding = encoding
+}
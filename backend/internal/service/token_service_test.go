@@ -0,0 +1,76 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты подсчета токенов.
+package service
+
+import (
+	"testing"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+func TestTokenServiceCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		encoding  string // Имя кодировки BPE
+		text      string
+		wantCount int
+	}{
+		{name: "empty", encoding: tokenEncoding, text: "", wantCount: 0},
+		{name: "words", encoding: tokenEncoding, text: "hello world", wantCount: 2},
+		{name: "code", encoding: tokenEncoding, text: "func main() {}\n", wantCount: 4},
+		{name: "unicode", encoding: tokenEncoding, text: "Привет, мир", wantCount: 6},
+		// Словарь недоступен: оценка из расчета 4 байта на токен с округлением вверх
+		{name: "unavailable empty", encoding: "missing", text: "", wantCount: 0},
+		{name: "unavailable words", encoding: "missing", text: "hello world", wantCount: 3},
+		{name: "unavailable unicode", encoding: "missing", text: "Привет, мир", wantCount: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &TokenService{name: tt.encoding}
+			if got := s.Count(tt.text); got != tt.wantCount {
+				t.Fatalf("Count(%q) = %d, want %d", tt.text, got, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestUploadTokenCounts(t *testing.T) {
+	contents := map[string]string{
+		"main.go":   "package main\n\nfunc main() {}\n",
+		"README.md": "# Привет, мир\n",
+		"empty.txt": "",
+	}
+
+	for _, encoding := range []string{tokenEncoding, "missing"} {
+		t.Run(encoding, func(t *testing.T) {
+			s := newTestFileService(t, storage.NewMemoryStorage())
+			s.tokenService = &TokenService{name: encoding}
+			counter := &TokenService{name: encoding}
+
+			// Количество токенов считается по содержимому каждого файла при загрузке
+			// и сохраняется вместе с файлом
+			var ids []string
+			for name, content := range contents {
+				file, err := s.ProcessFile("ws", name, []byte(content))
+				if err != nil {
+					t.Fatalf("ProcessFile(%s) error = %v", name, err)
+				}
+				if want := counter.Count(content); file.TokenCount != want {
+					t.Fatalf("%s token count = %d, want %d", name, file.TokenCount, want)
+				}
+				ids = append(ids, file.ID)
+			}
+
+			files, err := s.GetFiles("ws", ids, nil)
+			if err != nil {
+				t.Fatalf("GetFiles() error = %v", err)
+			}
+			for _, file := range files {
+				if want := counter.Count(contents[file.Path]); file.TokenCount != want {
+					t.Fatalf("stored %s token count = %d, want %d", file.Path, file.TokenCount, want)
+				}
+			}
+		})
+	}
+}
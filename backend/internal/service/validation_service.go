@@ -24,19 +24,29 @@ func NewValidationService() *ValidationService {
 func (s *ValidationService) ValidateFile(filename string, content []byte, maxSize int64) error {
 	// Проверка размера файла
 	if int64(len(content)) > maxSize {
-		return fmt.Errorf("file size exceeds limit: %d bytes", len(content))
+		return fmt.Errorf("%w: %d bytes", ErrFileTooLarge, len(content))
 	}
 
-	// Проверка расширения файла
+	if err := s.ValidateName(filename); err != nil {
+		return err
+	}
+	return s.ValidateText(filename, string(content))
+}
+
+// ValidateName проверяет расширение файла. Позволяет отклонить файл до чтения содержимого.
+func (s *ValidationService) ValidateName(filename string) error {
 	if !s.isValidExtension(filename) {
-		return fmt.Errorf("unsupported file extension: %s", filepath.Ext(filename))
+		return fmt.Errorf("%w: extension %s", ErrUnsupportedType, filepath.Ext(filename))
 	}
+	return nil
+}
 
+// ValidateText проверяет, что содержимое файла является текстом
+func (s *ValidationService) ValidateText(filename, content string) error {
 	// Проверка MIME-типа (дополнительная проверка)
 	if !s.isValidMimeType(filename, content) {
-		return fmt.Errorf("file appears to be binary or unsupported type: %s", filename)
+		return fmt.Errorf("%w: %s", ErrBinaryContent, filename)
 	}
-
 	return nil
 }
 
@@ -52,17 +62,17 @@ func (s *ValidationService) isValidExtension(filename string) bool {
 }
 
 // isValidMimeType проверяет MIME-тип файла
-func (s *ValidationService) isValidMimeType(filename string, content []byte) bool {
+func (s *ValidationService) isValidMimeType(filename, content string) bool {
 	// Определяем MIME-тип по расширению и содержимому
 	extType := mime.TypeByExtension(filepath.Ext(filename))
 
 	// Для текстовых файлов ожидаем text/plain или подобные
 	if strings.HasPrefix(extType, "text/") {
-		return s.isTextContent(string(content))
+		return s.isTextContent(content)
 	}
 
 	// Для файлов без явного MIME-типа проверяем содержимое
-	return s.isTextContent(string(content))
+	return s.isTextContent(content)
 }
 
 // isTextContent валидирует, что содержимое является текстовым
@@ -103,3 +113,22 @@ func (s *ValidationService) GetCommentPrefix(filename string) string {
 	// Возвращаем префикс по умолчанию
 	return utils.DefaultCommentPrefix
 }
+
+// GetLanguage возвращает язык указанного файла
+func (s *ValidationService) GetLanguage(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	base := strings.ToLower(filepath.Base(filename))
+
+	// Проверяем специальные случаи (Dockerfile, Makefile)
+	if language, exists := utils.Languages[base]; exists {
+		return language
+	}
+
+	// Проверяем расширение файла
+	if language, exists := utils.Languages[ext]; exists {
+		return language
+	}
+
+	// Возвращаем язык по умолчанию
+	return utils.DefaultLanguage
+}
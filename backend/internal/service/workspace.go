@@ -0,0 +1,140 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит логику рабочих пространств, объединяющих загруженные файлы.
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+// workspaceTokenBytes количество случайных байтов токена рабочего пространства
+const workspaceTokenBytes = 32
+
+// ErrInvalidWorkspace возвращается, если токен рабочего пространства отсутствует или невалиден
+var ErrInvalidWorkspace = errors.New("invalid workspace token")
+
+// Workspace представляет созданное рабочее пространство
+type Workspace struct {
+	Token string `json:"token"` // Токен доступа к рабочему пространству
+	TTL   int64  `json:"ttl"`   // Время жизни без активности в секундах
+}
+
+// CreateWorkspace создает рабочее пространство со случайным токеном.
+// Рабочее пространство не хранится отдельно: его идентификатор выводится из токена,
+// а само пространство существует, пока в нем есть файлы.
+func (s *FileService) CreateWorkspace() (Workspace, error) {
+	token := make([]byte, workspaceTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		return Workspace{}, fmt.Errorf("failed to generate workspace token: %v", err)
+	}
+
+	return Workspace{
+		Token: base64.RawURLEncoding.EncodeToString(token),
+		TTL:   int64(s.cfg.FileTTL.Seconds()),
+	}, nil
+}
+
+// WorkspaceID проверяет токен рабочего пространства и возвращает идентификатор,
+// которым помечаются файлы пространства. Идентификатор - префикс хеша SHA-256 токена,
+// поэтому по ключам хранилища и спискам файлов токен восстановить нельзя.
+func (s *FileService) WorkspaceID(token string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != workspaceTokenBytes {
+		return "", ErrInvalidWorkspace
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// DeleteWorkspace удаляет все файлы и незавершенные загрузки рабочего пространства
+// и возвращает количество удаленных файлов
+func (s *FileService) DeleteWorkspace(workspaceID string) (int, error) {
+	files, err := s.storage.List(storage.ListFilter{SessionID: workspaceID})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, file := range files {
+		s.storage.Delete(file.ID)
+		if file.Data.Upload == nil {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Cleanup удаляет рабочие пространства, в которых дольше maxAge не загружались
+// и не продлевались файлы, сразу со всеми их файлами. Файлы вне рабочих
+// пространств (загруженные до их появления) удаляются по отдельности.
+// Незавершенная загрузка, не получавшая данных дольше maxAge, удаляется
+// целиком, даже если рабочее пространство активно.
+func (s *FileService) Cleanup(maxAge time.Duration) {
+	files, err := s.storage.List(storage.ListFilter{})
+	if err != nil {
+		log.Printf("failed to cleanup storage: %v", err)
+		return
+	}
+
+	// Время последней активности группы - самое позднее время ее записей
+	lastActive := make(map[string]time.Time)
+	for _, file := range files {
+		active := file.Data.LastActive()
+		for _, group := range cleanupGroups(file) {
+			if active.After(lastActive[group]) {
+				lastActive[group] = active
+			}
+		}
+	}
+
+	for _, file := range files {
+		for _, group := range cleanupGroups(file) {
+			if time.Since(lastActive[group]) > maxAge {
+				s.storage.Delete(file.ID)
+				break
+			}
+		}
+	}
+}
+
+// cleanupGroups возвращает группы записей, удаляемых очисткой вместе:
+// рабочее пространство и незавершенную загрузку, которым принадлежит запись
+func cleanupGroups(file storage.StoredFile) []string {
+	var groups []string
+	if file.Data.SessionID != "" {
+		groups = append(groups, "workspace:"+file.Data.SessionID)
+	} else {
+		groups = append(groups, "file:"+file.ID)
+	}
+	if file.Data.Upload != nil {
+		groups = append(groups, "upload:"+file.Data.Upload.ID)
+	}
+	return groups
+}
+
+// fileKey возвращает ключ файла в хранилище. Ключи файлов рабочего пространства
+// содержат его идентификатор, поэтому файл недоступен по ID из другого пространства.
+func fileKey(workspaceID, fileID string) string {
+	if workspaceID == "" {
+		return fileID
+	}
+	return workspaceID + "_" + fileID
+}
+
+// publicFileID возвращает ID файла без префикса рабочего пространства
+func publicFileID(file storage.StoredFile) string {
+	if file.Data.SessionID == "" {
+		return file.ID
+	}
+	return strings.TrimPrefix(file.ID, file.Data.SessionID+"_")
+}
@@ -0,0 +1,234 @@
+// Package service предоставляет сервисный слой для бизнес-логики приложения.
+// Содержит тесты рабочих пространств и очистки устаревших файлов.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"github.com/MindlessMuse666/code-merger/internal/storage"
+)
+
+func TestCleanupRedisTouchedFile(t *testing.T) {
+	server := miniredis.RunT(t)
+	st, err := storage.NewRedisStorage("redis://"+server.Addr(), "files:", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewRedisStorage() error = %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	s := newTestFileService(t, st)
+
+	uploadedAt := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"touched_1", "idle_1"} {
+		data := storage.FileData{Content: "x", Size: 1, SessionID: key[:len(key)-2], UploadedAt: uploadedAt}
+		if err := st.Store(key, data); err != nil {
+			t.Fatalf("Store(%s) error = %v", key, err)
+		}
+	}
+
+	if _, err := s.TouchFile("touched", "1"); err != nil {
+		t.Fatalf("TouchFile() error = %v", err)
+	}
+	// Чтение не продлевает жизнь рабочего пространства
+	if _, err := s.GetFileByID("idle", "1"); err != nil {
+		t.Fatalf("GetFileByID() error = %v", err)
+	}
+
+	s.Cleanup(time.Hour)
+
+	if _, ok := st.Get("touched_1"); !ok {
+		t.Fatalf("touched file was deleted by Cleanup")
+	}
+	if _, ok := st.Get("idle_1"); ok {
+		t.Fatalf("idle file survived Cleanup")
+	}
+}
+
+func TestDuplicateFlagScopedToWorkspace(t *testing.T) {
+	st, err := storage.NewDedupStorage(storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewDedupStorage() error = %v", err)
+	}
+	s := newTestFileService(t, st)
+	content := []byte("package main\n")
+
+	steps := []struct {
+		workspaceID string
+		want        bool
+	}{
+		{workspaceID: "a", want: false},
+		{workspaceID: "b", want: false}, // Содержимое хранится, но загружено в другое пространство
+		{workspaceID: "a", want: true},
+		{workspaceID: "b", want: true},
+		{workspaceID: "", want: false}, // Вне рабочих пространств флаг не вычисляется
+	}
+	for i, step := range steps {
+		file, err := s.ProcessFile(step.workspaceID, "main.go", content)
+		if err != nil {
+			t.Fatalf("step %d: ProcessFile() error = %v", i, err)
+		}
+		if file.Duplicate != step.want {
+			t.Fatalf("step %d: Duplicate in workspace %q = %v, want %v", i, step.workspaceID, file.Duplicate, step.want)
+		}
+	}
+}
+
+// listCountingStorage считает вызовы List хранилища с дедупликацией
+type listCountingStorage struct {
+	*storage.DedupStorage
+	lists int
+}
+
+// List реализует storage.Storage
+func (s *listCountingStorage) List(filter storage.ListFilter) ([]storage.StoredFile, error) {
+	s.lists++
+	return s.DedupStorage.List(filter)
+}
+
+func TestDuplicateFlagSharedContent(t *testing.T) {
+	dedup, err := storage.NewDedupStorage(storage.NewMemoryStorage())
+	if err != nil {
+		t.Fatalf("NewDedupStorage() error = %v", err)
+	}
+	st := &listCountingStorage{DedupStorage: dedup}
+	s := newTestFileService(t, st)
+	if _, err := s.ProcessFile("ws", "old.go", []byte("package old\n")); err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	// Файлы рабочего пространства перечисляются один раз на запрос
+	st.lists = 0
+	known := s.NewWorkspaceContent()
+	contents := []string{"package a\n", "package old\n", "package b\n", "package a\n"}
+	want := []bool{false, true, false, true}
+	for i, content := range contents {
+		file, err := s.ProcessReader("ws", fmt.Sprintf("file%d.go", i), strings.NewReader(content), known)
+		if err != nil {
+			t.Fatalf("ProcessReader(%d) error = %v", i, err)
+		}
+		if file.Duplicate != want[i] {
+			t.Fatalf("file %d: Duplicate = %v, want %v", i, file.Duplicate, want[i])
+		}
+	}
+	if st.lists != 1 {
+		t.Fatalf("List() called %d times, want 1", st.lists)
+	}
+}
+
+// newTestWorkspace создает рабочее пространство и возвращает его идентификатор
+func newTestWorkspace(t *testing.T, s *FileService) string {
+	t.Helper()
+
+	workspace, err := s.CreateWorkspace()
+	if err != nil {
+		t.Fatalf("CreateWorkspace() error = %v", err)
+	}
+	id, err := s.WorkspaceID(workspace.Token)
+	if err != nil {
+		t.Fatalf("WorkspaceID() error = %v", err)
+	}
+	return id
+}
+
+func TestWorkspaceIsolation(t *testing.T) {
+	st := storage.NewMemoryStorage()
+	s := newTestFileService(t, st)
+	owner := newTestWorkspace(t, s)
+	other := newTestWorkspace(t, s)
+
+	file, err := s.ProcessFile(owner, "cmd/main.go", []byte("package main\n"))
+	if err != nil {
+		t.Fatalf("ProcessFile() error = %v", err)
+	}
+
+	// Другое пространство не находит файл ни по публичному ID, ни по ключу хранилища
+	for _, id := range []string{file.ID, fileKey(owner, file.ID)} {
+		t.Run("get "+id, func(t *testing.T) {
+			if _, err := s.GetFileByID(other, id); !errors.Is(err, ErrFileNotFound) {
+				t.Fatalf("GetFileByID() error = %v, want %v", err, ErrFileNotFound)
+			}
+		})
+		t.Run("merge "+id, func(t *testing.T) {
+			if _, err := s.GetFiles(other, []string{id}, nil); !errors.Is(err, ErrFileNotFound) {
+				t.Fatalf("GetFiles() error = %v, want %v", err, ErrFileNotFound)
+			}
+		})
+		t.Run("touch "+id, func(t *testing.T) {
+			if _, err := s.TouchFile(other, id); !errors.Is(err, ErrFileNotFound) {
+				t.Fatalf("TouchFile() error = %v, want %v", err, ErrFileNotFound)
+			}
+			if got, _ := st.Get(fileKey(owner, file.ID)); !got.AccessedAt.IsZero() {
+				t.Fatalf("TouchFile() from another workspace touched the file")
+			}
+		})
+		t.Run("delete "+id, func(t *testing.T) {
+			s.DeleteFiles(other, []string{id})
+			if _, err := s.GetFileByID(owner, file.ID); err != nil {
+				t.Fatalf("DeleteFiles() from another workspace removed the file: %v", err)
+			}
+		})
+	}
+
+	t.Run("list", func(t *testing.T) {
+		files, err := s.ListFiles(storage.ListFilter{SessionID: other})
+		if err != nil || len(files) != 0 {
+			t.Fatalf("ListFiles() = %v, %v, want no files", files, err)
+		}
+	})
+
+	t.Run("delete workspace", func(t *testing.T) {
+		if deleted, err := s.DeleteWorkspace(other); err != nil || deleted != 0 {
+			t.Fatalf("DeleteWorkspace() = %d, %v, want 0", deleted, err)
+		}
+		if _, err := s.GetFileByID(owner, file.ID); err != nil {
+			t.Fatalf("DeleteWorkspace() of another workspace removed the file: %v", err)
+		}
+	})
+
+	t.Run("owner access", func(t *testing.T) {
+		files, err := s.GetFiles(owner, []string{file.ID}, nil)
+		if err != nil || len(files) != 1 || files[0].Path != "cmd/main.go" {
+			t.Fatalf("GetFiles() = %+v, %v, want cmd/main.go", files, err)
+		}
+	})
+}
+
+func TestCleanupWorkspaces(t *testing.T) {
+	st := storage.NewMemoryStorage()
+	s := newTestFileService(t, st)
+	idle := newTestWorkspace(t, s)
+	active := newTestWorkspace(t, s)
+
+	old := time.Now().Add(-2 * time.Hour)
+	stored := map[string]storage.FileData{
+		fileKey(idle, "file_1"):   {Content: "a", Size: 1, SessionID: idle, UploadedAt: old},
+		fileKey(idle, "file_2"):   {Content: "b", Size: 1, SessionID: idle, UploadedAt: old},
+		fileKey(active, "file_1"): {Content: "c", Size: 1, SessionID: active, UploadedAt: old},
+		fileKey(active, "file_2"): {Content: "d", Size: 1, SessionID: active, UploadedAt: time.Now()},
+	}
+	for key, data := range stored {
+		if err := st.Store(key, data); err != nil {
+			t.Fatalf("Store(%s) error = %v", key, err)
+		}
+	}
+
+	s.Cleanup(time.Hour)
+
+	// Рабочее пространство удаляется целиком, только если неактивны все его файлы
+	want := map[string]bool{
+		fileKey(idle, "file_1"):   false,
+		fileKey(idle, "file_2"):   false,
+		fileKey(active, "file_1"): true,
+		fileKey(active, "file_2"): true,
+	}
+	for key, kept := range want {
+		if _, ok := st.Get(key); ok != kept {
+			t.Fatalf("file %s kept = %v, want %v", key, ok, kept)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Package storage предоставляет реализацию интерфейса Storage во встроенной БД bbolt.
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Бакеты БД
+var (
+	metaBucket    = []byte("meta")       // ID -> метаданные в JSON
+	contentBucket = []byte("content")    // ID -> содержимое файла
+	sessionBucket = []byte("by_session") // <сессия>\x00<ID> -> пусто
+	timeBucket    = []byte("by_time")    // <время загрузки, 8 байт>\x00<ID> -> пусто
+)
+
+// timePrefixLen длина закодированного времени в ключе индекса по времени загрузки
+const timePrefixLen = 8
+
+// BoltStorage реализует Storage-интерфейс для хранения файлов во встроенной БД bbolt.
+// Содержимое и метаданные хранятся в отдельных бакетах, индексы по сессии и времени
+// загрузки позволяют выбирать файлы и удалять устаревшие без полного просмотра.
+// Каждая операция выполняется в одной транзакции.
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+// NewBoltStorage открывает (или создает) файл БД по указанному пути
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage database: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{metaBucket, contentBucket, sessionBucket, timeBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize storage database: %v", err)
+	}
+
+	return &BoltStorage{db: db}, nil
+}
+
+// Close закрывает БД
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// Store сохраняет файл в хранилище
+func (s *BoltStorage) Store(id string, data FileData) error {
+	meta := data
+	meta.Content = ""
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		// Индексы прежней версии файла удаляются вместе с ней
+		if err := deleteFile(tx, id); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(metaBucket).Put([]byte(id), metaJSON); err != nil {
+			return err
+		}
+		if err := tx.Bucket(contentBucket).Put([]byte(id), []byte(data.Content)); err != nil {
+			return err
+		}
+		if err := tx.Bucket(sessionBucket).Put(sessionKey(data.SessionID, id), nil); err != nil {
+			return err
+		}
+		return tx.Bucket(timeBucket).Put(timeKey(data.UploadedAt, id), nil)
+	})
+}
+
+// Get возвращает файл из хранилища по ID
+func (s *BoltStorage) Get(id string) (FileData, bool) {
+	var data FileData
+	var found bool
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		meta, err := readMeta(tx, []byte(id))
+		if err != nil || meta == nil {
+			return err
+		}
+
+		data = *meta
+		data.Content = string(tx.Bucket(contentBucket).Get([]byte(id)))
+		found = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to read stored file %s: %v", id, err)
+		return FileData{}, false
+	}
+	return data, found
+}
+
+// Delete удаляет файл из хранилища
+func (s *BoltStorage) Delete(id string) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return deleteFile(tx, id)
+	})
+	if err != nil {
+		log.Printf("failed to delete stored file %s: %v", id, err)
+	}
+}
+
+// Cleanup ничего не делает: записи выполняются в транзакциях и не оставляют
+// незавершенных данных
+func (s *BoltStorage) Cleanup(time.Duration) {}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру.
+// Выборка по сессии и времени загрузки использует индексы.
+func (s *BoltStorage) List(filter ListFilter) ([]StoredFile, error) {
+	var files []StoredFile
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		collect := func(id []byte) error {
+			meta, err := readMeta(tx, id)
+			if err != nil || meta == nil || !filter.Match(*meta) {
+				return err
+			}
+			files = append(files, StoredFile{ID: string(id), Data: *meta})
+			return nil
+		}
+
+		switch {
+		case filter.SessionID != "":
+			prefix := sessionKey(filter.SessionID, "")
+			c := tx.Bucket(sessionBucket).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				if err := collect(k[len(prefix):]); err != nil {
+					return err
+				}
+			}
+		case !filter.UploadedAfter.IsZero() || !filter.UploadedBefore.IsZero():
+			c := tx.Bucket(timeBucket).Cursor()
+			k, _ := c.First()
+			if !filter.UploadedAfter.IsZero() {
+				k, _ = c.Seek(timePrefix(filter.UploadedAfter))
+			}
+			for ; k != nil; k, _ = c.Next() {
+				if !filter.UploadedBefore.IsZero() && bytes.Compare(k, timePrefix(filter.UploadedBefore)) >= 0 {
+					break
+				}
+				if err := collect(k[timePrefixLen+1:]); err != nil {
+					return err
+				}
+			}
+		default:
+			return tx.Bucket(metaBucket).ForEach(func(k, _ []byte) error {
+				return collect(k)
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stored files: %v", err)
+	}
+
+	sortStoredFiles(files)
+	return paginate(files, filter), nil
+}
+
+// Stats возвращает количество, объем и время загрузки самого старого файла
+func (s *BoltStorage) Stats() Stats {
+	var stats Stats
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).ForEach(func(k, _ []byte) error {
+			meta, err := readMeta(tx, k)
+			if err != nil || meta == nil {
+				return err
+			}
+			stats.add(*meta)
+			return nil
+		})
+	})
+	if err != nil {
+		log.Printf("failed to collect storage stats: %v", err)
+	}
+	return stats
+}
+
+// Touch продлевает время жизни файла
+func (s *BoltStorage) Touch(id string) bool {
+	touched := false
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := readMeta(tx, []byte(id))
+		if err != nil || meta == nil {
+			return err
+		}
+		meta.AccessedAt = time.Now()
+
+		metaJSON, err := json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("failed to encode metadata: %v", err)
+		}
+		if err := tx.Bucket(metaBucket).Put([]byte(id), metaJSON); err != nil {
+			return err
+		}
+		touched = true
+		return nil
+	})
+	if err != nil {
+		log.Printf("failed to touch stored file %s: %v", id, err)
+		return false
+	}
+	return touched
+}
+
+// readMeta читает метаданные файла. Возвращает nil, если файл не найден.
+func readMeta(tx *bolt.Tx, id []byte) (*FileData, error) {
+	metaJSON := tx.Bucket(metaBucket).Get(id)
+	if metaJSON == nil {
+		return nil, nil
+	}
+
+	var data FileData
+	if err := json.Unmarshal(metaJSON, &data); err != nil {
+		return nil, fmt.Errorf("invalid metadata of %s: %v", id, err)
+	}
+	return &data, nil
+}
+
+// deleteFile удаляет файл и его записи в индексах
+func deleteFile(tx *bolt.Tx, id string) error {
+	meta, err := readMeta(tx, []byte(id))
+	if err != nil || meta == nil {
+		return err
+	}
+
+	if err := tx.Bucket(sessionBucket).Delete(sessionKey(meta.SessionID, id)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(timeBucket).Delete(timeKey(meta.UploadedAt, id)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(contentBucket).Delete([]byte(id)); err != nil {
+		return err
+	}
+	return tx.Bucket(metaBucket).Delete([]byte(id))
+}
+
+// sessionKey формирует ключ индекса по сессии
+func sessionKey(sessionID, id string) []byte {
+	return []byte(sessionID + "\x00" + id)
+}
+
+// timeKey формирует ключ индекса по времени загрузки.
+// Время кодируется в big-endian, поэтому порядок ключей совпадает с порядком времени.
+func timeKey(t time.Time, id string) []byte {
+	return append(timePrefix(t), append([]byte{0}, id...)...)
+}
+
+// timePrefix кодирует время для индекса по времени загрузки
+func timePrefix(t time.Time) []byte {
+	key := make([]byte, timePrefixLen)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
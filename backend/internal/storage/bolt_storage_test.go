@@ -0,0 +1,134 @@
+// Package storage содержит тесты хранилища bbolt.
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// newTestBoltStorage открывает BoltStorage с БД по пути path и закрывает его по завершении теста
+func newTestBoltStorage(t *testing.T, path string) *BoltStorage {
+	t.Helper()
+
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// indexKeys возвращает количество ключей в индексах по сессии и по времени загрузки
+func indexKeys(t *testing.T, s *BoltStorage) (sessions, times int) {
+	t.Helper()
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		sessions = tx.Bucket(sessionBucket).Stats().KeyN
+		times = tx.Bucket(timeBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View() error = %v", err)
+	}
+	return sessions, times
+}
+
+func TestBoltStorageReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "files.db")
+	uploadedAt := time.Now().Add(-time.Hour).UTC()
+
+	s, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage() error = %v", err)
+	}
+	if err := s.Store("ws_1", FileData{Content: "kept", Path: "cmd/main.go", Size: 4, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := s.Store("ws_upload_x", FileData{SessionID: "ws", UploadedAt: uploadedAt, Upload: &UploadChunk{ID: "x", Length: 10, Chunks: []int64{0}}}); err != nil {
+		t.Fatalf("Store(upload) error = %v", err)
+	}
+	if !s.Touch("ws_1") {
+		t.Fatalf("Touch() = false")
+	}
+	touched, _ := s.Get("ws_1")
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// После повторного открытия БД файлы, метаданные и индексы сохраняются
+	reopened := newTestBoltStorage(t, path)
+
+	got, ok := reopened.Get("ws_1")
+	if !ok || got.Content != "kept" || got.Path != "cmd/main.go" || !got.UploadedAt.Equal(uploadedAt) {
+		t.Fatalf("Get() after reopen = %+v, %v, want the stored file", got, ok)
+	}
+	if touched.AccessedAt.IsZero() || !got.AccessedAt.Equal(touched.AccessedAt) {
+		t.Fatalf("AccessedAt after reopen = %v, want %v", got.AccessedAt, touched.AccessedAt)
+	}
+	upload, ok := reopened.Get("ws_upload_x")
+	if !ok || upload.Upload == nil || len(upload.Upload.Chunks) != 1 {
+		t.Fatalf("Get(upload) after reopen = %+v, %v, want the upload record", upload, ok)
+	}
+
+	files, err := reopened.List(ListFilter{SessionID: "ws", FilesOnly: true})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if ids := storedIDs(files); len(ids) != 1 || ids[0] != "ws_1" {
+		t.Fatalf("List() after reopen = %v, want [ws_1]", ids)
+	}
+}
+
+func TestBoltStorageList(t *testing.T) {
+	testListFilter(t, newTestBoltStorage(t, filepath.Join(t.TempDir(), "files.db")))
+}
+
+func TestBoltStorageIndexes(t *testing.T) {
+	s := newTestBoltStorage(t, filepath.Join(t.TempDir(), "files.db"))
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	if err := s.Store("a_1", FileData{Content: "one", Size: 3, SessionID: "a", UploadedAt: base}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	// Перезапись с другими сессией и временем загрузки заменяет записи индексов
+	if err := s.Store("a_1", FileData{Content: "two", Size: 3, SessionID: "b", UploadedAt: base.Add(time.Hour)}); err != nil {
+		t.Fatalf("Store() overwrite error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   int
+	}{
+		{name: "previous session", filter: ListFilter{SessionID: "a"}, want: 0},
+		{name: "current session", filter: ListFilter{SessionID: "b"}, want: 1},
+		{name: "previous upload time", filter: ListFilter{UploadedBefore: base.Add(time.Minute)}, want: 0},
+		{name: "current upload time", filter: ListFilter{UploadedAfter: base.Add(time.Minute)}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if len(files) != tt.want {
+				t.Fatalf("List() = %v, want %d files", storedIDs(files), tt.want)
+			}
+		})
+	}
+
+	if sessions, times := indexKeys(t, s); sessions != 1 || times != 1 {
+		t.Fatalf("index keys after overwrite = %d, %d, want 1, 1", sessions, times)
+	}
+
+	s.Delete("a_1")
+	if _, ok := s.Get("a_1"); ok {
+		t.Fatalf("Get() after Delete found the file")
+	}
+	if sessions, times := indexKeys(t, s); sessions != 0 || times != 0 {
+		t.Fatalf("index keys after Delete = %d, %d, want 0, 0", sessions, times)
+	}
+}
@@ -0,0 +1,300 @@
+// Package storage предоставляет хранилище с ограничением объема и вытеснением LRU.
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrStorageFull возвращается, если файл не помещается в хранилище даже после вытеснения
+	ErrStorageFull = errors.New("storage capacity exceeded")
+	// ErrQuotaExceeded возвращается, если файл превышает квоту сессии
+	ErrQuotaExceeded = errors.New("session quota exceeded")
+)
+
+// BoundedStorage ограничивает общий объем файлов и объем файлов одной сессии.
+// При превышении общего лимита вытесняются давно не использованные файлы (LRU):
+// использованием считаются сохранение, чтение и продление файла. Квота сессии вытеснением
+// не освобождается: файл, превышающий квоту, отклоняется. Части незавершенных
+// возобновляемых загрузок учитываются, но не вытесняются: иначе загрузка теряла бы
+// уже принятые данные; файл, не помещающийся рядом с ними, отклоняется. Учитывается
+// логический размер файлов (FileData.Size) без учета сжатия и дедупликации.
+type BoundedStorage struct {
+	inner        Storage
+	maxBytes     int64 // Общий лимит в байтах (0 - без ограничения)
+	sessionQuota int64 // Квота сессии в байтах (0 - без ограничения)
+
+	mu          sync.Mutex
+	lru         *list.List               // Файлы от недавно использованных к давно использованным
+	entries     map[string]*list.Element // ID -> элемент lru
+	used        int64                    // Суммарный размер файлов
+	uploadUsed  int64                    // Суммарный размер частей незавершенных загрузок
+	sessionUsed map[string]int64         // Сессия -> суммарный размер файлов
+	generation  uint64                   // Счетчик учтенных файлов, отделяет файлы, учтенные после снимка List
+
+	evictions    int64 // Количество вытесненных файлов
+	evictedBytes int64 // Суммарный размер вытесненных файлов
+	rejections   int64 // Количество отклоненных файлов
+}
+
+// boundedEntry представляет файл в списке LRU
+type boundedEntry struct {
+	id      string
+	session string
+	size    int64
+	upload  bool   // Часть незавершенной загрузки, не вытесняется
+	gen     uint64 // Значение generation при учете файла
+}
+
+// NewBoundedStorage создает хранилище с ограничением объема поверх базового хранилища.
+// Учет объема восстанавливается по файлам базового хранилища в порядке загрузки.
+func NewBoundedStorage(inner Storage, maxBytes, sessionQuota int64) (*BoundedStorage, error) {
+	s := &BoundedStorage{
+		inner:        inner,
+		maxBytes:     maxBytes,
+		sessionQuota: sessionQuota,
+		lru:          list.New(),
+		entries:      make(map[string]*list.Element),
+		sessionUsed:  make(map[string]int64),
+	}
+
+	files, err := inner.List(ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		s.track(file.ID, file.Data)
+	}
+
+	return s, nil
+}
+
+// Store сохраняет файл, при необходимости вытесняя давно не использованные файлы
+func (s *BoundedStorage) Store(id string, data FileData) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Перезаписываемый файл не учитывается в занятом объеме
+	var previous, previousUpload int64
+	if element, ok := s.entries[id]; ok {
+		entry := element.Value.(*boundedEntry)
+		if entry.session == data.SessionID {
+			previous = entry.size
+		}
+		if entry.upload {
+			previousUpload = entry.size
+		}
+	}
+
+	if s.maxBytes > 0 && data.Size > s.maxBytes {
+		s.rejections++
+		return fmt.Errorf("%w: file size %d exceeds storage limit of %d bytes", ErrStorageFull, data.Size, s.maxBytes)
+	}
+	if s.sessionQuota > 0 && data.SessionID != "" && s.sessionUsed[data.SessionID]-previous+data.Size > s.sessionQuota {
+		s.rejections++
+		return fmt.Errorf("%w: session would use %d of %d bytes",
+			ErrQuotaExceeded, s.sessionUsed[data.SessionID]-previous+data.Size, s.sessionQuota)
+	}
+
+	if s.maxBytes > 0 && s.uploadUsed-previousUpload+data.Size > s.maxBytes {
+		s.rejections++
+		return fmt.Errorf("%w: %d bytes are held by unfinished uploads, limit is %d bytes",
+			ErrStorageFull, s.uploadUsed-previousUpload, s.maxBytes)
+	}
+
+	// Вытесняемые файлы выбираются до записи, а учет изменяется только после успешной
+	// записи: при ошибке базового хранилища прежняя версия файла остается учтенной,
+	// а другие файлы не вытесняются
+	victims := s.victims(id, data.Size)
+	if err := s.inner.Store(id, data); err != nil {
+		return err
+	}
+
+	s.untrack(id)
+	for _, entry := range victims {
+		s.evict(entry)
+	}
+	s.track(id, data)
+	return nil
+}
+
+// victims выбирает давно не использованные файлы, которые нужно вытеснить, чтобы
+// на месте файла id поместился файл размера size. Вызывается под блокировкой.
+func (s *BoundedStorage) victims(id string, size int64) []*boundedEntry {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+
+	used := s.used
+	if element, ok := s.entries[id]; ok {
+		used -= element.Value.(*boundedEntry).size
+	}
+
+	var victims []*boundedEntry
+	for element := s.lru.Back(); element != nil && used+size > s.maxBytes; element = element.Prev() {
+		entry := element.Value.(*boundedEntry)
+		if entry.upload || entry.id == id {
+			continue
+		}
+		victims = append(victims, entry)
+		used -= entry.size
+	}
+	return victims
+}
+
+// Get возвращает файл по ID и отмечает его как недавно использованный.
+// Содержимое читается без блокировки, поэтому расхождение с учетом перепроверяется
+// под блокировкой: пока файл читался, его могли удалить, вытеснить или сохранить заново.
+func (s *BoundedStorage) Get(id string) (FileData, bool) {
+	data, ok := s.inner.Get(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, tracked := s.entries[id]
+	switch {
+	case ok && tracked:
+		s.lru.MoveToFront(element)
+	case ok:
+		// Файл не учтен, например сохранен другой репликой
+		if current, exists := s.inner.Get(id); exists {
+			s.track(id, current)
+		}
+	case tracked:
+		// Файл удален базовым хранилищем (например, истек срок жизни ключа)
+		if _, exists := s.inner.Get(id); !exists {
+			s.untrack(id)
+		}
+	}
+	return data, ok
+}
+
+// Delete удаляет файл из хранилища
+func (s *BoundedStorage) Delete(id string) {
+	s.inner.Delete(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.untrack(id)
+}
+
+// Cleanup обслуживает базовое хранилище и синхронизирует учет объема с ним.
+// Список файлов читается без блокировки, поэтому файлы, учтенные после снимка
+// (сохраненные во время чтения списка), не исключаются из учета.
+func (s *BoundedStorage) Cleanup(maxAge time.Duration) {
+	s.inner.Cleanup(maxAge)
+
+	s.mu.Lock()
+	snapshot := s.generation
+	s.mu.Unlock()
+
+	files, err := s.inner.List(ListFilter{})
+	if err != nil {
+		return
+	}
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file.ID] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, element := range s.entries {
+		if !present[id] && element.Value.(*boundedEntry).gen <= snapshot {
+			s.untrack(id)
+		}
+	}
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру
+func (s *BoundedStorage) List(filter ListFilter) ([]StoredFile, error) {
+	return s.inner.List(filter)
+}
+
+// HasContent реализует Deduplicator, если его реализует базовое хранилище
+func (s *BoundedStorage) HasContent(hash string) bool {
+	dedup, ok := s.inner.(Deduplicator)
+	return ok && dedup.HasContent(hash)
+}
+
+// Touch продлевает время жизни файла и отмечает его как недавно использованный
+func (s *BoundedStorage) Touch(id string) bool {
+	if !s.inner.Touch(id) {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[id]; ok {
+		s.lru.MoveToFront(element)
+	}
+	return true
+}
+
+// Stats возвращает статистику базового хранилища с разделом ограничения объема
+func (s *BoundedStorage) Stats() Stats {
+	stats := s.inner.Stats()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats.Quota = &QuotaStats{
+		MaxBytes:     s.maxBytes,
+		SessionQuota: s.sessionQuota,
+		UsedBytes:    s.used,
+		UploadBytes:  s.uploadUsed,
+		Files:        s.lru.Len(),
+		Evictions:    s.evictions,
+		EvictedBytes: s.evictedBytes,
+		Rejections:   s.rejections,
+	}
+	return stats
+}
+
+// evict вытесняет файл из хранилища. Вызывается под блокировкой.
+func (s *BoundedStorage) evict(entry *boundedEntry) {
+	s.inner.Delete(entry.id)
+	s.untrack(entry.id)
+
+	s.evictions++
+	s.evictedBytes += entry.size
+}
+
+// track учитывает файл как недавно использованный. Вызывается под блокировкой.
+func (s *BoundedStorage) track(id string, data FileData) {
+	s.generation++
+	entry := &boundedEntry{id: id, session: data.SessionID, size: data.Size, upload: data.Upload != nil, gen: s.generation}
+	s.entries[id] = s.lru.PushFront(entry)
+	s.used += data.Size
+	if entry.upload {
+		s.uploadUsed += data.Size
+	}
+	s.sessionUsed[data.SessionID] += data.Size
+}
+
+// untrack исключает файл из учета. Вызывается под блокировкой.
+func (s *BoundedStorage) untrack(id string) {
+	element, ok := s.entries[id]
+	if !ok {
+		return
+	}
+	entry := element.Value.(*boundedEntry)
+
+	s.lru.Remove(element)
+	delete(s.entries, id)
+	s.used -= entry.size
+	if entry.upload {
+		s.uploadUsed -= entry.size
+	}
+	s.sessionUsed[entry.session] -= entry.size
+	if s.sessionUsed[entry.session] <= 0 {
+		delete(s.sessionUsed, entry.session)
+	}
+}
@@ -0,0 +1,266 @@
+// Package storage содержит тесты хранилища с ограничением объема и вытеснением LRU.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testFile возвращает файл сессии заданного размера
+func testFile(session string, size int) FileData {
+	return FileData{Content: strings.Repeat("x", size), Size: int64(size), SessionID: session}
+}
+
+// testChunk возвращает часть возобновляемой загрузки заданного размера
+func testChunk(session string, size int) FileData {
+	data := testFile(session, size)
+	data.Upload = &UploadChunk{ID: "upload", Length: int64(size)}
+	return data
+}
+
+func TestBoundedStorageKeepsUploadChunks(t *testing.T) {
+	s, err := NewBoundedStorage(NewMemoryStorage(), 10, 0)
+	if err != nil {
+		t.Fatalf("NewBoundedStorage() error = %v", err)
+	}
+
+	if err := s.Store("chunk", testChunk("a", 6)); err != nil {
+		t.Fatalf("Store(chunk) error = %v", err)
+	}
+	if err := s.Store("old", testFile("a", 3)); err != nil {
+		t.Fatalf("Store(old) error = %v", err)
+	}
+	s.Get("chunk")
+
+	// Часть загрузки использовалась давно, но вытесняется обычный файл
+	if err := s.Store("new", testFile("a", 4)); err != nil {
+		t.Fatalf("Store(new) error = %v", err)
+	}
+	if _, ok := s.Get("chunk"); !ok {
+		t.Fatalf("upload chunk was evicted")
+	}
+	if _, ok := s.Get("old"); ok {
+		t.Fatalf("file was not evicted")
+	}
+
+	// Файл, не помещающийся рядом с частями загрузок, отклоняется без вытеснения
+	if err := s.Store("large", testFile("a", 5)); !errors.Is(err, ErrStorageFull) {
+		t.Fatalf("Store(large) error = %v, want %v", err, ErrStorageFull)
+	}
+	if _, ok := s.Get("new"); !ok {
+		t.Fatalf("file was evicted for a rejected file")
+	}
+
+	stats := s.Stats().Quota
+	if stats.UsedBytes != 10 || stats.UploadBytes != 6 || stats.Evictions != 1 || stats.Rejections != 1 {
+		t.Fatalf("quota stats = %+v, want used 10, upload 6, 1 eviction, 1 rejection", *stats)
+	}
+}
+
+// failingStorage отклоняет запись файлов, пока установлен fail
+type failingStorage struct {
+	Storage
+	fail bool
+}
+
+// Store реализует Storage
+func (s *failingStorage) Store(id string, data FileData) error {
+	if s.fail {
+		return errors.New("inner store failed")
+	}
+	return s.Storage.Store(id, data)
+}
+
+func TestBoundedStorageInnerStoreFailure(t *testing.T) {
+	inner := &failingStorage{Storage: NewMemoryStorage()}
+	s, err := NewBoundedStorage(inner, 10, 0)
+	if err != nil {
+		t.Fatalf("NewBoundedStorage() error = %v", err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := s.Store(id, testFile("ws", 4)); err != nil {
+			t.Fatalf("Store(%s) error = %v", id, err)
+		}
+	}
+
+	inner.fail = true
+	tests := []struct {
+		name string
+		id   string
+		data FileData
+	}{
+		{name: "new file requiring eviction", id: "c", data: testFile("ws", 6)},
+		{name: "overwrite requiring eviction", id: "b", data: testFile("ws", 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Store(tt.id, tt.data); err == nil {
+				t.Fatalf("Store() error = nil, want inner error")
+			}
+
+			for _, id := range []string{"a", "b"} {
+				if got, ok := inner.Get(id); !ok || got.Size != 4 {
+					t.Fatalf("inner file %s = %+v, %v, want the previous version kept", id, got, ok)
+				}
+			}
+			stats := s.Stats().Quota
+			if stats.UsedBytes != 8 || stats.Files != 2 || stats.Evictions != 0 {
+				t.Fatalf("quota stats = %+v, want used 8, 2 files, no evictions", *stats)
+			}
+		})
+	}
+
+	// После сбоя вытеснение работает по прежнему учету
+	inner.fail = false
+	if err := s.Store("b", testFile("ws", 8)); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if _, ok := inner.Get("a"); ok {
+		t.Fatalf("least recently used file was not evicted")
+	}
+	if stats := s.Stats().Quota; stats.UsedBytes != 8 || stats.Files != 1 || stats.Evictions != 1 {
+		t.Fatalf("quota stats = %+v, want used 8, 1 file, 1 eviction", *stats)
+	}
+}
+
+// hookStorage вызывает onList и onGet после чтения базового хранилища,
+// имитируя изменения, выполненные другими запросами во время чтения
+type hookStorage struct {
+	Storage
+	onList func()
+	onGet  func(id string)
+}
+
+// List реализует Storage
+func (s *hookStorage) List(filter ListFilter) ([]StoredFile, error) {
+	files, err := s.Storage.List(filter)
+	if s.onList != nil {
+		s.onList()
+	}
+	return files, err
+}
+
+// Get реализует Storage
+func (s *hookStorage) Get(id string) (FileData, bool) {
+	data, ok := s.Storage.Get(id)
+	if s.onGet != nil {
+		s.onGet(id)
+	}
+	return data, ok
+}
+
+func TestBoundedStorageReconcileRaces(t *testing.T) {
+	t.Run("store during cleanup", func(t *testing.T) {
+		inner := &hookStorage{Storage: NewMemoryStorage()}
+		s, err := NewBoundedStorage(inner, 100, 0)
+		if err != nil {
+			t.Fatalf("NewBoundedStorage() error = %v", err)
+		}
+
+		// Файл сохраняется после снимка List, но до сверки учета
+		inner.onList = func() {
+			inner.onList = nil
+			if err := s.Store("late", testFile("ws", 4)); err != nil {
+				t.Errorf("Store() error = %v", err)
+			}
+		}
+		s.Cleanup(0)
+
+		if stats := s.Stats().Quota; stats.UsedBytes != 4 || stats.Files != 1 {
+			t.Fatalf("quota stats = %+v, want the late file tracked", *stats)
+		}
+	})
+
+	t.Run("delete during get", func(t *testing.T) {
+		inner := &hookStorage{Storage: NewMemoryStorage()}
+		if err := inner.Store("a", testFile("ws", 4)); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		s, err := NewBoundedStorage(inner, 100, 0)
+		if err != nil {
+			t.Fatalf("NewBoundedStorage() error = %v", err)
+		}
+		// Файл исключен из учета, например прежней сверкой, и удаляется во время чтения
+		s.mu.Lock()
+		s.untrack("a")
+		s.mu.Unlock()
+
+		inner.onGet = func(id string) {
+			inner.onGet = nil
+			s.Delete(id)
+		}
+		s.Get("a")
+
+		if stats := s.Stats().Quota; stats.UsedBytes != 0 || stats.Files != 0 {
+			t.Fatalf("quota stats = %+v, want the deleted file untracked", *stats)
+		}
+	})
+
+	t.Run("store during get of a missing file", func(t *testing.T) {
+		inner := &hookStorage{Storage: NewMemoryStorage()}
+		s, err := NewBoundedStorage(inner, 100, 0)
+		if err != nil {
+			t.Fatalf("NewBoundedStorage() error = %v", err)
+		}
+		if err := s.Store("a", testFile("ws", 4)); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		// Базовое хранилище потеряло файл, и он сохраняется заново во время чтения
+		inner.Storage.Delete("a")
+
+		inner.onGet = func(id string) {
+			inner.onGet = nil
+			if err := s.Store(id, testFile("ws", 6)); err != nil {
+				t.Errorf("Store() error = %v", err)
+			}
+		}
+		s.Get("a")
+
+		if stats := s.Stats().Quota; stats.UsedBytes != 6 || stats.Files != 1 {
+			t.Fatalf("quota stats = %+v, want the stored file tracked", *stats)
+		}
+	})
+}
+
+func TestBoundedStorageConcurrentStoreCleanup(t *testing.T) {
+	s, err := NewBoundedStorage(NewMemoryStorage(), 0, 0)
+	if err != nil {
+		t.Fatalf("NewBoundedStorage() error = %v", err)
+	}
+
+	const writers, files = 4, 200
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				s.Cleanup(0)
+			}
+		}
+	}()
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range files {
+				id := fmt.Sprintf("ws_%d_%d", w, i)
+				if err := s.Store(id, testFile("ws", 1)); err != nil {
+					t.Errorf("Store(%s) error = %v", id, err)
+				}
+				s.Get(id)
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	if stats := s.Stats().Quota; stats.UsedBytes != writers*files || stats.Files != writers*files {
+		t.Fatalf("quota stats = %+v, want %d files tracked", *stats, writers*files)
+	}
+}
@@ -0,0 +1,172 @@
+// Package storage предоставляет хранилище со сжатием содержимого файлов.
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Алгоритмы сжатия содержимого
+const (
+	CompressionNone = "none" // Без сжатия
+	CompressionGzip = "gzip" // gzip (compress/gzip)
+	CompressionZstd = "zstd" // Zstandard
+)
+
+// CompressedStorage сжимает содержимое файлов перед сохранением в базовое хранилище
+// и распаковывает при чтении. Алгоритм записывается в FileData.Compression, поэтому
+// файлы, сохраненные с другим алгоритмом или без сжатия, читаются после смены настройки.
+// FileData.Size остается логическим размером, размер сжатого содержимого - в StoredSize.
+type CompressedStorage struct {
+	inner     Storage
+	algorithm string
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+// NewCompressedStorage создает хранилище со сжатием поверх базового хранилища
+func NewCompressedStorage(inner Storage, algorithm string) (*CompressedStorage, error) {
+	if algorithm != CompressionGzip && algorithm != CompressionZstd {
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd encoder: %v", err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zstd decoder: %v", err)
+	}
+
+	return &CompressedStorage{
+		inner:     inner,
+		algorithm: algorithm,
+		encoder:   encoder,
+		decoder:   decoder,
+	}, nil
+}
+
+// Store сжимает содержимое и сохраняет файл в базовое хранилище.
+// Пустое содержимое (например, записи файлов при дедупликации) не сжимается.
+func (s *CompressedStorage) Store(id string, data FileData) error {
+	if data.Content == "" {
+		return s.inner.Store(id, data)
+	}
+
+	compressed, err := s.compress([]byte(data.Content))
+	if err != nil {
+		return fmt.Errorf("failed to compress content: %v", err)
+	}
+
+	data.Content = string(compressed)
+	data.Compression = s.algorithm
+	data.StoredSize = int64(len(compressed))
+	return s.inner.Store(id, data)
+}
+
+// Get возвращает файл с распакованным содержимым
+func (s *CompressedStorage) Get(id string) (FileData, bool) {
+	data, ok := s.inner.Get(id)
+	if !ok || data.Compression == "" {
+		return data, ok
+	}
+
+	content, err := s.decompress(data.Compression, []byte(data.Content))
+	if err != nil {
+		log.Printf("failed to decompress stored file %s: %v", id, err)
+		return FileData{}, false
+	}
+
+	data.Content = string(content)
+	data.Compression = ""
+	data.StoredSize = 0
+	return data, true
+}
+
+// Delete удаляет файл из хранилища
+func (s *CompressedStorage) Delete(id string) {
+	s.inner.Delete(id)
+}
+
+// Cleanup обслуживает базовое хранилище
+func (s *CompressedStorage) Cleanup(maxAge time.Duration) {
+	s.inner.Cleanup(maxAge)
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру
+func (s *CompressedStorage) List(filter ListFilter) ([]StoredFile, error) {
+	return s.inner.List(filter)
+}
+
+// Touch продлевает время жизни файла
+func (s *CompressedStorage) Touch(id string) bool {
+	return s.inner.Touch(id)
+}
+
+// Stats возвращает статистику базового хранилища с разделом сжатия.
+// Степень сжатия рассчитывается по метаданным всех сжатых файлов.
+func (s *CompressedStorage) Stats() Stats {
+	stats := s.inner.Stats()
+
+	files, err := s.inner.List(ListFilter{})
+	if err != nil {
+		log.Printf("failed to collect compression stats: %v", err)
+		return stats
+	}
+
+	compression := &CompressionStats{Algorithm: s.algorithm}
+	for _, file := range files {
+		if file.Data.Compression != "" {
+			compression.Files++
+			compression.LogicalBytes += file.Data.Size
+			compression.StoredBytes += file.Data.StoredSize
+		}
+	}
+	if compression.StoredBytes > 0 {
+		compression.Ratio = float64(compression.LogicalBytes) / float64(compression.StoredBytes)
+	}
+
+	stats.Compression = compression
+	return stats
+}
+
+// compress сжимает содержимое выбранным алгоритмом
+func (s *CompressedStorage) compress(content []byte) ([]byte, error) {
+	if s.algorithm == CompressionZstd {
+		return s.encoder.EncodeAll(content, nil), nil
+	}
+
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress распаковывает содержимое алгоритмом, которым оно было сжато
+func (s *CompressedStorage) decompress(algorithm string, content []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionZstd:
+		return s.decoder.DecodeAll(content, nil)
+	case CompressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
+	}
+}
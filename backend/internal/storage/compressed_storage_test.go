@@ -0,0 +1,142 @@
+// Package storage содержит тесты хранилища со сжатием содержимого.
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCompressedStorage создает CompressedStorage поверх inner
+func newTestCompressedStorage(t *testing.T, inner Storage, algorithm string) *CompressedStorage {
+	t.Helper()
+
+	s, err := NewCompressedStorage(inner, algorithm)
+	if err != nil {
+		t.Fatalf("NewCompressedStorage() error = %v", err)
+	}
+	return s
+}
+
+func TestCompressedStorageRoundTrip(t *testing.T) {
+	contents := []struct {
+		name    string
+		content string
+	}{
+		{name: "text", content: "package main\n"},
+		{name: "unicode", content: "// Привет, 世界\n"},
+		{name: "large", content: strings.Repeat("func main() {}\n", 1<<14)},
+	}
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		for _, tt := range contents {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				inner := NewMemoryStorage()
+				s := newTestCompressedStorage(t, inner, algorithm)
+
+				data := FileData{Content: tt.content, Size: int64(len(tt.content)), Path: "main.go", UploadedAt: time.Now()}
+				if err := s.Store("ws_1", data); err != nil {
+					t.Fatalf("Store() error = %v", err)
+				}
+
+				raw, _ := inner.Get("ws_1")
+				if raw.Compression != algorithm || raw.StoredSize != int64(len(raw.Content)) {
+					t.Fatalf("stored compression = %q, stored size = %d, want %q, %d",
+						raw.Compression, raw.StoredSize, algorithm, len(raw.Content))
+				}
+				if raw.Content == tt.content {
+					t.Fatalf("stored content is not compressed")
+				}
+
+				got, ok := s.Get("ws_1")
+				if !ok {
+					t.Fatalf("Get() not found")
+				}
+				if got.Content != tt.content || got.Compression != "" || got.StoredSize != 0 || got.Path != "main.go" {
+					t.Fatalf("Get() = %q, compression %q, stored size %d, path %q, want %q",
+						truncate(got.Content), got.Compression, got.StoredSize, got.Path, truncate(tt.content))
+				}
+			})
+		}
+	}
+}
+
+func TestCompressedStorageReadsOtherAlgorithms(t *testing.T) {
+	inner := NewMemoryStorage()
+
+	// Файлы, сохраненные до включения сжатия, и пустые записи хранятся как есть
+	legacy := FileData{Content: "package legacy\n", Size: 15, UploadedAt: time.Now()}
+	inner.Store("ws_legacy", legacy)
+	empty := newTestCompressedStorage(t, inner, CompressionZstd)
+	if err := empty.Store("ws_empty", FileData{Path: "empty.go", UploadedAt: time.Now()}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if raw, _ := inner.Get("ws_empty"); raw.Compression != "" {
+		t.Fatalf("empty content stored with compression %q", raw.Compression)
+	}
+
+	// После смены алгоритма читаются файлы, сжатые прежним
+	gzipped := newTestCompressedStorage(t, inner, CompressionGzip)
+	storeContent(t, gzipped, "ws_gzip", "package gzipped\n")
+
+	s := newTestCompressedStorage(t, inner, CompressionZstd)
+	for id, want := range map[string]string{
+		"ws_legacy": "package legacy\n",
+		"ws_empty":  "",
+		"ws_gzip":   "package gzipped\n",
+	} {
+		got, ok := s.Get(id)
+		if !ok || got.Content != want {
+			t.Fatalf("Get(%s) = %q, %v, want %q", id, got.Content, ok, want)
+		}
+	}
+
+	// Поврежденное содержимое не возвращается
+	raw, _ := inner.Get("ws_gzip")
+	raw.Content = raw.Content[:len(raw.Content)/2]
+	inner.Store("ws_gzip", raw)
+	if _, ok := s.Get("ws_gzip"); ok {
+		t.Fatalf("Get() returned corrupted content")
+	}
+}
+
+func TestCompressedStorageSize(t *testing.T) {
+	inner := NewMemoryStorage()
+	s := newTestCompressedStorage(t, inner, CompressionGzip)
+
+	content := strings.Repeat("x := 1\n", 1000)
+	storeContent(t, s, "ws_1", content)
+	storeContent(t, s, "ws_2", "package main\n")
+	inner.Store("ws_legacy", FileData{Content: "legacy", Size: 6, UploadedAt: time.Now()})
+	logical := int64(len(content) + len("package main\n"))
+
+	// Size и метаданные List сохраняют размер до сжатия
+	got, _ := s.Get("ws_1")
+	if got.Size != int64(len(content)) {
+		t.Fatalf("Get() size = %d, want %d", got.Size, len(content))
+	}
+	files, err := s.List(ListFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	for _, file := range files {
+		if file.ID == "ws_1" && file.Data.Size != int64(len(content)) {
+			t.Fatalf("List() size = %d, want %d", file.Data.Size, len(content))
+		}
+	}
+
+	stats := s.Stats()
+	if stats.Files != 3 || stats.Bytes != logical+6 {
+		t.Fatalf("Stats() = %d files, %d bytes, want 3 files, %d bytes", stats.Files, stats.Bytes, logical+6)
+	}
+	compression := stats.Compression
+	if compression == nil {
+		t.Fatalf("Stats() without compression section")
+	}
+	if compression.Algorithm != CompressionGzip || compression.Files != 2 || compression.LogicalBytes != logical {
+		t.Fatalf("compression stats = %+v, want gzip, 2 files, %d logical bytes", *compression, logical)
+	}
+	if compression.StoredBytes >= logical || compression.Ratio <= 1 {
+		t.Fatalf("compression stats = %+v, want stored bytes below logical bytes", *compression)
+	}
+}
@@ -0,0 +1,253 @@
+// Package storage предоставляет хранилище с дедупликацией содержимого файлов.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// blobPrefix префикс ID записей с содержимым в базовом хранилище
+const blobPrefix = "blob_"
+
+// Deduplicator реализуется хранилищами, сохраняющими одинаковое содержимое однократно
+type Deduplicator interface {
+	// HasContent проверяет, хранится ли уже содержимое с указанным хешем SHA-256
+	HasContent(hash string) bool
+}
+
+// DedupStorage сохраняет содержимое файлов однократно, адресуя его хешем SHA-256.
+// Содержимое хранится в базовом хранилище записью blob_<hash>, а запись файла
+// содержит только метаданные и ContentHash. Количество ссылок на содержимое
+// считается в памяти и восстанавливается из базового хранилища при создании;
+// содержимое удаляется вместе с последним ссылающимся на него файлом.
+type DedupStorage struct {
+	inner Storage
+	mu    sync.Mutex
+	refs  map[string]int // Хеш содержимого -> количество файлов
+}
+
+// NewDedupStorage создает хранилище с дедупликацией поверх базового хранилища.
+// Содержимое, на которое не ссылается ни один файл, удаляется.
+func NewDedupStorage(inner Storage) (*DedupStorage, error) {
+	s := &DedupStorage{
+		inner: inner,
+		refs:  make(map[string]int),
+	}
+
+	files, err := inner.List(ListFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if !isBlob(file.ID) && file.Data.ContentHash != "" {
+			s.refs[file.Data.ContentHash]++
+		}
+	}
+	s.removeOrphans(files)
+
+	return s, nil
+}
+
+// HasContent реализует Deduplicator
+func (s *DedupStorage) HasContent(hash string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refs[hash] > 0
+}
+
+// Store сохраняет файл, записывая содержимое только если оно еще не хранится.
+// Ссылка на содержимое резервируется до записи, поэтому параллельные Delete и Cleanup
+// не удаляют его, пока содержимое проверяется и записывается без блокировки.
+func (s *DedupStorage) Store(id string, data FileData) error {
+	if data.ContentHash == "" {
+		data.ContentHash = ContentHash(data.Content)
+	}
+
+	s.mu.Lock()
+	s.refs[data.ContentHash]++
+	s.mu.Unlock()
+
+	// Наличие содержимого проверяется в базовом хранилище: оно могло истечь независимо от ссылок.
+	// Touch читает только метаданные и продлевает время жизни уже хранящегося содержимого.
+	key := blobKey(data.ContentHash)
+	if !s.inner.Touch(key) {
+		err := s.inner.Store(key, FileData{
+			Content:     data.Content,
+			Size:        data.Size,
+			UploadedAt:  data.UploadedAt,
+			ContentHash: data.ContentHash,
+		})
+		if err != nil {
+			s.mu.Lock()
+			s.release(data.ContentHash)
+			s.mu.Unlock()
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Запись файла содержит только метаданные, поэтому ее чтение не затрагивает содержимое
+	previous, overwritten := s.inner.Get(id)
+
+	record := data
+	record.Content = ""
+	if err := s.inner.Store(id, record); err != nil {
+		s.release(data.ContentHash)
+		return err
+	}
+
+	// При перезаписи файла ссылка на прежнее содержимое освобождается
+	if overwritten {
+		s.release(previous.ContentHash)
+	}
+	return nil
+}
+
+// Get возвращает файл по ID вместе с содержимым
+func (s *DedupStorage) Get(id string) (FileData, bool) {
+	if isBlob(id) {
+		return FileData{}, false
+	}
+
+	data, ok := s.inner.Get(id)
+	if !ok {
+		return FileData{}, false
+	}
+	if data.ContentHash == "" {
+		// Файл сохранен без дедупликации
+		return data, true
+	}
+
+	blob, ok := s.inner.Get(blobKey(data.ContentHash))
+	if !ok {
+		log.Printf("content of %s is missing: %s", id, data.ContentHash)
+		return FileData{}, false
+	}
+	data.Content = blob.Content
+	return data, true
+}
+
+// Delete удаляет файл и, если на содержимое больше нет ссылок, само содержимое
+func (s *DedupStorage) Delete(id string) {
+	if isBlob(id) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.inner.Get(id)
+	if !ok {
+		return
+	}
+	s.inner.Delete(id)
+	s.release(data.ContentHash)
+}
+
+// Cleanup обслуживает базовое хранилище и удаляет записи содержимого без ссылок
+func (s *DedupStorage) Cleanup(maxAge time.Duration) {
+	s.inner.Cleanup(maxAge)
+
+	files, err := s.inner.List(ListFilter{})
+	if err != nil {
+		log.Printf("failed to cleanup storage: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeOrphans(files)
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру. Записи содержимого не включаются,
+// поэтому страница выбирается после их исключения.
+func (s *DedupStorage) List(filter ListFilter) ([]StoredFile, error) {
+	all := filter
+	all.Offset, all.Limit = 0, 0
+	stored, err := s.inner.List(all)
+	if err != nil {
+		return nil, err
+	}
+
+	files := stored[:0]
+	for _, file := range stored {
+		if !isBlob(file.ID) {
+			files = append(files, file)
+		}
+	}
+	return paginate(files, filter), nil
+}
+
+// Touch продлевает время жизни файла и его содержимого
+func (s *DedupStorage) Touch(id string) bool {
+	if isBlob(id) {
+		return false
+	}
+
+	data, ok := s.inner.Get(id)
+	if !ok || !s.inner.Touch(id) {
+		return false
+	}
+	// Содержимое продлевается для хранилищ, удаляющих записи независимо (например, redis)
+	if data.ContentHash != "" {
+		s.inner.Touch(blobKey(data.ContentHash))
+	}
+	return true
+}
+
+// Stats возвращает статистику базового хранилища. Количество и объем файлов
+// считаются по записям файлов без учета записей содержимого.
+func (s *DedupStorage) Stats() Stats {
+	stats := s.inner.Stats()
+
+	files := listStats(s)
+	stats.Files, stats.Bytes, stats.Oldest = files.Files, files.Bytes, files.Oldest
+	return stats
+}
+
+// release уменьшает количество ссылок на содержимое и удаляет его при отсутствии ссылок.
+// Вызывается под блокировкой.
+func (s *DedupStorage) release(hash string) {
+	if hash == "" {
+		return
+	}
+
+	s.refs[hash]--
+	if s.refs[hash] <= 0 {
+		delete(s.refs, hash)
+		s.inner.Delete(blobKey(hash))
+	}
+}
+
+// removeOrphans удаляет записи содержимого без ссылок, оставшиеся после сбоев.
+// Вызывается под блокировкой.
+func (s *DedupStorage) removeOrphans(files []StoredFile) {
+	for _, file := range files {
+		if isBlob(file.ID) && s.refs[strings.TrimPrefix(file.ID, blobPrefix)] == 0 {
+			s.inner.Delete(file.ID)
+		}
+	}
+}
+
+// ContentHash возвращает хеш SHA-256 содержимого в шестнадцатеричном виде
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// blobKey возвращает ID записи содержимого с указанным хешем
+func blobKey(hash string) string {
+	return blobPrefix + hash
+}
+
+// isBlob проверяет, является ли ID записью содержимого
+func isBlob(id string) bool {
+	return strings.HasPrefix(id, blobPrefix)
+}
@@ -0,0 +1,157 @@
+// Package storage содержит тесты хранилища с дедупликацией содержимого.
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// errStoreFailed возвращается rejectingStorage при записи файла
+var errStoreFailed = errors.New("store failed")
+
+// rejectingStorage отклоняет запись файлов с ID из failIDs
+type rejectingStorage struct {
+	Storage
+	failIDs map[string]bool
+}
+
+// Store реализует Storage
+func (s *rejectingStorage) Store(id string, data FileData) error {
+	if s.failIDs[id] {
+		return errStoreFailed
+	}
+	return s.Storage.Store(id, data)
+}
+
+// newTestDedupStorage создает DedupStorage поверх inner
+func newTestDedupStorage(t *testing.T, inner Storage) *DedupStorage {
+	t.Helper()
+
+	s, err := NewDedupStorage(inner)
+	if err != nil {
+		t.Fatalf("NewDedupStorage() error = %v", err)
+	}
+	return s
+}
+
+// hasBlob проверяет, хранится ли в inner запись содержимого content
+func hasBlob(inner Storage, content string) bool {
+	_, ok := inner.Get(blobKey(ContentHash(content)))
+	return ok
+}
+
+// storeContent сохраняет файл id с содержимым content
+func storeContent(t *testing.T, s Storage, id, content string) {
+	t.Helper()
+
+	data := FileData{Content: content, Size: int64(len(content)), SessionID: "ws", UploadedAt: time.Now()}
+	if err := s.Store(id, data); err != nil {
+		t.Fatalf("Store(%s) error = %v", id, err)
+	}
+}
+
+func TestDedupStorageRefs(t *testing.T) {
+	inner := NewMemoryStorage()
+	s := newTestDedupStorage(t, inner)
+
+	storeContent(t, s, "ws_1", "shared")
+	storeContent(t, s, "ws_2", "shared")
+	if s.refs[ContentHash("shared")] != 2 {
+		t.Fatalf("refs = %d, want 2", s.refs[ContentHash("shared")])
+	}
+	// Содержимое хранится однократно, а файлы - без содержимого
+	if record, _ := inner.Get("ws_1"); record.Content != "" {
+		t.Fatalf("file record contains content %q", record.Content)
+	}
+	if got, ok := s.Get("ws_2"); !ok || got.Content != "shared" {
+		t.Fatalf("Get() = %+v, %v, want the shared content", got, ok)
+	}
+
+	// Перезапись освобождает ссылку на прежнее содержимое
+	storeContent(t, s, "ws_1", "own")
+	if s.refs[ContentHash("shared")] != 1 || !hasBlob(inner, "shared") {
+		t.Fatalf("after overwrite refs = %d, blob kept = %v, want 1, true", s.refs[ContentHash("shared")], hasBlob(inner, "shared"))
+	}
+
+	// Перезапись тем же содержимым не меняет количество ссылок
+	storeContent(t, s, "ws_1", "own")
+	if s.refs[ContentHash("own")] != 1 {
+		t.Fatalf("after same-content overwrite refs = %d, want 1", s.refs[ContentHash("own")])
+	}
+
+	// Последняя ссылка удаляет содержимое
+	s.Delete("ws_2")
+	if _, ok := s.refs[ContentHash("shared")]; ok || hasBlob(inner, "shared") {
+		t.Fatalf("content without references remains after Delete")
+	}
+	storeContent(t, s, "ws_3", "other")
+	storeContent(t, s, "ws_1", "other")
+	if hasBlob(inner, "own") {
+		t.Fatalf("content without references remains after overwrite")
+	}
+
+	// Ссылки восстанавливаются по записям файлов при повторном создании
+	restored := newTestDedupStorage(t, inner)
+	if restored.refs[ContentHash("other")] != 2 || len(restored.refs) != 1 {
+		t.Fatalf("restored refs = %v, want 2 references to one content", restored.refs)
+	}
+}
+
+func TestDedupStorageFailedStore(t *testing.T) {
+	inner := &rejectingStorage{Storage: NewMemoryStorage(), failIDs: map[string]bool{"ws_bad": true}}
+	s := newTestDedupStorage(t, inner)
+
+	// Запись файла не удалась: новое содержимое не остается без ссылок
+	err := s.Store("ws_bad", FileData{Content: "lost", Size: 4, UploadedAt: time.Now()})
+	if !errors.Is(err, errStoreFailed) {
+		t.Fatalf("Store() error = %v, want %v", err, errStoreFailed)
+	}
+	if hasBlob(inner, "lost") || s.HasContent(ContentHash("lost")) {
+		t.Fatalf("content of a failed Store remains")
+	}
+
+	// Содержимое, на которое ссылаются другие файлы, сохраняется
+	storeContent(t, s, "ws_1", "kept")
+	if err := s.Store("ws_bad", FileData{Content: "kept", Size: 4, UploadedAt: time.Now()}); !errors.Is(err, errStoreFailed) {
+		t.Fatalf("Store() error = %v, want %v", err, errStoreFailed)
+	}
+	if !hasBlob(inner, "kept") || s.refs[ContentHash("kept")] != 1 {
+		t.Fatalf("referenced content after failed Store: blob kept = %v, refs = %d, want true, 1",
+			hasBlob(inner, "kept"), s.refs[ContentHash("kept")])
+	}
+
+	// Не удалась запись содержимого: файл не сохраняется, ссылка не учитывается
+	inner.failIDs[blobKey(ContentHash("blob"))] = true
+	if err := s.Store("ws_2", FileData{Content: "blob", Size: 4, UploadedAt: time.Now()}); !errors.Is(err, errStoreFailed) {
+		t.Fatalf("Store() error = %v, want %v", err, errStoreFailed)
+	}
+	if _, ok := s.Get("ws_2"); ok || s.HasContent(ContentHash("blob")) {
+		t.Fatalf("file stored without its content")
+	}
+}
+
+func TestDedupStorageHasContent(t *testing.T) {
+	inner := NewMemoryStorage()
+	s := newTestDedupStorage(t, inner)
+
+	// HasContent проверяет все хранилище, без учета рабочих пространств:
+	// флаг Duplicate ограничивается рабочим пространством в FileService
+	storeContent(t, s, "a_1", "shared")
+	if !s.HasContent(ContentHash("shared")) || s.HasContent(ContentHash("missing")) {
+		t.Fatalf("HasContent() does not match the stored content")
+	}
+
+	s.Delete("a_1")
+	if s.HasContent(ContentHash("shared")) {
+		t.Fatalf("HasContent() = true after the last reference was deleted")
+	}
+
+	// Содержимое, удаленное базовым хранилищем независимо от ссылок, записывается заново
+	storeContent(t, s, "a_2", "expired")
+	inner.Delete(blobKey(ContentHash("expired")))
+	storeContent(t, s, "b_1", "expired")
+	if got, ok := s.Get("b_1"); !ok || got.Content != "expired" {
+		t.Fatalf("Get() = %+v, %v, want the rewritten content", got, ok)
+	}
+}
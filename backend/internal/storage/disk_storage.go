@@ -0,0 +1,337 @@
+// Package storage предоставляет файловую реализацию интерфейса Storage.
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Расширения файлов дискового хранилища
+const (
+	contentExt = ".content" // Содержимое файла
+	metaExt    = ".meta"    // Метаданные файла в JSON
+	tempExt    = ".tmp"     // Незавершенная запись
+)
+
+// validID ограничивает ID файлов символами, безопасными для имени файла
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// DiskStorage реализует Storage-интерфейс для хранения файлов на диске.
+// Для каждого файла в каталоге хранятся два файла: <id>.content с содержимым
+// и <id>.meta с метаданными. Метаданные записываются последними и служат признаком
+// завершенной записи. Индекс метаданных хранится в памяти и восстанавливается при запуске.
+type DiskStorage struct {
+	dir   string
+	mu    sync.RWMutex
+	index map[string]FileData // Метаданные без содержимого
+}
+
+// NewDiskStorage создает дисковое хранилище в каталоге dir и восстанавливает индекс
+func NewDiskStorage(dir string) (*DiskStorage, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+
+	s := &DiskStorage{
+		dir:   dir,
+		index: make(map[string]FileData),
+	}
+	if err := s.recover(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Store сохраняет файл в хранилище
+func (s *DiskStorage) Store(id string, data FileData) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid file id: %s", id)
+	}
+
+	meta := data
+	meta.Content = ""
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Содержимое и метаданные записываются во временные файлы и заменяют прежние
+	// переименованием. Метаданные переименовываются последними: файл без метаданных
+	// считается незавершенным. Индекс обновляется только после обоих переименований.
+	contentPath, metaPath := s.path(id, contentExt), s.path(id, metaExt)
+	contentTmp, err := writeTemp(contentPath, []byte(data.Content))
+	if err != nil {
+		return fmt.Errorf("failed to write file content: %v", err)
+	}
+	defer os.Remove(contentTmp)
+	metaTmp, err := writeTemp(metaPath, metaJSON)
+	if err != nil {
+		return fmt.Errorf("failed to write file metadata: %v", err)
+	}
+	defer os.Remove(metaTmp)
+
+	// Прежнее содержимое сохраняется жесткой ссылкой, чтобы вернуть его, если не удастся
+	// заменить метаданные
+	_, overwrite := s.index[id]
+	backup := ""
+	if overwrite {
+		backup = contentPath + ".backup" + tempExt
+		os.Remove(backup)
+		if err := os.Link(contentPath, backup); err != nil {
+			backup = ""
+		} else {
+			defer os.Remove(backup)
+		}
+	}
+
+	if err := os.Rename(contentTmp, contentPath); err != nil {
+		return fmt.Errorf("failed to write file content: %v", err)
+	}
+	if err := os.Rename(metaTmp, metaPath); err != nil {
+		switch {
+		case !overwrite:
+			os.Remove(contentPath)
+		case backup != "" && os.Rename(backup, contentPath) == nil:
+			// Прежняя версия файла восстановлена, индекс по-прежнему указывает на нее
+		default:
+			// Прежнее содержимое не восстановить: запись удаляется целиком
+			s.remove(id)
+		}
+		return fmt.Errorf("failed to write file metadata: %v", err)
+	}
+
+	s.index[id] = meta
+	return nil
+}
+
+// Get возвращает файл из хранилища по ID
+func (s *DiskStorage) Get(id string) (FileData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.index[id]
+	if !ok {
+		return FileData{}, false
+	}
+
+	content, err := os.ReadFile(s.path(id, contentExt))
+	if err != nil {
+		log.Printf("failed to read stored file %s: %v", id, err)
+		return FileData{}, false
+	}
+	data.Content = string(content)
+	return data, true
+}
+
+// Delete удаляет файл из хранилища
+func (s *DiskStorage) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(id)
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру
+func (s *DiskStorage) List(filter ListFilter) ([]StoredFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var files []StoredFile
+	for id, data := range s.index {
+		if filter.Match(data) {
+			files = append(files, StoredFile{ID: id, Data: data})
+		}
+	}
+
+	sortStoredFiles(files)
+	return paginate(files, filter), nil
+}
+
+// Stats возвращает количество, объем и время загрузки самого старого файла по индексу
+func (s *DiskStorage) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats Stats
+	for _, data := range s.index {
+		stats.add(data)
+	}
+	return stats
+}
+
+// Touch продлевает время жизни файла, перезаписывая его метаданные
+func (s *DiskStorage) Touch(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.index[id]
+	if !ok {
+		return false
+	}
+	data.AccessedAt = time.Now()
+
+	metaJSON, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to encode metadata of %s: %v", id, err)
+		return false
+	}
+	if err := writeFileAtomic(s.path(id, metaExt), metaJSON); err != nil {
+		log.Printf("failed to write metadata of %s: %v", id, err)
+		return false
+	}
+
+	s.index[id] = data
+	return true
+}
+
+// Cleanup удаляет временные файлы незавершенных записей старше maxAge,
+// оставшиеся после сбоев записи во время работы
+func (s *DiskStorage) Cleanup(maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	temps, err := filepath.Glob(filepath.Join(s.dir, "*"+tempExt))
+	if err != nil {
+		log.Printf("failed to cleanup storage: %v", err)
+		return
+	}
+	for _, temp := range temps {
+		if info, err := os.Stat(temp); err == nil && time.Since(info.ModTime()) > maxAge {
+			os.Remove(temp)
+		}
+	}
+}
+
+// remove удаляет файлы записи и запись индекса. Вызывается под блокировкой.
+func (s *DiskStorage) remove(id string) {
+	if _, ok := s.index[id]; !ok {
+		return
+	}
+	delete(s.index, id)
+
+	// Сначала удаляются метаданные, чтобы при сбое не осталось записи без содержимого
+	if err := os.Remove(s.path(id, metaExt)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove metadata of %s: %v", id, err)
+	}
+	if err := os.Remove(s.path(id, contentExt)); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove content of %s: %v", id, err)
+	}
+}
+
+// recover восстанавливает индекс по файлам метаданных.
+// Незавершенные записи, поврежденные метаданные и содержимое без метаданных удаляются.
+func (s *DiskStorage) recover() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read storage directory: %v", err)
+	}
+
+	contents := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		switch filepath.Ext(name) {
+		case tempExt:
+			os.Remove(filepath.Join(s.dir, name))
+		case contentExt:
+			contents[strings.TrimSuffix(name, contentExt)] = true
+		case metaExt:
+			id := strings.TrimSuffix(name, metaExt)
+			data, err := s.readMeta(id)
+			if err != nil {
+				log.Printf("dropping stored file %s: %v", id, err)
+				os.Remove(filepath.Join(s.dir, name))
+				continue
+			}
+			s.index[id] = data
+		}
+	}
+
+	for id := range s.index {
+		if !contents[id] {
+			log.Printf("dropping stored file %s: content is missing", id)
+			os.Remove(s.path(id, metaExt))
+			delete(s.index, id)
+		}
+	}
+	for id := range contents {
+		if _, ok := s.index[id]; !ok {
+			os.Remove(s.path(id, contentExt))
+		}
+	}
+
+	return nil
+}
+
+// readMeta читает и проверяет метаданные файла
+func (s *DiskStorage) readMeta(id string) (FileData, error) {
+	if !validID.MatchString(id) {
+		return FileData{}, fmt.Errorf("invalid file id")
+	}
+
+	metaJSON, err := os.ReadFile(s.path(id, metaExt))
+	if err != nil {
+		return FileData{}, err
+	}
+
+	var data FileData
+	if err := json.Unmarshal(metaJSON, &data); err != nil {
+		return FileData{}, fmt.Errorf("invalid metadata: %v", err)
+	}
+	return data, nil
+}
+
+// path возвращает путь к файлу записи с указанным расширением
+func (s *DiskStorage) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// writeFileAtomic записывает файл через временный файл и переименование,
+// поэтому при сбое на диске остается либо прежняя, либо новая версия файла
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := writeTemp(path, content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	return os.Rename(tmp, path)
+}
+
+// writeTemp записывает содержимое во временный файл рядом с path и возвращает его путь.
+// Временный файл сброшен на диск и готов к переименованию; при ошибке он удаляется.
+func writeTemp(path string, content []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*"+tempExt)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
@@ -0,0 +1,230 @@
+// Package storage содержит тесты дискового хранилища.
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDiskStorage создает DiskStorage в каталоге dir
+func newTestDiskStorage(t *testing.T, dir string) *DiskStorage {
+	t.Helper()
+
+	s, err := NewDiskStorage(dir)
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+	return s
+}
+
+// tempFiles возвращает временные файлы незавершенных записей в каталоге dir
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	temps, err := filepath.Glob(filepath.Join(dir, "*"+tempExt))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	return temps
+}
+
+func TestDiskStorageStore(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestDiskStorage(t, dir)
+	uploadedAt := time.Now().Add(-time.Minute).UTC()
+
+	if err := s.Store("ws_1", FileData{Content: "first", Path: "a.go", Size: 5, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := s.Store("ws_1", FileData{Content: "second", Path: "b.go", Size: 6, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() overwrite error = %v", err)
+	}
+
+	got, ok := s.Get("ws_1")
+	if !ok || got.Content != "second" || got.Path != "b.go" {
+		t.Fatalf("Get() = %+v, %v, want the overwritten file", got, ok)
+	}
+	if temps := tempFiles(t, dir); len(temps) != 0 {
+		t.Fatalf("temp files remain after Store: %v", temps)
+	}
+	// Содержимое не дублируется в метаданных
+	if data, err := s.readMeta("ws_1"); err != nil || data.Content != "" {
+		t.Fatalf("readMeta() = %+v, %v, want metadata without content", data, err)
+	}
+
+	t.Run("invalid id", func(t *testing.T) {
+		for _, id := range []string{"../escape", "a/b", "a.meta", ""} {
+			if err := s.Store(id, FileData{Content: "x"}); err == nil {
+				t.Fatalf("Store(%q) succeeded", id)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape"+contentExt)); !os.IsNotExist(err) {
+			t.Fatalf("Store() wrote outside the storage directory: %v", err)
+		}
+	})
+}
+
+func TestDiskStorageStoreFailure(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestDiskStorage(t, dir)
+
+	if err := s.Store("ws_1", FileData{Content: "old", Size: 3, SessionID: "ws"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Метаданные не удается заменить: на их месте непустой каталог
+	metaPath := s.path("ws_1", metaExt)
+	if err := os.Remove(metaPath); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(metaPath, "child"), 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+
+	if err := s.Store("ws_1", FileData{Content: "new", Size: 3, SessionID: "ws"}); err == nil {
+		t.Fatalf("Store() over a blocked metadata file succeeded")
+	}
+	// Индекс и содержимое остаются согласованными: прежняя версия восстановлена
+	got, ok := s.Get("ws_1")
+	if !ok || got.Content != "old" {
+		t.Fatalf("Get() after failed overwrite = %+v, %v, want the previous version", got, ok)
+	}
+	if err := s.Store("ws_2", FileData{Content: "two", Size: 3, SessionID: "ws"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if temps := tempFiles(t, dir); len(temps) != 0 {
+		t.Fatalf("temp files remain after failed Store: %v", temps)
+	}
+
+	t.Run("new file", func(t *testing.T) {
+		if err := os.MkdirAll(filepath.Join(s.path("ws_3", metaExt), "child"), 0o700); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+		if err := s.Store("ws_3", FileData{Content: "three", Size: 5, SessionID: "ws"}); err == nil {
+			t.Fatalf("Store() over a blocked metadata file succeeded")
+		}
+		if _, ok := s.Get("ws_3"); ok {
+			t.Fatalf("Get() found a file whose Store failed")
+		}
+		if _, err := os.Stat(s.path("ws_3", contentExt)); !os.IsNotExist(err) {
+			t.Fatalf("content of a failed Store remains: %v", err)
+		}
+	})
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ws_1"+contentExt)
+
+	if err := writeFileAtomic(path, []byte("old")); err != nil {
+		t.Fatalf("writeFileAtomic() error = %v", err)
+	}
+
+	// Переименование поверх каталога не удается: прежняя версия остается, временный файл удаляется
+	blocked := filepath.Join(dir, "blocked")
+	if err := os.MkdirAll(filepath.Join(blocked, "child"), 0o700); err != nil {
+		t.Fatalf("MkdirAll() error = %v", err)
+	}
+	if err := writeFileAtomic(blocked, []byte("new")); err == nil {
+		t.Fatalf("writeFileAtomic() over a directory succeeded")
+	}
+	if info, err := os.Stat(blocked); err != nil || !info.IsDir() {
+		t.Fatalf("failed write replaced the target: %v", err)
+	}
+
+	if err := writeFileAtomic(path, []byte("new")); err != nil {
+		t.Fatalf("writeFileAtomic() overwrite error = %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "new" {
+		t.Fatalf("ReadFile() = %q, %v, want %q", content, err, "new")
+	}
+	if temps := tempFiles(t, dir); len(temps) != 0 {
+		t.Fatalf("temp files remain: %v", temps)
+	}
+}
+
+func TestDiskStorageRecover(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestDiskStorage(t, dir)
+	uploadedAt := time.Now().Add(-time.Hour).UTC()
+
+	if err := s.Store("ws_1", FileData{Content: "kept", Size: 4, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if err := s.Store("ws_upload_x", FileData{SessionID: "ws", UploadedAt: uploadedAt, Upload: &UploadChunk{ID: "x", Length: 10, Chunks: []int64{0}}}); err != nil {
+		t.Fatalf("Store(upload) error = %v", err)
+	}
+	if !s.Touch("ws_1") {
+		t.Fatalf("Touch() = false")
+	}
+	touched, _ := s.Get("ws_1")
+
+	// Следы сбоев: метаданные без содержимого, содержимое без метаданных,
+	// поврежденные метаданные и временный файл незавершенной записи
+	if err := s.Store("ws_2", FileData{Content: "lost", Size: 4, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	leftovers := map[string]string{
+		"ws_3" + contentExt:                    "no metadata",
+		"ws_4" + contentExt:                    "corrupt",
+		"ws_4" + metaExt:                       "{not json",
+		"ws_5" + contentExt + ".123" + tempExt: "partial",
+	}
+	for name, content := range leftovers {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile(%s) error = %v", name, err)
+		}
+	}
+	if err := os.Remove(s.path("ws_2", contentExt)); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	// Перезапуск: индекс восстанавливается по файлам каталога
+	restarted := newTestDiskStorage(t, dir)
+
+	got, ok := restarted.Get("ws_1")
+	if !ok || got.Content != "kept" || got.SessionID != "ws" || !got.UploadedAt.Equal(uploadedAt) {
+		t.Fatalf("Get() after restart = %+v, %v, want the stored file", got, ok)
+	}
+	if !got.AccessedAt.Equal(touched.AccessedAt) {
+		t.Fatalf("AccessedAt after restart = %v, want %v", got.AccessedAt, touched.AccessedAt)
+	}
+	upload, ok := restarted.Get("ws_upload_x")
+	if !ok || upload.Upload == nil || len(upload.Upload.Chunks) != 1 {
+		t.Fatalf("Get(upload) after restart = %+v, %v, want the upload record", upload, ok)
+	}
+
+	files, err := restarted.List(ListFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if ids := storedIDs(files); len(ids) != 2 || ids[0] != "ws_1" || ids[1] != "ws_upload_x" {
+		t.Fatalf("List() after restart = %v, want [ws_1 ws_upload_x]", ids)
+	}
+
+	for _, name := range []string{"ws_2" + metaExt, "ws_3" + contentExt, "ws_4" + contentExt, "ws_4" + metaExt} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s remains after restart: %v", name, err)
+		}
+	}
+	if temps := tempFiles(t, dir); len(temps) != 0 {
+		t.Fatalf("temp files remain after restart: %v", temps)
+	}
+}
+
+func TestDiskStorageList(t *testing.T) {
+	dir := t.TempDir()
+	testListFilter(t, newTestDiskStorage(t, dir))
+
+	t.Run("after restart", func(t *testing.T) {
+		files, err := newTestDiskStorage(t, dir).List(ListFilter{SessionID: "a", FilesOnly: true, Offset: 1})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if ids := storedIDs(files); len(ids) != 2 || ids[0] != "a_2" || ids[1] != "a_3" {
+			t.Fatalf("List() after restart = %v, want [a_2 a_3]", ids)
+		}
+	})
+}
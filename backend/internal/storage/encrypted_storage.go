@@ -0,0 +1,185 @@
+// Package storage предоставляет хранилище с шифрованием содержимого файлов.
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// EncryptionKey представляет ключ шифрования с идентификатором
+type EncryptionKey struct {
+	ID  string // Идентификатор ключа, сохраняется в метаданных файла
+	Key []byte // Ключ AES-128, AES-192 или AES-256
+}
+
+// EncryptedStorage шифрует содержимое файлов AES-GCM перед сохранением в базовое
+// хранилище и расшифровывает при чтении. Новые файлы шифруются текущим (первым)
+// ключом, его идентификатор записывается в FileData.KeyID. Остальные ключи
+// используются только для чтения файлов, зашифрованных до ротации.
+// ID файла используется как дополнительные данные AEAD, поэтому содержимое
+// нельзя подставить в запись другого файла. Метаданные не шифруются.
+type EncryptedStorage struct {
+	inner   Storage
+	current string                 // Идентификатор ключа для новых файлов
+	aeads   map[string]cipher.AEAD // Идентификатор ключа -> шифр
+}
+
+// NewEncryptedStorage создает хранилище с шифрованием поверх базового хранилища.
+// Первый ключ списка используется для шифрования новых файлов.
+func NewEncryptedStorage(inner Storage, keys []EncryptionKey) (*EncryptedStorage, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no encryption keys configured")
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("encryption key id is empty")
+		}
+		if _, exists := aeads[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate encryption key id: %s", key.ID)
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", key.ID, err)
+		}
+		aeads[key.ID] = aead
+	}
+
+	return &EncryptedStorage{
+		inner:   inner,
+		current: keys[0].ID,
+		aeads:   aeads,
+	}, nil
+}
+
+// ParseEncryptionKeys разбирает список ключей вида id1:base64,id2:base64.
+// Ключи кодируются стандартным base64 и должны иметь длину 16, 24 или 32 байта.
+func ParseEncryptionKeys(spec string) ([]EncryptionKey, error) {
+	var keys []EncryptionKey
+	for i, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(item, ":")
+		if !ok {
+			// Значение без идентификатора может быть самим ключом, поэтому в ошибку не включается
+			return nil, fmt.Errorf("invalid encryption key #%d: expected id:base64", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", id, err)
+		}
+		keys = append(keys, EncryptionKey{ID: id, Key: key})
+	}
+	return keys, nil
+}
+
+// Store шифрует содержимое текущим ключом и сохраняет файл в базовое хранилище.
+// Пустое содержимое (например, записи файлов при дедупликации) не шифруется.
+func (s *EncryptedStorage) Store(id string, data FileData) error {
+	if data.Content == "" {
+		data.KeyID = ""
+		return s.inner.Store(id, data)
+	}
+
+	aead := s.aeads[s.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	// Одноразовое число хранится перед шифротекстом
+	sealed := aead.Seal(nonce, nonce, []byte(data.Content), []byte(id))
+	data.Content = string(sealed)
+	data.KeyID = s.current
+	return s.inner.Store(id, data)
+}
+
+// Get возвращает файл с расшифрованным содержимым
+func (s *EncryptedStorage) Get(id string) (FileData, bool) {
+	data, ok := s.inner.Get(id)
+	if !ok || data.KeyID == "" {
+		return data, ok
+	}
+
+	aead, known := s.aeads[data.KeyID]
+	if !known {
+		log.Printf("stored file %s is encrypted with unknown key %s", id, data.KeyID)
+		return FileData{}, false
+	}
+
+	sealed := []byte(data.Content)
+	if len(sealed) < aead.NonceSize() {
+		log.Printf("failed to decrypt stored file %s: ciphertext too short", id)
+		return FileData{}, false
+	}
+	content, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		log.Printf("failed to decrypt stored file %s: %v", id, err)
+		return FileData{}, false
+	}
+
+	data.Content = string(content)
+	data.KeyID = ""
+	return data, true
+}
+
+// Delete удаляет файл из хранилища
+func (s *EncryptedStorage) Delete(id string) {
+	s.inner.Delete(id)
+}
+
+// Cleanup обслуживает базовое хранилище
+func (s *EncryptedStorage) Cleanup(maxAge time.Duration) {
+	s.inner.Cleanup(maxAge)
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру
+func (s *EncryptedStorage) List(filter ListFilter) ([]StoredFile, error) {
+	return s.inner.List(filter)
+}
+
+// Stats возвращает статистику базового хранилища с разделом шифрования.
+// Количество записей по ключам рассчитывается по метаданным всех записей и включает
+// все настроенные ключи: ключ с нулевым количеством можно удалить из списка.
+func (s *EncryptedStorage) Stats() Stats {
+	stats := s.inner.Stats()
+
+	files, err := s.inner.List(ListFilter{})
+	if err != nil {
+		log.Printf("failed to collect encryption stats: %v", err)
+		return stats
+	}
+
+	encryption := &EncryptionStats{CurrentKey: s.current, Keys: make(map[string]int, len(s.aeads))}
+	for id := range s.aeads {
+		encryption.Keys[id] = 0
+	}
+	for _, file := range files {
+		if file.Data.KeyID != "" {
+			encryption.Keys[file.Data.KeyID]++
+		}
+	}
+
+	stats.Encryption = encryption
+	return stats
+}
+
+// Touch продлевает время жизни файла
+func (s *EncryptedStorage) Touch(id string) bool {
+	return s.inner.Touch(id)
+}
@@ -0,0 +1,258 @@
+// Package storage содержит тесты хранилища с шифрованием содержимого.
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testKey возвращает ключ AES-256 с заданным идентификатором
+func testKey(id string) EncryptionKey {
+	return EncryptionKey{ID: id, Key: bytes.Repeat([]byte(id[:1]), 32)}
+}
+
+// newTestEncryptedStorage создает EncryptedStorage поверх хранилища
+func newTestEncryptedStorage(t *testing.T, inner Storage, keys ...EncryptionKey) *EncryptedStorage {
+	t.Helper()
+
+	s, err := NewEncryptedStorage(inner, keys)
+	if err != nil {
+		t.Fatalf("NewEncryptedStorage() error = %v", err)
+	}
+	return s
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantKeyID string // Идентификатор ключа в базовом хранилище
+	}{
+		{name: "text", content: "package main\n", wantKeyID: "a"},
+		{name: "unicode", content: "// Привет, 世界\n", wantKeyID: "a"},
+		{name: "large", content: strings.Repeat("x", 1<<20), wantKeyID: "a"},
+		{name: "empty", content: "", wantKeyID: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := NewMemoryStorage()
+			s := newTestEncryptedStorage(t, inner, testKey("a"))
+
+			if err := s.Store("ws_1", FileData{Content: tt.content, Path: "main.go"}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			raw, _ := inner.Get("ws_1")
+			if raw.KeyID != tt.wantKeyID {
+				t.Fatalf("stored key id = %q, want %q", raw.KeyID, tt.wantKeyID)
+			}
+			if tt.content != "" && strings.Contains(raw.Content, tt.content) {
+				t.Fatalf("stored content is not encrypted")
+			}
+
+			got, ok := s.Get("ws_1")
+			if !ok {
+				t.Fatalf("Get() not found")
+			}
+			if got.Content != tt.content || got.KeyID != "" || got.Path != "main.go" {
+				t.Fatalf("Get() = %q, key %q, path %q, want %q", truncate(got.Content), got.KeyID, got.Path, truncate(tt.content))
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageRejectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(inner Storage)
+	}{
+		{
+			name: "content moved to another file",
+			tamper: func(inner Storage) {
+				data, _ := inner.Get("ws_1")
+				inner.Store("ws_2", data)
+			},
+		},
+		{
+			name: "modified ciphertext",
+			tamper: func(inner Storage) {
+				data, _ := inner.Get("ws_1")
+				sealed := []byte(data.Content)
+				sealed[len(sealed)-1] ^= 1
+				data.Content = string(sealed)
+				inner.Store("ws_2", data)
+			},
+		},
+		{
+			name: "truncated ciphertext",
+			tamper: func(inner Storage) {
+				data, _ := inner.Get("ws_1")
+				data.Content = data.Content[:4]
+				inner.Store("ws_2", data)
+			},
+		},
+		{
+			name: "unknown key",
+			tamper: func(inner Storage) {
+				data, _ := inner.Get("ws_1")
+				data.KeyID = "missing"
+				inner.Store("ws_2", data)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner := NewMemoryStorage()
+			s := newTestEncryptedStorage(t, inner, testKey("a"))
+			if err := s.Store("ws_1", FileData{Content: "secret"}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			tt.tamper(inner)
+			if _, ok := s.Get("ws_2"); ok {
+				t.Fatalf("Get() of a tampered file succeeded")
+			}
+		})
+	}
+}
+
+func TestEncryptedStorageKeyRotation(t *testing.T) {
+	inner := NewMemoryStorage()
+	old := newTestEncryptedStorage(t, inner, testKey("a"))
+	if err := old.Store("ws_1", FileData{Content: "before rotation"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Новый ключ добавлен в начало списка
+	rotated := newTestEncryptedStorage(t, inner, testKey("b"), testKey("a"))
+	if err := rotated.Store("ws_2", FileData{Content: "after rotation"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	for id, want := range map[string]string{"ws_1": "before rotation", "ws_2": "after rotation"} {
+		got, ok := rotated.Get(id)
+		if !ok || got.Content != want {
+			t.Fatalf("Get(%s) = %q, %v, want %q", id, got.Content, ok, want)
+		}
+	}
+	if raw, _ := inner.Get("ws_2"); raw.KeyID != "b" {
+		t.Fatalf("new file key id = %q, want %q", raw.KeyID, "b")
+	}
+
+	stats := rotated.Stats().Encryption
+	if stats == nil || stats.CurrentKey != "b" || stats.Keys["a"] != 1 || stats.Keys["b"] != 1 {
+		t.Fatalf("encryption stats = %+v, want current b, 1 file per key", stats)
+	}
+
+	// После удаления прежнего ключа зашифрованные им файлы недоступны
+	withoutOld := newTestEncryptedStorage(t, inner, testKey("b"))
+	if _, ok := withoutOld.Get("ws_1"); ok {
+		t.Fatalf("Get() of a file encrypted with a removed key succeeded")
+	}
+	if stats := withoutOld.Stats().Encryption; stats.Keys["a"] != 1 {
+		t.Fatalf("removed key count = %d, want 1", stats.Keys["a"])
+	}
+
+	inner.Delete("ws_1")
+	if stats := rotated.Stats().Encryption; stats.Keys["a"] != 0 || len(stats.Keys) != 2 {
+		t.Fatalf("encryption stats = %+v, want key a with 0 files", stats.Keys)
+	}
+}
+
+func TestEncryptedStorageDedupKeepsOldKey(t *testing.T) {
+	inner := NewMemoryStorage()
+	newDedup := func(keys ...EncryptionKey) *DedupStorage {
+		dedup, err := NewDedupStorage(newTestEncryptedStorage(t, inner, keys...))
+		if err != nil {
+			t.Fatalf("NewDedupStorage() error = %v", err)
+		}
+		return dedup
+	}
+
+	if err := newDedup(testKey("a")).Store("ws_1", FileData{Content: "shared", SessionID: "ws"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Повторная загрузка того же содержимого после ротации не перешифровывает его
+	rotated := newDedup(testKey("b"), testKey("a"))
+	if err := rotated.Store("ws_2", FileData{Content: "shared", SessionID: "ws"}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	rotated.Delete("ws_1")
+
+	if got, ok := rotated.Get("ws_2"); !ok || got.Content != "shared" {
+		t.Fatalf("Get() = %q, %v, want %q", got.Content, ok, "shared")
+	}
+	if keys := rotated.Stats().Encryption.Keys; keys["a"] != 1 || keys["b"] != 0 {
+		t.Fatalf("encryption keys = %v, want the blob still encrypted with a", keys)
+	}
+}
+
+func TestParseEncryptionKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantIDs []string
+		wantErr bool
+	}{
+		{name: "empty", spec: "", wantIDs: nil},
+		{name: "single", spec: "a:" + strings.Repeat("A", 44), wantIDs: []string{"a"}},
+		{name: "list with spaces", spec: " b:" + strings.Repeat("A", 44) + " , a:" + strings.Repeat("A", 44) + ",", wantIDs: []string{"b", "a"}},
+		{name: "missing id", spec: strings.Repeat("A", 44), wantErr: true},
+		{name: "invalid base64", spec: "a:not base64", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseEncryptionKeys(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEncryptionKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if strings.Contains(err.Error(), strings.Repeat("A", 44)) {
+					t.Fatalf("error contains the key: %v", err)
+				}
+				return
+			}
+
+			ids := make([]string, 0, len(keys))
+			for _, key := range keys {
+				ids = append(ids, key.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Fatalf("ParseEncryptionKeys() ids = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestNewEncryptedStorageValidatesKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []EncryptionKey
+	}{
+		{name: "no keys", keys: nil},
+		{name: "empty id", keys: []EncryptionKey{{ID: "", Key: make([]byte, 32)}}},
+		{name: "duplicate id", keys: []EncryptionKey{testKey("a"), testKey("a")}},
+		{name: "invalid length", keys: []EncryptionKey{{ID: "a", Key: make([]byte, 20)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEncryptedStorage(NewMemoryStorage(), tt.keys); err == nil {
+				t.Fatalf("NewEncryptedStorage() error = nil, want error")
+			}
+		})
+	}
+}
+
+// truncate сокращает строку для сообщения об ошибке
+func truncate(s string) string {
+	if len(s) > 64 {
+		return s[:64] + "..."
+	}
+	return s
+}
@@ -18,11 +18,12 @@ func NewMemoryStorage() *MemoryStorage {
 }
 
 // Store сохраняет файл в хранилище
-func (s *MemoryStorage) Store(id string, data FileData) {
+func (s *MemoryStorage) Store(id string, data FileData) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.files.Store(id, data)
+	return nil
 }
 
 // Get возвращает файл из хранилища по ID
@@ -45,18 +46,53 @@ func (s *MemoryStorage) Delete(id string) {
 	s.files.Delete(id)
 }
 
-// Cleanup удаляет файлы, которые старше указанного возраста
-func (s *MemoryStorage) Cleanup(maxAge time.Duration) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// List возвращает метаданные файлов, удовлетворяющих фильтру
+func (s *MemoryStorage) List(filter ListFilter) ([]StoredFile, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
+	var files []StoredFile
 	s.files.Range(func(key, value any) bool {
+		if data, ok := value.(FileData); ok && filter.Match(data) {
+			data.Content = ""
+			files = append(files, StoredFile{ID: key.(string), Data: data})
+		}
+		return true
+	})
+
+	sortStoredFiles(files)
+	return paginate(files, filter), nil
+}
+
+// Stats возвращает количество, объем и время загрузки самого старого файла
+func (s *MemoryStorage) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats Stats
+	s.files.Range(func(_, value any) bool {
 		if data, ok := value.(FileData); ok {
-			if time.Since(data.UploadedAt) > maxAge {
-				s.files.Delete(key)
-			}
+			stats.add(data)
 		}
 		return true
 	})
+	return stats
+}
+
+// Touch продлевает время жизни файла
+func (s *MemoryStorage) Touch(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
+	val, ok := s.files.Load(id)
+	if !ok {
+		return false
+	}
+	data := val.(FileData)
+	data.AccessedAt = time.Now()
+	s.files.Store(id, data)
+	return true
 }
+
+// Cleanup ничего не делает: в памяти не остается данных, не принадлежащих файлам
+func (s *MemoryStorage) Cleanup(time.Duration) {}
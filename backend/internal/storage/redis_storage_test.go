@@ -0,0 +1,239 @@
+// Package storage содержит тесты хранилища Redis на встроенном сервере miniredis.
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testRedisTTL - время жизни ключей в тестах
+const testRedisTTL = 10 * time.Minute
+
+// newTestRedisStorage создает RedisStorage, подключенное к miniredis
+func newTestRedisStorage(t *testing.T) (*RedisStorage, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	s, err := NewRedisStorage("redis://"+server.Addr(), "files:", testRedisTTL)
+	if err != nil {
+		t.Fatalf("NewRedisStorage() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, server
+}
+
+func TestRedisStorageStoreGetDelete(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	data := FileData{Content: "package main\n", Path: "cmd/main.go", Size: 13, SessionID: "ws", UploadedAt: time.Now().UTC()}
+
+	if err := s.Store("ws_1", data); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if got := server.TTL("files:ws_1"); got != testRedisTTL {
+		t.Fatalf("TTL after Store = %v, want %v", got, testRedisTTL)
+	}
+
+	got, ok := s.Get("ws_1")
+	if !ok {
+		t.Fatalf("Get() not found")
+	}
+	if got.Content != data.Content || got.Path != data.Path || !got.UploadedAt.Equal(data.UploadedAt) {
+		t.Fatalf("Get() = %+v, want %+v", got, data)
+	}
+
+	// Перезапись заменяет все поля и заново устанавливает время жизни
+	server.FastForward(time.Minute)
+	data.Content = "package other\n"
+	if err := s.Store("ws_1", data); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if got := server.TTL("files:ws_1"); got != testRedisTTL {
+		t.Fatalf("TTL after overwrite = %v, want %v", got, testRedisTTL)
+	}
+	if got, _ := s.Get("ws_1"); got.Content != data.Content {
+		t.Fatalf("Get() content = %q, want %q", got.Content, data.Content)
+	}
+
+	s.Delete("ws_1")
+	if _, ok := s.Get("ws_1"); ok {
+		t.Fatalf("Get() after Delete found the file")
+	}
+	if server.Exists("files:ws_1") {
+		t.Fatalf("key remains after Delete")
+	}
+}
+
+func TestRedisStorageTTL(t *testing.T) {
+	tests := []struct {
+		name    string
+		refresh func(s *RedisStorage) bool // Действие в середине времени жизни (nil - без действия)
+		wantTTL time.Duration              // Время жизни после действия
+		alive   bool                       // Файл жив через 3/4 времени жизни после действия
+	}{
+		{
+			name:    "no access",
+			wantTTL: testRedisTTL / 2,
+			alive:   false,
+		},
+		{
+			name:    "get refreshes",
+			refresh: func(s *RedisStorage) bool { _, ok := s.Get("ws_1"); return ok },
+			wantTTL: testRedisTTL,
+			alive:   true,
+		},
+		{
+			name:    "touch refreshes",
+			refresh: func(s *RedisStorage) bool { return s.Touch("ws_1") },
+			wantTTL: testRedisTTL,
+			alive:   true,
+		},
+		{
+			name:    "list does not refresh",
+			refresh: func(s *RedisStorage) bool { files, err := s.List(ListFilter{}); return err == nil && len(files) == 1 },
+			wantTTL: testRedisTTL / 2,
+			alive:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, server := newTestRedisStorage(t)
+			if err := s.Store("ws_1", FileData{Content: "x", Size: 1, SessionID: "ws", UploadedAt: time.Now()}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			server.FastForward(testRedisTTL / 2)
+			if tt.refresh != nil && !tt.refresh(s) {
+				t.Fatalf("refresh failed")
+			}
+			if got := server.TTL("files:ws_1"); got != tt.wantTTL {
+				t.Fatalf("TTL = %v, want %v", got, tt.wantTTL)
+			}
+
+			server.FastForward(testRedisTTL * 3 / 4)
+			if _, ok := s.Get("ws_1"); ok != tt.alive {
+				t.Fatalf("Get() found = %v, want %v", ok, tt.alive)
+			}
+		})
+	}
+}
+
+func TestRedisStorageExpiry(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	for _, id := range []string{"ws_1", "ws_2"} {
+		if err := s.Store(id, FileData{Content: id, Size: 4, SessionID: "ws", UploadedAt: time.Now()}); err != nil {
+			t.Fatalf("Store(%s) error = %v", id, err)
+		}
+	}
+
+	server.FastForward(testRedisTTL - time.Second)
+	if !s.Touch("ws_2") {
+		t.Fatalf("Touch() = false")
+	}
+	server.FastForward(2 * time.Second)
+
+	files, err := s.List(ListFilter{})
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(files) != 1 || files[0].ID != "ws_2" {
+		t.Fatalf("List() = %v, want [ws_2]", storedIDs(files))
+	}
+	if s.Touch("ws_1") {
+		t.Fatalf("Touch() of an expired file = true")
+	}
+	if stats := s.Stats(); stats.Files != 1 || stats.Bytes != 4 {
+		t.Fatalf("Stats() = %+v, want 1 file of 4 bytes", stats)
+	}
+}
+
+func TestBoundedRedisStorageResync(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	bounded, err := NewBoundedStorage(s, 100, 0)
+	if err != nil {
+		t.Fatalf("NewBoundedStorage() error = %v", err)
+	}
+	if err := bounded.Store("ws_1", FileData{Content: "data", Size: 4, SessionID: "ws", UploadedAt: time.Now()}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Ключ истек в Redis, учет объема обновляется при очистке
+	server.FastForward(testRedisTTL + time.Second)
+	if used := bounded.Stats().Quota.UsedBytes; used != 4 {
+		t.Fatalf("used before Cleanup = %d, want 4", used)
+	}
+	bounded.Cleanup(testRedisTTL)
+	if used := bounded.Stats().Quota.UsedBytes; used != 0 {
+		t.Fatalf("used after Cleanup = %d, want 0", used)
+	}
+}
+
+func TestRedisStorageTouchAccessedAt(t *testing.T) {
+	s, server := newTestRedisStorage(t)
+	uploadedAt := time.Now().Add(-time.Hour).UTC()
+	if err := s.Store("ws_1", FileData{Content: "x", Size: 1, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Чтение продлевает ключ, но не считается активностью файла
+	if got, _ := s.Get("ws_1"); !got.LastActive().Equal(uploadedAt) {
+		t.Fatalf("LastActive() after Get = %v, want %v", got.LastActive(), uploadedAt)
+	}
+
+	before := time.Now()
+	if !s.Touch("ws_1") {
+		t.Fatalf("Touch() = false")
+	}
+	got, ok := s.Get("ws_1")
+	if !ok || got.AccessedAt.Before(before) || got.Content != "x" {
+		t.Fatalf("Get() after Touch = %+v, want accessed after %v", got, before)
+	}
+	files, err := s.List(ListFilter{})
+	if err != nil || len(files) != 1 || !files[0].Data.AccessedAt.Equal(got.AccessedAt) {
+		t.Fatalf("List() = %+v, %v, want AccessedAt %v", files, err, got.AccessedAt)
+	}
+
+	// Перезапись сбрасывает время Touch
+	if err := s.Store("ws_1", FileData{Content: "y", Size: 1, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if got, _ := s.Get("ws_1"); !got.AccessedAt.IsZero() {
+		t.Fatalf("AccessedAt after overwrite = %v, want zero", got.AccessedAt)
+	}
+
+	// Touch отсутствующего файла не создает ключ
+	if s.Touch("ws_2") {
+		t.Fatalf("Touch() of a missing file = true")
+	}
+	if server.Exists("files:ws_2") {
+		t.Fatalf("Touch() created a key for a missing file")
+	}
+}
+
+func TestRedisStorageList(t *testing.T) {
+	s, _ := newTestRedisStorage(t)
+	testListFilter(t, s)
+
+	t.Run("several scan pages", func(t *testing.T) {
+		s, server := newTestRedisStorage(t)
+		total := 2*redisScanCount + 7
+		for i := range total {
+			data := FileData{Content: "x", Size: 1, SessionID: "ws", UploadedAt: time.Now().UTC()}
+			if err := s.Store(fmt.Sprintf("ws_%d", i), data); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+		}
+		server.Set("other:key", "not a file")
+
+		files, err := s.List(ListFilter{SessionID: "ws"})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(files) != total {
+			t.Fatalf("List() = %d files, want %d", len(files), total)
+		}
+	})
+}
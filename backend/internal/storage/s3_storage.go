@@ -0,0 +1,362 @@
+// Package storage предоставляет реализацию интерфейса Storage в S3-совместимом объектном хранилище.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Timeout ограничивает время одной операции с объектным хранилищем
+const s3Timeout = 30 * time.Second
+
+// S3Options содержит параметры подключения к S3-совместимому хранилищу
+type S3Options struct {
+	Endpoint  string // Адрес хранилища без схемы (s3.amazonaws.com, minio:9000)
+	Bucket    string // Имя бакета
+	Region    string // Регион бакета
+	AccessKey string // Ключ доступа
+	SecretKey string // Секретный ключ
+	UseSSL    bool   // Подключение по HTTPS
+	Prefix    string // Префикс ключей объектов (например, uploads/)
+}
+
+// S3Storage реализует Storage-интерфейс для хранения файлов в S3-совместимом хранилище.
+// Раскладка объектов повторяет DiskStorage: <prefix><id>.content с содержимым
+// и <prefix><id>.meta с метаданными в JSON. Метаданные записываются последними,
+// поэтому файл без метаданных считается незавершенным. Хранилище разделяется
+// всеми репликами сервиса. Прочитанные метаданные кешируются по ETag объекта,
+// поэтому повторные List читают только измененные объекты .meta.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+
+	mu    sync.Mutex
+	metas map[string]s3Meta // ID -> прочитанные метаданные
+}
+
+// s3Meta содержит метаданные файла, прочитанные из объекта с указанным ETag
+type s3Meta struct {
+	etag string
+	data FileData
+}
+
+// NewS3Storage подключается к хранилищу и создает бакет, если он отсутствует
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create s3 client: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check s3 bucket: %v", err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("failed to create s3 bucket: %v", err)
+		}
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: opts.Bucket,
+		prefix: opts.Prefix,
+		metas:  make(map[string]s3Meta),
+	}, nil
+}
+
+// Store сохраняет файл в хранилище
+func (s *S3Storage) Store(id string, data FileData) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid file id: %s", id)
+	}
+
+	meta := data
+	meta.Content = ""
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	s.forgetMeta(id)
+	// Содержимое записывается до метаданных: файл без метаданных считается незавершенным
+	if err := s.put(ctx, s.key(id, contentExt), []byte(data.Content), "text/plain; charset=utf-8"); err != nil {
+		return fmt.Errorf("failed to write file content: %v", err)
+	}
+	if err := s.put(ctx, s.key(id, metaExt), metaJSON, "application/json"); err != nil {
+		s.client.RemoveObject(ctx, s.bucket, s.key(id, contentExt), minio.RemoveObjectOptions{})
+		return fmt.Errorf("failed to write file metadata: %v", err)
+	}
+	return nil
+}
+
+// Get возвращает файл из хранилища по ID
+func (s *S3Storage) Get(id string) (FileData, bool) {
+	if !validID.MatchString(id) {
+		return FileData{}, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	data, err := s.readMeta(ctx, id)
+	if err != nil {
+		if !isNotFound(err) {
+			log.Printf("failed to read metadata of %s: %v", id, err)
+		}
+		return FileData{}, false
+	}
+
+	content, err := s.get(ctx, s.key(id, contentExt))
+	if err != nil {
+		log.Printf("failed to read stored file %s: %v", id, err)
+		return FileData{}, false
+	}
+	data.Content = string(content)
+	return data, true
+}
+
+// Delete удаляет файл из хранилища
+func (s *S3Storage) Delete(id string) {
+	if !validID.MatchString(id) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	s.remove(ctx, id)
+}
+
+// Cleanup удаляет содержимое незавершенных записей (объекты .content без .meta),
+// оставшееся после сбоев и не изменявшееся дольше maxAge. Метаданные не читаются.
+func (s *S3Storage) Cleanup(maxAge time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	metas := make(map[string]bool)
+	contents := make(map[string]time.Time)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if object.Err != nil {
+			log.Printf("failed to list s3 objects: %v", object.Err)
+			return
+		}
+
+		if id, ok := s.objectID(object.Key, metaExt); ok {
+			metas[id] = true
+		} else if id, ok := s.objectID(object.Key, contentExt); ok {
+			contents[id] = object.LastModified
+		}
+	}
+
+	for id, modified := range contents {
+		if !metas[id] && time.Since(modified) > maxAge {
+			s.remove(ctx, id)
+		}
+	}
+}
+
+// List возвращает метаданные файлов, удовлетворяющих фильтру.
+// Объекты, измененные вне интервала фильтра, отбрасываются до чтения метаданных.
+func (s *S3Storage) List(filter ListFilter) ([]StoredFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	var files []StoredFile
+	listed := make(map[string]bool)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list stored files: %v", object.Err)
+		}
+
+		id, ok := s.objectID(object.Key, metaExt)
+		if !ok {
+			continue
+		}
+		listed[id] = true
+		if object.LastModified.Before(filter.UploadedAfter.Truncate(time.Second)) {
+			continue
+		}
+
+		data, err := s.listedMeta(ctx, id, object.ETag)
+		if err != nil {
+			if isNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to list stored files: %v", err)
+		}
+		if filter.Match(data) {
+			files = append(files, StoredFile{ID: id, Data: data})
+		}
+	}
+
+	s.pruneMetas(listed)
+
+	sortStoredFiles(files)
+	return paginate(files, filter), nil
+}
+
+// Stats возвращает количество, объем и время загрузки самого старого файла.
+// Статистика собирается чтением метаданных всех файлов.
+func (s *S3Storage) Stats() Stats {
+	return listStats(s)
+}
+
+// Touch продлевает время жизни файла, перезаписывая объект метаданных
+func (s *S3Storage) Touch(id string) bool {
+	if !validID.MatchString(id) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	defer cancel()
+
+	data, err := s.readMeta(ctx, id)
+	if err != nil {
+		if !isNotFound(err) {
+			log.Printf("failed to read metadata of %s: %v", id, err)
+		}
+		return false
+	}
+	data.AccessedAt = time.Now()
+	s.forgetMeta(id)
+
+	metaJSON, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to encode metadata of %s: %v", id, err)
+		return false
+	}
+	if err := s.put(ctx, s.key(id, metaExt), metaJSON, "application/json"); err != nil {
+		log.Printf("failed to write metadata of %s: %v", id, err)
+		return false
+	}
+	return true
+}
+
+// remove удаляет объекты файла. Метаданные удаляются первыми.
+func (s *S3Storage) remove(ctx context.Context, id string) {
+	s.forgetMeta(id)
+	for _, ext := range []string{metaExt, contentExt} {
+		err := s.client.RemoveObject(ctx, s.bucket, s.key(id, ext), minio.RemoveObjectOptions{})
+		if err != nil && !isNotFound(err) {
+			log.Printf("failed to remove s3 object of %s: %v", id, err)
+		}
+	}
+}
+
+// readMeta читает метаданные файла
+func (s *S3Storage) readMeta(ctx context.Context, id string) (FileData, error) {
+	metaJSON, err := s.get(ctx, s.key(id, metaExt))
+	if err != nil {
+		return FileData{}, err
+	}
+
+	var data FileData
+	if err := json.Unmarshal(metaJSON, &data); err != nil {
+		return FileData{}, fmt.Errorf("invalid metadata: %v", err)
+	}
+	return data, nil
+}
+
+// listedMeta возвращает метаданные файла из кеша, если объект .meta не изменился
+// (ETag совпадает), иначе читает их из хранилища
+func (s *S3Storage) listedMeta(ctx context.Context, id, etag string) (FileData, error) {
+	s.mu.Lock()
+	cached, ok := s.metas[id]
+	s.mu.Unlock()
+	if ok && cached.etag == etag {
+		return cached.data, nil
+	}
+
+	data, err := s.readMeta(ctx, id)
+	if err != nil {
+		return FileData{}, err
+	}
+	// Если объект изменился после получения списка, в кеш попадает новая версия
+	// со старым ETag, и следующий List прочитает ее заново
+	s.mu.Lock()
+	s.metas[id] = s3Meta{etag: etag, data: data}
+	s.mu.Unlock()
+	return data, nil
+}
+
+// forgetMeta удаляет метаданные файла из кеша
+func (s *S3Storage) forgetMeta(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.metas, id)
+}
+
+// pruneMetas удаляет из кеша файлы, отсутствующие в полном списке объектов
+// (например, удаленные другой репликой)
+func (s *S3Storage) pruneMetas(listed map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id := range s.metas {
+		if !listed[id] {
+			delete(s.metas, id)
+		}
+	}
+}
+
+// put записывает объект
+func (s *S3Storage) put(ctx context.Context, key string, content []byte, contentType string) error {
+	// Пустой объект передается без потоковой подписи: с ней minio-go отправляет
+	// его без Content-Length, и хранилище отклоняет запрос (MissingContentLength)
+	opts := minio.PutObjectOptions{ContentType: contentType, DisableContentSha256: len(content) == 0}
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(content), int64(len(content)), opts)
+	return err
+}
+
+// get читает объект целиком
+func (s *S3Storage) get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+// key возвращает ключ объекта файла с указанным расширением
+func (s *S3Storage) key(id, ext string) string {
+	return s.prefix + id + ext
+}
+
+// objectID извлекает ID файла из ключа объекта с указанным расширением
+func (s *S3Storage) objectID(key, ext string) (string, bool) {
+	id, ok := strings.CutSuffix(strings.TrimPrefix(key, s.prefix), ext)
+	if !ok || !validID.MatchString(id) {
+		return "", false
+	}
+	return id, true
+}
+
+// isNotFound проверяет, что объект отсутствует в хранилище
+func isNotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
@@ -0,0 +1,248 @@
+// Package storage содержит тесты хранилища S3 на встроенном эмуляторе S3.
+package storage
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+)
+
+// s3ObjectAge - возраст объектов эмулятора: время изменения объектов смещено в прошлое
+const s3ObjectAge = 2 * time.Hour
+
+// newTestS3Storage создает S3Storage, подключенное к эмулятору S3 в памяти
+func newTestS3Storage(t *testing.T) *S3Storage {
+	t.Helper()
+
+	backend := s3mem.New(s3mem.WithTimeSource(gofakes3.FixedTimeSource(time.Now().Add(-s3ObjectAge))))
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+
+	s, err := NewS3Storage(S3Options{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Bucket:    "code-merger",
+		Region:    "us-east-1",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Prefix:    "files/",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage() error = %v", err)
+	}
+	return s
+}
+
+// putObject записывает объект в бакет в обход S3Storage
+func putObject(t *testing.T, s *S3Storage, key, content string) {
+	t.Helper()
+
+	if err := s.put(context.Background(), key, []byte(content), "text/plain"); err != nil {
+		t.Fatalf("put(%s) error = %v", key, err)
+	}
+}
+
+// objectExists проверяет наличие объекта в бакете
+func objectExists(t *testing.T, s *S3Storage, key string) bool {
+	t.Helper()
+
+	_, err := s.client.StatObject(context.Background(), s.bucket, key, minio.StatObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		t.Fatalf("StatObject(%s) error = %v", key, err)
+	}
+	return err == nil
+}
+
+func TestS3StorageStoreGetDelete(t *testing.T) {
+	s := newTestS3Storage(t)
+	uploadedAt := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name string
+		id   string
+		data FileData
+	}{
+		{
+			name: "file",
+			id:   "ws_1",
+			data: FileData{Content: "package main\n", Filename: "main.go", Path: "cmd/main.go", Size: 13, SessionID: "ws", UploadedAt: uploadedAt},
+		},
+		{
+			name: "upload chunk",
+			id:   "ws_upload_abc_0",
+			data: FileData{Content: "chunk", Path: "a.zip", Size: 5, SessionID: "ws", UploadedAt: uploadedAt,
+				Upload: &UploadChunk{ID: "abc", Length: 10}},
+		},
+		{
+			name: "empty content",
+			id:   "ws_upload_abc",
+			data: FileData{Path: "a.zip", SessionID: "ws", UploadedAt: uploadedAt,
+				Upload: &UploadChunk{ID: "abc", Length: 10, Chunks: []int64{0}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.Store(tt.id, tt.data); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+			got, ok := s.Get(tt.id)
+			if !ok {
+				t.Fatalf("Get() not found")
+			}
+			if got.Content != tt.data.Content || got.Path != tt.data.Path || got.SessionID != tt.data.SessionID ||
+				!got.UploadedAt.Equal(tt.data.UploadedAt) {
+				t.Fatalf("Get() = %+v, want %+v", got, tt.data)
+			}
+			if (got.Upload == nil) != (tt.data.Upload == nil) ||
+				got.Upload != nil && (got.Upload.ID != tt.data.Upload.ID || len(got.Upload.Chunks) != len(tt.data.Upload.Chunks)) {
+				t.Fatalf("Get().Upload = %+v, want %+v", got.Upload, tt.data.Upload)
+			}
+
+			s.Delete(tt.id)
+			if _, ok := s.Get(tt.id); ok {
+				t.Fatalf("Get() after Delete found the file")
+			}
+			for _, ext := range []string{metaExt, contentExt} {
+				if objectExists(t, s, s.key(tt.id, ext)) {
+					t.Fatalf("object %s remains after Delete", s.key(tt.id, ext))
+				}
+			}
+		})
+	}
+
+	t.Run("invalid id", func(t *testing.T) {
+		if err := s.Store("../escape", FileData{Content: "x"}); err == nil {
+			t.Fatalf("Store() with invalid id succeeded")
+		}
+		if _, ok := s.Get("../escape"); ok {
+			t.Fatalf("Get() with invalid id found a file")
+		}
+	})
+}
+
+func TestS3StorageList(t *testing.T) {
+	s := newTestS3Storage(t)
+	now := time.Now().UTC().Truncate(time.Second)
+
+	files := map[string]FileData{
+		"a_1": {Content: "one", Size: 3, SessionID: "a", UploadedAt: now.Add(-3 * time.Minute)},
+		"a_2": {Content: "second", Size: 6, SessionID: "a", UploadedAt: now.Add(-2 * time.Minute)},
+		"b_1": {Content: "three", Size: 5, SessionID: "b", UploadedAt: now.Add(-time.Minute)},
+		"a_upload_x": {SessionID: "a", UploadedAt: now,
+			Upload: &UploadChunk{ID: "x", Length: 1}},
+	}
+	for id, data := range files {
+		if err := s.Store(id, data); err != nil {
+			t.Fatalf("Store(%s) error = %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{name: "all", filter: ListFilter{}, want: []string{"a_1", "a_2", "b_1", "a_upload_x"}},
+		{name: "session", filter: ListFilter{SessionID: "a"}, want: []string{"a_1", "a_2", "a_upload_x"}},
+		{name: "files only", filter: ListFilter{SessionID: "a", FilesOnly: true}, want: []string{"a_1", "a_2"}},
+		{name: "size", filter: ListFilter{MinSize: 4}, want: []string{"a_2", "b_1"}},
+		{name: "page", filter: ListFilter{Offset: 1, Limit: 2}, want: []string{"a_2", "b_1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if ids := storedIDs(got); strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("List() = %v, want %v", ids, tt.want)
+			}
+			for _, file := range got {
+				if file.Data.Content != "" {
+					t.Fatalf("List() returned content of %s", file.ID)
+				}
+			}
+		})
+	}
+
+	t.Run("cache follows changes", func(t *testing.T) {
+		// Перезапись меняет ETag объекта .meta, и List читает новые метаданные
+		changed := files["b_1"]
+		changed.Size = 50
+		if err := s.Store("b_1", changed); err != nil {
+			t.Fatalf("Store() error = %v", err)
+		}
+		if !s.Touch("a_1") {
+			t.Fatalf("Touch() = false")
+		}
+		// Удаление другой репликой: объекты удаляются в обход S3Storage
+		for _, ext := range []string{metaExt, contentExt} {
+			if err := s.client.RemoveObject(context.Background(), s.bucket, s.key("a_2", ext), minio.RemoveObjectOptions{}); err != nil {
+				t.Fatalf("RemoveObject() error = %v", err)
+			}
+		}
+
+		got, err := s.List(ListFilter{FilesOnly: true})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if ids := storedIDs(got); strings.Join(ids, ",") != "a_1,b_1" {
+			t.Fatalf("List() = %v, want [a_1 b_1]", ids)
+		}
+		if got[0].Data.AccessedAt.IsZero() {
+			t.Fatalf("List() did not return the touched metadata")
+		}
+		if got[1].Data.Size != 50 {
+			t.Fatalf("List() size = %d, want 50", got[1].Data.Size)
+		}
+		if _, cached := s.metas["a_2"]; cached {
+			t.Fatalf("metadata of a removed file remains cached")
+		}
+	})
+}
+
+func TestS3StorageCleanup(t *testing.T) {
+	s := newTestS3Storage(t)
+	if err := s.Store("ws_1", FileData{Content: "kept", Size: 4, SessionID: "ws", UploadedAt: time.Now()}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	// Содержимое без метаданных остается после сбоя между записью объектов
+	putObject(t, s, s.key("ws_2", contentExt), "orphan")
+
+	tests := []struct {
+		name       string
+		maxAge     time.Duration
+		wantOrphan bool
+	}{
+		{name: "orphan is younger than maxAge", maxAge: s3ObjectAge + time.Hour, wantOrphan: true},
+		{name: "orphan is older than maxAge", maxAge: s3ObjectAge - time.Hour, wantOrphan: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.Cleanup(tt.maxAge)
+
+			if got := objectExists(t, s, s.key("ws_2", contentExt)); got != tt.wantOrphan {
+				t.Fatalf("orphan content exists = %v, want %v", got, tt.wantOrphan)
+			}
+			// Файлы удаляет очистка рабочих пространств, а не хранилище
+			if _, ok := s.Get("ws_1"); !ok {
+				t.Fatalf("Cleanup() removed a complete file")
+			}
+		})
+	}
+}
+
+// storedIDs возвращает ID файлов в порядке результата List
+func storedIDs(files []StoredFile) []string {
+	ids := make([]string, 0, len(files))
+	for _, file := range files {
+		ids = append(ids, file.ID)
+	}
+	return ids
+}
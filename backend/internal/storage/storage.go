@@ -1,21 +1,192 @@
 // Package storage предоставляет интефейсы и структуры данных для хранения файлов.
-// Включает in-memory реализацию хранилища.
+// Включает in-memory, дисковую, bbolt, S3 и Redis реализации хранилища,
+// а также обертки поверх любой из них: шифрование, сжатие и дедупликацию содержимого,
+// ограничение объема.
 package storage
 
-import "time"
+import (
+	"log"
+	"sort"
+	"time"
+)
 
 // Storage определяет интерфейс для работы с хранилищем данных
 type Storage interface {
-	Store(id string, data FileData)
+	Store(id string, data FileData) error
 	Get(id string) (FileData, bool)
 	Delete(id string)
+	// Cleanup обслуживает хранилище: удаляет данные, не принадлежащие ни одному файлу
+	// (незавершенные записи, не изменявшиеся дольше maxAge, и содержимое дедупликации
+	// без ссылок), и сверяет учет оберток с базовым хранилищем. Файлы по времени жизни не удаляются:
+	// это делает FileService.Cleanup, для которого срок жизни файла зависит от
+	// активности его рабочего пространства.
 	Cleanup(maxAge time.Duration)
+	List(filter ListFilter) ([]StoredFile, error)
+	// Stats возвращает количество, объем и время загрузки самого старого файла
+	Stats() Stats
+	// Touch продлевает время жизни файла. Возвращает false, если файл не найден.
+	Touch(id string) bool
 }
 
 // FileData представляет структуру данных файла
 type FileData struct {
-	Content    string    `json:"content"`     // Содержимое файла в UTF-8
-	Filename   string    `json:"filename"`    // Оригинальное имя файла
-	UploadedAt time.Time `json:"uploaded_at"` // Время загрузки файла
-	Size       int64     `json:"size"`        // Размер файла в байтах
+	Content     string    `json:"content"`      // Содержимое файла в UTF-8
+	Filename    string    `json:"filename"`     // Оригинальное имя файла
+	Path        string    `json:"path"`         // Относительный путь файла (включая имя)
+	Encoding    string    `json:"encoding"`     // Исходная кодировка файла
+	UploadedAt  time.Time `json:"uploaded_at"`  // Время загрузки файла
+	Size        int64     `json:"size"`         // Размер файла в байтах
+	TokenCount  int       `json:"token_count"`  // Количество токенов содержимого
+	SessionID   string    `json:"session_id"`   // Рабочее пространство (сессия), в котором загружен файл
+	ContentHash string    `json:"content_hash"` // Хеш SHA-256 содержимого (для дедупликации)
+	Compression string    `json:"compression"`  // Алгоритм сжатия сохраненного содержимого
+	StoredSize  int64     `json:"stored_size"`  // Размер сохраненного (сжатого) содержимого в байтах
+	KeyID       string    `json:"key_id"`       // Идентификатор ключа шифрования содержимого
+	AccessedAt  time.Time `json:"accessed_at"`  // Время последнего продления жизни файла (Touch)
+
+	Upload *UploadChunk `json:"upload,omitempty"` // Часть незавершенной возобновляемой загрузки (nil для файлов)
+}
+
+// UploadChunk описывает запись возобновляемой загрузки: часть данных файла или
+// запись о самой загрузке, которая хранит ее состояние и список частей
+type UploadChunk struct {
+	ID     string  `json:"id"`               // Идентификатор загрузки
+	Offset int64   `json:"offset"`           // Смещение части от начала файла (в записи о загрузке - количество полученных байтов)
+	Length int64   `json:"length"`           // Полный размер загружаемого файла
+	Chunks []int64 `json:"chunks,omitempty"` // Смещения полученных частей по порядку (только в записи о загрузке)
+}
+
+// LastActive возвращает время, от которого отсчитывается время жизни файла
+func (d FileData) LastActive() time.Time {
+	if d.AccessedAt.After(d.UploadedAt) {
+		return d.AccessedAt
+	}
+	return d.UploadedAt
+}
+
+// StoredFile представляет файл в результатах List
+type StoredFile struct {
+	ID   string   // Идентификатор файла
+	Data FileData // Метаданные файла (Content не заполняется)
+}
+
+// ListFilter задает условия выборки файлов. Нулевые значения полей не ограничивают выборку.
+// Offset и Limit применяются к упорядоченному по времени загрузки результату.
+type ListFilter struct {
+	SessionID      string    // Только файлы указанного рабочего пространства
+	UploadedAfter  time.Time // Загруженные не раньше указанного времени
+	UploadedBefore time.Time // Загруженные раньше указанного времени
+	MinSize        int64     // Минимальный размер в байтах
+	MaxSize        int64     // Максимальный размер в байтах
+	FilesOnly      bool      // Только файлы, без частей незавершенных загрузок
+	Offset         int       // Количество пропускаемых файлов
+	Limit          int       // Максимальное количество файлов
+}
+
+// Match проверяет, удовлетворяют ли метаданные файла фильтру
+func (f ListFilter) Match(data FileData) bool {
+	switch {
+	case f.SessionID != "" && data.SessionID != f.SessionID:
+		return false
+	case !f.UploadedAfter.IsZero() && data.UploadedAt.Before(f.UploadedAfter):
+		return false
+	case !f.UploadedBefore.IsZero() && !data.UploadedAt.Before(f.UploadedBefore):
+		return false
+	case f.MinSize > 0 && data.Size < f.MinSize:
+		return false
+	case f.MaxSize > 0 && data.Size > f.MaxSize:
+		return false
+	case f.FilesOnly && data.Upload != nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// sortStoredFiles упорядочивает файлы по времени загрузки, а при равенстве - по ID
+func sortStoredFiles(files []StoredFile) {
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].Data.UploadedAt.Equal(files[j].Data.UploadedAt) {
+			return files[i].Data.UploadedAt.Before(files[j].Data.UploadedAt)
+		}
+		return files[i].ID < files[j].ID
+	})
+}
+
+// paginate возвращает страницу упорядоченного списка файлов согласно Offset и Limit фильтра
+func paginate(files []StoredFile, filter ListFilter) []StoredFile {
+	if filter.Offset > 0 {
+		if filter.Offset >= len(files) {
+			return nil
+		}
+		files = files[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(files) {
+		files = files[:filter.Limit]
+	}
+	return files
+}
+
+// Stats содержит статистику хранилища. Разделы заполняются обертками хранилища,
+// которые ведут соответствующий учет; отсутствующие разделы не выводятся.
+type Stats struct {
+	Files  int        `json:"files"`            // Количество файлов
+	Bytes  int64      `json:"bytes"`            // Суммарный размер файлов в байтах
+	Oldest *time.Time `json:"oldest,omitempty"` // Время загрузки самого старого файла
+
+	Quota       *QuotaStats       `json:"quota,omitempty"`       // Ограничение объема и вытеснение (BoundedStorage)
+	Compression *CompressionStats `json:"compression,omitempty"` // Сжатие содержимого (CompressedStorage)
+	Encryption  *EncryptionStats  `json:"encryption,omitempty"`  // Шифрование содержимого (EncryptedStorage)
+}
+
+// QuotaStats содержит статистику ограничения объема хранилища
+type QuotaStats struct {
+	MaxBytes     int64 `json:"max_bytes"`     // Общий лимит в байтах (0 - без ограничения)
+	SessionQuota int64 `json:"session_quota"` // Квота сессии в байтах (0 - без ограничения)
+	UsedBytes    int64 `json:"used_bytes"`    // Суммарный размер файлов
+	UploadBytes  int64 `json:"upload_bytes"`  // Суммарный размер частей незавершенных загрузок (не вытесняются)
+	Files        int   `json:"files"`         // Количество файлов
+	Evictions    int64 `json:"evictions"`     // Количество вытесненных файлов
+	EvictedBytes int64 `json:"evicted_bytes"` // Суммарный размер вытесненных файлов
+	Rejections   int64 `json:"rejections"`    // Количество отклоненных файлов
+}
+
+// CompressionStats содержит статистику сжатия содержимого
+type CompressionStats struct {
+	Algorithm    string  `json:"algorithm"`     // Алгоритм сжатия новых файлов
+	Files        int     `json:"files"`         // Количество сжатых записей
+	LogicalBytes int64   `json:"logical_bytes"` // Суммарный размер содержимого до сжатия
+	StoredBytes  int64   `json:"stored_bytes"`  // Суммарный размер сжатого содержимого
+	Ratio        float64 `json:"ratio"`         // Степень сжатия: logical_bytes / stored_bytes
+}
+
+// EncryptionStats содержит статистику шифрования содержимого
+type EncryptionStats struct {
+	CurrentKey string         `json:"current_key"` // Идентификатор ключа для новых файлов
+	Keys       map[string]int `json:"keys"`        // Идентификатор ключа -> количество зашифрованных им записей
+}
+
+// add учитывает файл в количестве, объеме и времени самого старого файла
+func (s *Stats) add(data FileData) {
+	s.Files++
+	s.Bytes += data.Size
+	if s.Oldest == nil || data.UploadedAt.Before(*s.Oldest) {
+		uploadedAt := data.UploadedAt
+		s.Oldest = &uploadedAt
+	}
+}
+
+// listStats подсчитывает статистику по метаданным всех файлов хранилища
+func listStats(s Storage) Stats {
+	var stats Stats
+
+	files, err := s.List(ListFilter{})
+	if err != nil {
+		log.Printf("failed to collect storage stats: %v", err)
+		return stats
+	}
+	for _, file := range files {
+		stats.add(file.Data)
+	}
+	return stats
 }
@@ -0,0 +1,180 @@
+// Package storage содержит тесты контракта Cleanup для всех хранилищ.
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testFileAge - возраст файлов в тестах очистки, больше maxAge
+const testFileAge = 2 * time.Hour
+
+func TestCleanupKeepsExpiredFiles(t *testing.T) {
+	backends := map[string]func(t *testing.T) Storage{
+		"memory": func(*testing.T) Storage { return NewMemoryStorage() },
+		"disk": func(t *testing.T) Storage {
+			s, err := NewDiskStorage(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewDiskStorage() error = %v", err)
+			}
+			return s
+		},
+		"bolt": func(t *testing.T) Storage {
+			s, err := NewBoltStorage(filepath.Join(t.TempDir(), "files.db"))
+			if err != nil {
+				t.Fatalf("NewBoltStorage() error = %v", err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+		"s3": func(t *testing.T) Storage { return newTestS3Storage(t) },
+		"dedup": func(*testing.T) Storage {
+			s, err := NewDedupStorage(NewMemoryStorage())
+			if err != nil {
+				t.Fatalf("NewDedupStorage() error = %v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := newStorage(t)
+			uploadedAt := time.Now().Add(-testFileAge)
+			if err := s.Store("ws_1", FileData{Content: "old", Size: 3, SessionID: "ws", UploadedAt: uploadedAt}); err != nil {
+				t.Fatalf("Store() error = %v", err)
+			}
+
+			// Файлы по времени жизни удаляет FileService.Cleanup по активности рабочего пространства
+			s.Cleanup(time.Hour)
+
+			got, ok := s.Get("ws_1")
+			if !ok || got.Content != "old" {
+				t.Fatalf("Get() after Cleanup = %+v, %v, want the expired file kept", got, ok)
+			}
+			if stats := s.Stats(); stats.Files != 1 {
+				t.Fatalf("Stats().Files after Cleanup = %d, want 1", stats.Files)
+			}
+		})
+	}
+}
+
+func TestDiskStorageCleanupRemovesStaleTemps(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewDiskStorage(dir)
+	if err != nil {
+		t.Fatalf("NewDiskStorage() error = %v", err)
+	}
+
+	// Временные файлы остаются после сбоев записи во время работы
+	stale := filepath.Join(dir, "ws_1.content.1"+tempExt)
+	fresh := filepath.Join(dir, "ws_2.content.2"+tempExt)
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("partial"), 0o600); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+	}
+	old := time.Now().Add(-testFileAge)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	s.Cleanup(time.Hour)
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("stale temp file remains: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Fatalf("temp file of a write in progress was removed: %v", err)
+	}
+}
+
+func TestDedupStorageCleanupRemovesOrphans(t *testing.T) {
+	inner := NewMemoryStorage()
+	s, err := NewDedupStorage(inner)
+	if err != nil {
+		t.Fatalf("NewDedupStorage() error = %v", err)
+	}
+	if err := s.Store("ws_1", FileData{Content: "shared", Size: 6, UploadedAt: time.Now()}); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	// Содержимое без ссылок остается, если сбой произошел между записью содержимого и файла
+	orphan := blobKey(ContentHash("orphan"))
+	if err := inner.Store(orphan, FileData{Content: "orphan", Size: 6, UploadedAt: time.Now()}); err != nil {
+		t.Fatalf("Store(orphan) error = %v", err)
+	}
+
+	s.Cleanup(time.Hour)
+
+	if _, ok := inner.Get(orphan); ok {
+		t.Fatalf("orphan content remains after Cleanup")
+	}
+	if _, ok := inner.Get(blobKey(ContentHash("shared"))); !ok {
+		t.Fatalf("referenced content was removed by Cleanup")
+	}
+	if got, ok := s.Get("ws_1"); !ok || got.Content != "shared" {
+		t.Fatalf("Get() after Cleanup = %+v, %v, want the file kept", got, ok)
+	}
+}
+
+// testListFilter сохраняет набор файлов и проверяет отбор и постраничный вывод List
+func testListFilter(t *testing.T, s Storage) {
+	t.Helper()
+
+	base := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	stored := []struct {
+		id   string
+		data FileData
+	}{
+		{id: "a_1", data: FileData{Content: "1", Size: 10, SessionID: "a", UploadedAt: base}},
+		{id: "b_1", data: FileData{Content: "2", Size: 20, SessionID: "b", UploadedAt: base.Add(time.Minute)}},
+		{id: "a_2", data: FileData{Content: "3", Size: 30, SessionID: "a", UploadedAt: base.Add(2 * time.Minute)}},
+		{id: "a_3", data: FileData{Content: "4", Size: 40, SessionID: "a", UploadedAt: base.Add(3 * time.Minute)}},
+		{id: "a_upload", data: FileData{Content: "5", Size: 50, SessionID: "a", UploadedAt: base.Add(4 * time.Minute), Upload: &UploadChunk{ID: "u"}}},
+	}
+	for _, file := range stored {
+		if err := s.Store(file.id, file.data); err != nil {
+			t.Fatalf("Store(%s) error = %v", file.id, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   []string
+	}{
+		{name: "all in upload order", filter: ListFilter{}, want: []string{"a_1", "b_1", "a_2", "a_3", "a_upload"}},
+		{name: "session", filter: ListFilter{SessionID: "a"}, want: []string{"a_1", "a_2", "a_3", "a_upload"}},
+		{name: "files only", filter: ListFilter{SessionID: "a", FilesOnly: true}, want: []string{"a_1", "a_2", "a_3"}},
+		{name: "uploaded after", filter: ListFilter{UploadedAfter: base.Add(2 * time.Minute)}, want: []string{"a_2", "a_3", "a_upload"}},
+		{name: "uploaded before", filter: ListFilter{UploadedBefore: base.Add(2 * time.Minute)}, want: []string{"a_1", "b_1"}},
+		{name: "time range", filter: ListFilter{UploadedAfter: base.Add(time.Minute), UploadedBefore: base.Add(3 * time.Minute)}, want: []string{"b_1", "a_2"}},
+		{name: "size range", filter: ListFilter{MinSize: 20, MaxSize: 40}, want: []string{"b_1", "a_2", "a_3"}},
+		{name: "session and time", filter: ListFilter{SessionID: "a", UploadedAfter: base.Add(time.Minute), FilesOnly: true}, want: []string{"a_2", "a_3"}},
+		{name: "first page", filter: ListFilter{Limit: 2}, want: []string{"a_1", "b_1"}},
+		{name: "second page", filter: ListFilter{Offset: 2, Limit: 2}, want: []string{"a_2", "a_3"}},
+		{name: "last page", filter: ListFilter{Offset: 4, Limit: 2}, want: []string{"a_upload"}},
+		{name: "past the end", filter: ListFilter{Offset: 5}, want: []string{}},
+		{name: "filtered page", filter: ListFilter{SessionID: "a", FilesOnly: true, Offset: 1, Limit: 1}, want: []string{"a_2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := s.List(tt.filter)
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if got := storedIDs(files); !slices.Equal(got, tt.want) {
+				t.Fatalf("List() = %v, want %v", got, tt.want)
+			}
+			for _, file := range files {
+				if file.Data.Content != "" {
+					t.Fatalf("List() returned content of %s", file.ID)
+				}
+			}
+		})
+	}
+}
@@ -8,6 +8,9 @@ var SupportedExtensions = map[string]bool{
 	".html": true, ".css": true, ".js": true, ".sh": true,
 }
 
+// Поддерживаемые расширения архивов (составные расширения указываются целиком)
+var ArchiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
 // Префиксы комментариев для разных типов файлов
 var CommentPrefixes = map[string]string{
 	"dockerfile": "#",
@@ -24,3 +27,28 @@ var CommentPrefixes = map[string]string{
 
 // DefaultCommentPrefix префикс по умолчанию
 const DefaultCommentPrefix = "#"
+
+// Языки для разных типов файлов (используются в info string блоков кода Markdown)
+var Languages = map[string]string{
+	"dockerfile": "dockerfile",
+	"makefile":   "makefile",
+	".md":        "markdown",
+	".txt":       "text",
+	".yaml":      "yaml",
+	".yml":       "yaml",
+	".json":      "json",
+	".cpp":       "cpp",
+	".go":        "go",
+	".py":        "python",
+	".html":      "html",
+	".css":       "css",
+	".js":        "javascript",
+	".sh":        "bash",
+	".java":      "java",
+}
+
+// DefaultLanguage язык по умолчанию
+const DefaultLanguage = "text"
+
+// MaxTemplateSize максимальный размер пользовательского шаблона объединения в байтах
+const MaxTemplateSize = 64 * 1024
@@ -220,7 +220,7 @@ class App {
         const fileData = this.files.get(fileId);
         fileData.customName = newName;
 
-        this.renames.set(fileData.originalName, newName);
+        this.renames.set(fileId, newName);
     }
 
     /**
@@ -236,8 +236,7 @@ class App {
             return;
         }
 
-        const fileData = this.files.get(fileId);
-        this.renames.delete(fileData.originalName);
+        this.renames.delete(fileId);
         this.files.delete(fileId);
 
         console.log('Files after removal:', Array.from(this.files.keys()));
@@ -6,6 +6,29 @@
 // Базовый URL API определяется в зависимости от окружения
 const API_BASE_URL = '/api';
 
+/**
+ * Возвращает токен рабочего пространства, к которому относятся загруженные файлы.
+ * Рабочее пространство создается на сервере при первом обращении,
+ * токен хранится в sessionStorage и живет до закрытия вкладки.
+ * @returns {Promise<string>} Токен рабочего пространства
+ * @throws {Error} Если создать рабочее пространство не удалось
+ */
+async function getWorkspaceToken() {
+    let token = sessionStorage.getItem('workspaceToken');
+    if (token) {
+        return token;
+    }
+
+    const response = await fetch(`${API_BASE_URL}/workspaces`, { method: 'POST' });
+    if (!response.ok) {
+        throw new Error(`HTTP ${response.status}: не удалось создать рабочее пространство`);
+    }
+
+    token = (await response.json()).token;
+    sessionStorage.setItem('workspaceToken', token);
+    return token;
+}
+
 /**
  * Загружает файлы на сервер
  * @param {File[]} files - Массив файлов для загрузки
@@ -15,13 +38,17 @@ const API_BASE_URL = '/api';
 export async function uploadFiles(files) {
     const formData = new FormData();
 
+    // При загрузке папки передаем относительный путь, чтобы сервер сохранил структуру каталогов
     files.forEach(file => {
-        formData.append('files', file);
+        formData.append('files', file, file.webkitRelativePath || file.name);
     });
 
     try {
         const response = await fetch(`${API_BASE_URL}/upload`, {
             method: 'POST',
+            headers: {
+                'X-Workspace-Token': await getWorkspaceToken(),
+            },
             body: formData,
             credentials: 'include'
         });
@@ -34,6 +61,16 @@ export async function uploadFiles(files) {
         const result = await response.json();
         console.log('Upload response:', result);
 
+        const rejected = (result.results || []).filter(item => item.status === 'rejected');
+        if (rejected.length > 0) {
+            console.warn('Rejected files:', rejected);
+        }
+
+        const ignored = (result.results || []).filter(item => item.status === 'ignored');
+        if (ignored.length > 0) {
+            console.info('Ignored files:', ignored.map(item => `${item.name} (${item.rule})`));
+        }
+
         return result.file_ids || [];
     } catch (error) {
         console.error('Upload error:', error);
@@ -56,6 +93,7 @@ export async function mergeFiles({ file_ids, output_filename, file_renames = {}
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
+                'X-Workspace-Token': await getWorkspaceToken(),
             },
             body: JSON.stringify({
                 file_ids,
@@ -85,7 +123,11 @@ export async function mergeFiles({ file_ids, output_filename, file_renames = {}
 export async function getFileContent(fileId) {
     try {
         console.log('Fetching file content for ID:', fileId);
-        const response = await fetch(`${API_BASE_URL}/file/${fileId}`);
+        const response = await fetch(`${API_BASE_URL}/file/${fileId}`, {
+            headers: {
+                'X-Workspace-Token': await getWorkspaceToken(),
+            },
+        });
 
         if (!response.ok) {
             const error = await response.json();